@@ -29,12 +29,69 @@ const (
 // of the legacy proto package is being used.
 const _ = proto.ProtoPackageIsVersion4
 
+type ChecksumAlgorithm int32
+
+const (
+	ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE   ChecksumAlgorithm = 0
+	ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256 ChecksumAlgorithm = 1
+	ChecksumAlgorithm_CHECKSUM_ALGORITHM_BLAKE3 ChecksumAlgorithm = 2
+	ChecksumAlgorithm_CHECKSUM_ALGORITHM_CRC32C ChecksumAlgorithm = 3
+)
+
+// Enum value maps for ChecksumAlgorithm.
+var (
+	ChecksumAlgorithm_name = map[int32]string{
+		0: "CHECKSUM_ALGORITHM_NONE",
+		1: "CHECKSUM_ALGORITHM_SHA256",
+		2: "CHECKSUM_ALGORITHM_BLAKE3",
+		3: "CHECKSUM_ALGORITHM_CRC32C",
+	}
+	ChecksumAlgorithm_value = map[string]int32{
+		"CHECKSUM_ALGORITHM_NONE":   0,
+		"CHECKSUM_ALGORITHM_SHA256": 1,
+		"CHECKSUM_ALGORITHM_BLAKE3": 2,
+		"CHECKSUM_ALGORITHM_CRC32C": 3,
+	}
+)
+
+func (x ChecksumAlgorithm) Enum() *ChecksumAlgorithm {
+	p := new(ChecksumAlgorithm)
+	*p = x
+	return p
+}
+
+func (x ChecksumAlgorithm) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ChecksumAlgorithm) Descriptor() protoreflect.EnumDescriptor {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_enumTypes[0].Descriptor()
+}
+
+func (ChecksumAlgorithm) Type() protoreflect.EnumType {
+	return &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_enumTypes[0]
+}
+
+func (x ChecksumAlgorithm) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ChecksumAlgorithm.Descriptor instead.
+func (ChecksumAlgorithm) EnumDescriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{0}
+}
+
 type UploadStatusCode int32
 
 const (
-	UploadStatusCode_STATUS_CODE_UNKNOWN UploadStatusCode = 0
-	UploadStatusCode_STATUS_CODE_OK      UploadStatusCode = 1
-	UploadStatusCode_STATUS_CODE_FAILED  UploadStatusCode = 2
+	UploadStatusCode_STATUS_CODE_UNKNOWN           UploadStatusCode = 0
+	UploadStatusCode_STATUS_CODE_OK                UploadStatusCode = 1
+	UploadStatusCode_STATUS_CODE_FAILED            UploadStatusCode = 2
+	UploadStatusCode_STATUS_CODE_CHECKSUM_MISMATCH UploadStatusCode = 3
+	// The following are attached as details to a RESOURCE_EXHAUSTED error, the partial file is removed.
+	UploadStatusCode_STATUS_CODE_FILE_TOO_LARGE       UploadStatusCode = 4
+	UploadStatusCode_STATUS_CODE_QUOTA_EXCEEDED       UploadStatusCode = 5
+	UploadStatusCode_STATUS_CODE_INSUFFICIENT_STORAGE UploadStatusCode = 6
 )
 
 // Enum value maps for UploadStatusCode.
@@ -43,11 +100,19 @@ var (
 		0: "STATUS_CODE_UNKNOWN",
 		1: "STATUS_CODE_OK",
 		2: "STATUS_CODE_FAILED",
+		3: "STATUS_CODE_CHECKSUM_MISMATCH",
+		4: "STATUS_CODE_FILE_TOO_LARGE",
+		5: "STATUS_CODE_QUOTA_EXCEEDED",
+		6: "STATUS_CODE_INSUFFICIENT_STORAGE",
 	}
 	UploadStatusCode_value = map[string]int32{
-		"STATUS_CODE_UNKNOWN": 0,
-		"STATUS_CODE_OK":      1,
-		"STATUS_CODE_FAILED":  2,
+		"STATUS_CODE_UNKNOWN":              0,
+		"STATUS_CODE_OK":                   1,
+		"STATUS_CODE_FAILED":               2,
+		"STATUS_CODE_CHECKSUM_MISMATCH":    3,
+		"STATUS_CODE_FILE_TOO_LARGE":       4,
+		"STATUS_CODE_QUOTA_EXCEEDED":       5,
+		"STATUS_CODE_INSUFFICIENT_STORAGE": 6,
 	}
 )
 
@@ -62,47 +127,798 @@ func (x UploadStatusCode) String() string {
 }
 
 func (UploadStatusCode) Descriptor() protoreflect.EnumDescriptor {
-	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_enumTypes[0].Descriptor()
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_enumTypes[1].Descriptor()
 }
 
 func (UploadStatusCode) Type() protoreflect.EnumType {
-	return &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_enumTypes[0]
+	return &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_enumTypes[1]
 }
 
 func (x UploadStatusCode) Number() protoreflect.EnumNumber {
 	return protoreflect.EnumNumber(x)
 }
 
-// Deprecated: Use UploadStatusCode.Descriptor instead.
-func (UploadStatusCode) EnumDescriptor() ([]byte, []int) {
-	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{0}
+// Deprecated: Use UploadStatusCode.Descriptor instead.
+func (UploadStatusCode) EnumDescriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{1}
+}
+
+// FileMeta is sent as the very first message of an upload stream.
+type FileMeta struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Name is the file name relative to the server's storage directory.
+	Name string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	// Size is the total size of the file in bytes.
+	Size int64 `protobuf:"varint,2,opt,name=Size,proto3" json:"Size,omitempty"`
+	// Mode holds the unix permission bits of the file.
+	Mode uint32 `protobuf:"varint,3,opt,name=Mode,proto3" json:"Mode,omitempty"`
+	// ModTime is the modification time of the file in unix nanoseconds.
+	ModTime     int64  `protobuf:"varint,4,opt,name=ModTime,proto3" json:"ModTime,omitempty"`
+	ContentType string `protobuf:"bytes,5,opt,name=ContentType,proto3" json:"ContentType,omitempty"`
+	// ChecksumAlgorithm tells the server how to hash the content while receiving it.
+	ChecksumAlgorithm ChecksumAlgorithm `protobuf:"varint,6,opt,name=ChecksumAlgorithm,proto3,enum=amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.ChecksumAlgorithm" json:"ChecksumAlgorithm,omitempty"`
+	// SessionId identifies a resumable upload, empty means the upload can not be resumed.
+	SessionId string `protobuf:"bytes,7,opt,name=SessionId,proto3" json:"SessionId,omitempty"`
+	// Offset is where the content of this stream starts, see QueryUploadOffset.
+	Offset int64 `protobuf:"varint,8,opt,name=Offset,proto3" json:"Offset,omitempty"`
+	// Parts is the number of concurrent streams the file is split into, 0 or 1 means a single stream.
+	Parts int32 `protobuf:"varint,9,opt,name=Parts,proto3" json:"Parts,omitempty"`
+	// Length is the number of bytes carried by this stream when Parts > 1.
+	Length int64 `protobuf:"varint,10,opt,name=Length,proto3" json:"Length,omitempty"`
+	// DeltaBlockSize marks a delta upload when > 0: the file is rebuilt from Content chunks carrying literal data
+	// and Block references into the server's current copy of Name, split into blocks of this size by GetSignature.
+	DeltaBlockSize int32 `protobuf:"varint,11,opt,name=DeltaBlockSize,proto3" json:"DeltaBlockSize,omitempty"`
+}
+
+func (x *FileMeta) Reset() {
+	*x = FileMeta{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FileMeta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileMeta) ProtoMessage() {}
+
+func (x *FileMeta) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileMeta.ProtoReflect.Descriptor instead.
+func (*FileMeta) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FileMeta) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FileMeta) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *FileMeta) GetMode() uint32 {
+	if x != nil {
+		return x.Mode
+	}
+	return 0
+}
+
+func (x *FileMeta) GetModTime() int64 {
+	if x != nil {
+		return x.ModTime
+	}
+	return 0
+}
+
+func (x *FileMeta) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *FileMeta) GetChecksumAlgorithm() ChecksumAlgorithm {
+	if x != nil {
+		return x.ChecksumAlgorithm
+	}
+	return ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE
+}
+
+func (x *FileMeta) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *FileMeta) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *FileMeta) GetParts() int32 {
+	if x != nil {
+		return x.Parts
+	}
+	return 0
+}
+
+func (x *FileMeta) GetLength() int64 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *FileMeta) GetDeltaBlockSize() int32 {
+	if x != nil {
+		return x.DeltaBlockSize
+	}
+	return 0
+}
+
+// FileTrailer is sent as the very last message of an upload stream.
+type FileTrailer struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Checksum []byte `protobuf:"bytes,1,opt,name=Checksum,proto3" json:"Checksum,omitempty"`
+}
+
+func (x *FileTrailer) Reset() {
+	*x = FileTrailer{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FileTrailer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileTrailer) ProtoMessage() {}
+
+func (x *FileTrailer) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileTrailer.ProtoReflect.Descriptor instead.
+func (*FileTrailer) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FileTrailer) GetChecksum() []byte {
+	if x != nil {
+		return x.Checksum
+	}
+	return nil
+}
+
+// BlockRef copies Count consecutive blocks starting at block Index of the server's current copy of the file,
+// only valid in delta uploads.
+type BlockRef struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Index int64 `protobuf:"varint,1,opt,name=Index,proto3" json:"Index,omitempty"`
+	Count int64 `protobuf:"varint,2,opt,name=Count,proto3" json:"Count,omitempty"`
+}
+
+func (x *BlockRef) Reset() {
+	*x = BlockRef{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BlockRef) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockRef) ProtoMessage() {}
+
+func (x *BlockRef) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockRef.ProtoReflect.Descriptor instead.
+func (*BlockRef) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BlockRef) GetIndex() int64 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *BlockRef) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type FileChunk struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Data:
+	//	*FileChunk_Content
+	//	*FileChunk_Meta
+	//	*FileChunk_Trailer
+	//	*FileChunk_Block
+	Data isFileChunk_Data `protobuf_oneof:"Data"`
+}
+
+func (x *FileChunk) Reset() {
+	*x = FileChunk{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FileChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileChunk) ProtoMessage() {}
+
+func (x *FileChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileChunk.ProtoReflect.Descriptor instead.
+func (*FileChunk) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{3}
+}
+
+func (m *FileChunk) GetData() isFileChunk_Data {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (x *FileChunk) GetContent() []byte {
+	if x, ok := x.GetData().(*FileChunk_Content); ok {
+		return x.Content
+	}
+	return nil
+}
+
+func (x *FileChunk) GetMeta() *FileMeta {
+	if x, ok := x.GetData().(*FileChunk_Meta); ok {
+		return x.Meta
+	}
+	return nil
+}
+
+func (x *FileChunk) GetTrailer() *FileTrailer {
+	if x, ok := x.GetData().(*FileChunk_Trailer); ok {
+		return x.Trailer
+	}
+	return nil
+}
+
+func (x *FileChunk) GetBlock() *BlockRef {
+	if x, ok := x.GetData().(*FileChunk_Block); ok {
+		return x.Block
+	}
+	return nil
+}
+
+type isFileChunk_Data interface {
+	isFileChunk_Data()
+}
+
+type FileChunk_Content struct {
+	Content []byte `protobuf:"bytes,1,opt,name=Content,proto3,oneof"`
+}
+
+type FileChunk_Meta struct {
+	Meta *FileMeta `protobuf:"bytes,2,opt,name=Meta,proto3,oneof"`
+}
+
+type FileChunk_Trailer struct {
+	Trailer *FileTrailer `protobuf:"bytes,3,opt,name=Trailer,proto3,oneof"`
+}
+
+type FileChunk_Block struct {
+	Block *BlockRef `protobuf:"bytes,4,opt,name=Block,proto3,oneof"`
+}
+
+func (*FileChunk_Content) isFileChunk_Data() {}
+
+func (*FileChunk_Meta) isFileChunk_Data() {}
+
+func (*FileChunk_Trailer) isFileChunk_Data() {}
+
+func (*FileChunk_Block) isFileChunk_Data() {}
+
+type UploadStatus struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Message string           `protobuf:"bytes,1,opt,name=Message,proto3" json:"Message,omitempty"`
+	Code    UploadStatusCode `protobuf:"varint,2,opt,name=Code,proto3,enum=amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadStatusCode" json:"Code,omitempty"`
+	// TransferId echoes the transfer id sent by the client in the x-transfer-id metadata.
+	TransferId string `protobuf:"bytes,3,opt,name=TransferId,proto3" json:"TransferId,omitempty"`
+}
+
+func (x *UploadStatus) Reset() {
+	*x = UploadStatus{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *UploadStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadStatus) ProtoMessage() {}
+
+func (x *UploadStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadStatus.ProtoReflect.Descriptor instead.
+func (*UploadStatus) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *UploadStatus) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *UploadStatus) GetCode() UploadStatusCode {
+	if x != nil {
+		return x.Code
+	}
+	return UploadStatusCode_STATUS_CODE_UNKNOWN
+}
+
+func (x *UploadStatus) GetTransferId() string {
+	if x != nil {
+		return x.TransferId
+	}
+	return ""
+}
+
+type UploadSession struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	SessionId string `protobuf:"bytes,1,opt,name=SessionId,proto3" json:"SessionId,omitempty"`
+}
+
+func (x *UploadSession) Reset() {
+	*x = UploadSession{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *UploadSession) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadSession) ProtoMessage() {}
+
+func (x *UploadSession) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadSession.ProtoReflect.Descriptor instead.
+func (*UploadSession) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *UploadSession) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+type UploadOffset struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Offset int64 `protobuf:"varint,1,opt,name=Offset,proto3" json:"Offset,omitempty"`
+}
+
+func (x *UploadOffset) Reset() {
+	*x = UploadOffset{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *UploadOffset) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadOffset) ProtoMessage() {}
+
+func (x *UploadOffset) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadOffset.ProtoReflect.Descriptor instead.
+func (*UploadOffset) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *UploadOffset) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+type DownloadRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Name is the file name relative to the server's storage directory.
+	Name              string            `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	ChunkSize         int32             `protobuf:"varint,2,opt,name=ChunkSize,proto3" json:"ChunkSize,omitempty"`
+	ChecksumAlgorithm ChecksumAlgorithm `protobuf:"varint,3,opt,name=ChecksumAlgorithm,proto3,enum=amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.ChecksumAlgorithm" json:"ChecksumAlgorithm,omitempty"`
+}
+
+func (x *DownloadRequest) Reset() {
+	*x = DownloadRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DownloadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DownloadRequest) ProtoMessage() {}
+
+func (x *DownloadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DownloadRequest.ProtoReflect.Descriptor instead.
+func (*DownloadRequest) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DownloadRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *DownloadRequest) GetChunkSize() int32 {
+	if x != nil {
+		return x.ChunkSize
+	}
+	return 0
+}
+
+func (x *DownloadRequest) GetChecksumAlgorithm() ChecksumAlgorithm {
+	if x != nil {
+		return x.ChecksumAlgorithm
+	}
+	return ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE
+}
+
+// ContentQuery asks whether the server already stores a file with the given content.
+type ContentQuery struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Sha256 is the SHA-256 digest of the whole file content.
+	Sha256 []byte `protobuf:"bytes,1,opt,name=Sha256,proto3" json:"Sha256,omitempty"`
+	// Meta, when set, asks the server to store the content under Meta.Name right away if it holds it,
+	// so that the upload can be skipped.
+	Meta *FileMeta `protobuf:"bytes,2,opt,name=Meta,proto3" json:"Meta,omitempty"`
+}
+
+func (x *ContentQuery) Reset() {
+	*x = ContentQuery{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ContentQuery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ContentQuery) ProtoMessage() {}
+
+func (x *ContentQuery) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ContentQuery.ProtoReflect.Descriptor instead.
+func (*ContentQuery) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ContentQuery) GetSha256() []byte {
+	if x != nil {
+		return x.Sha256
+	}
+	return nil
+}
+
+func (x *ContentQuery) GetMeta() *FileMeta {
+	if x != nil {
+		return x.Meta
+	}
+	return nil
+}
+
+type ContentStatus struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Exists tells whether the server holds the content.
+	Exists bool `protobuf:"varint,1,opt,name=Exists,proto3" json:"Exists,omitempty"`
+	// Stored tells whether the content has been stored under the name given in ContentQuery.Meta.
+	Stored bool `protobuf:"varint,2,opt,name=Stored,proto3" json:"Stored,omitempty"`
+}
+
+func (x *ContentStatus) Reset() {
+	*x = ContentStatus{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ContentStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ContentStatus) ProtoMessage() {}
+
+func (x *ContentStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ContentStatus.ProtoReflect.Descriptor instead.
+func (*ContentStatus) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ContentStatus) GetExists() bool {
+	if x != nil {
+		return x.Exists
+	}
+	return false
+}
+
+func (x *ContentStatus) GetStored() bool {
+	if x != nil {
+		return x.Stored
+	}
+	return false
+}
+
+type SignatureRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Name is the file name relative to the server's storage directory.
+	Name string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	// BlockSize is the preferred block size, 0 lets the server choose. The server may use larger blocks for large files.
+	BlockSize int32 `protobuf:"varint,2,opt,name=BlockSize,proto3" json:"BlockSize,omitempty"`
+}
+
+func (x *SignatureRequest) Reset() {
+	*x = SignatureRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SignatureRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SignatureRequest) ProtoMessage() {}
+
+func (x *SignatureRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SignatureRequest.ProtoReflect.Descriptor instead.
+func (*SignatureRequest) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SignatureRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SignatureRequest) GetBlockSize() int32 {
+	if x != nil {
+		return x.BlockSize
+	}
+	return 0
 }
 
-type FileChunk struct {
+// BlockChecksum holds the checksums of one block of a file.
+type BlockChecksum struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Content []byte `protobuf:"bytes,1,opt,name=Content,proto3" json:"Content,omitempty"`
+	// Weak is the rsync rolling checksum of the block.
+	Weak uint32 `protobuf:"varint,1,opt,name=Weak,proto3" json:"Weak,omitempty"`
+	// Strong is the first 16 bytes of the SHA-256 of the block.
+	Strong []byte `protobuf:"bytes,2,opt,name=Strong,proto3" json:"Strong,omitempty"`
 }
 
-func (x *FileChunk) Reset() {
-	*x = FileChunk{}
+func (x *BlockChecksum) Reset() {
+	*x = BlockChecksum{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[0]
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[11]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *FileChunk) String() string {
+func (x *BlockChecksum) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*FileChunk) ProtoMessage() {}
+func (*BlockChecksum) ProtoMessage() {}
 
-func (x *FileChunk) ProtoReflect() protoreflect.Message {
-	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[0]
+func (x *BlockChecksum) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[11]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -113,44 +929,53 @@ func (x *FileChunk) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use FileChunk.ProtoReflect.Descriptor instead.
-func (*FileChunk) Descriptor() ([]byte, []int) {
-	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{0}
+// Deprecated: Use BlockChecksum.ProtoReflect.Descriptor instead.
+func (*BlockChecksum) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{11}
 }
 
-func (x *FileChunk) GetContent() []byte {
+func (x *BlockChecksum) GetWeak() uint32 {
 	if x != nil {
-		return x.Content
+		return x.Weak
+	}
+	return 0
+}
+
+func (x *BlockChecksum) GetStrong() []byte {
+	if x != nil {
+		return x.Strong
 	}
 	return nil
 }
 
-type UploadStatus struct {
+type FileSignature struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Message string           `protobuf:"bytes,1,opt,name=Message,proto3" json:"Message,omitempty"`
-	Code    UploadStatusCode `protobuf:"varint,2,opt,name=Code,proto3,enum=amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadStatusCode" json:"Code,omitempty"`
+	// Size is the size of the server's copy, the last block is shorter than BlockSize unless Size is a multiple of it.
+	Size      int64            `protobuf:"varint,1,opt,name=Size,proto3" json:"Size,omitempty"`
+	BlockSize int32            `protobuf:"varint,2,opt,name=BlockSize,proto3" json:"BlockSize,omitempty"`
+	Blocks    []*BlockChecksum `protobuf:"bytes,3,rep,name=Blocks,proto3" json:"Blocks,omitempty"`
 }
 
-func (x *UploadStatus) Reset() {
-	*x = UploadStatus{}
+func (x *FileSignature) Reset() {
+	*x = FileSignature{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[1]
+		mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[12]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *UploadStatus) String() string {
+func (x *FileSignature) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*UploadStatus) ProtoMessage() {}
+func (*FileSignature) ProtoMessage() {}
 
-func (x *UploadStatus) ProtoReflect() protoreflect.Message {
-	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[1]
+func (x *FileSignature) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[12]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -161,23 +986,30 @@ func (x *UploadStatus) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use UploadStatus.ProtoReflect.Descriptor instead.
-func (*UploadStatus) Descriptor() ([]byte, []int) {
-	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{1}
+// Deprecated: Use FileSignature.ProtoReflect.Descriptor instead.
+func (*FileSignature) Descriptor() ([]byte, []int) {
+	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescGZIP(), []int{12}
 }
 
-func (x *UploadStatus) GetMessage() string {
+func (x *FileSignature) GetSize() int64 {
 	if x != nil {
-		return x.Message
+		return x.Size
 	}
-	return ""
+	return 0
 }
 
-func (x *UploadStatus) GetCode() UploadStatusCode {
+func (x *FileSignature) GetBlockSize() int32 {
 	if x != nil {
-		return x.Code
+		return x.BlockSize
 	}
-	return UploadStatusCode_STATUS_CODE_UNKNOWN
+	return 0
+}
+
+func (x *FileSignature) GetBlocks() []*BlockChecksum {
+	if x != nil {
+		return x.Blocks
+	}
+	return nil
 }
 
 var File_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto protoreflect.FileDescriptor
@@ -192,42 +1024,205 @@ var file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_to
 	0x6d, 0x61, 0x7a, 0x69, 0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f,
 	0x6e, 0x5f, 0x64, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61,
 	0x6d, 0x70, 0x6c, 0x65, 0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f,
-	0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x22, 0x25, 0x0a,
-	0x09, 0x46, 0x69, 0x6c, 0x65, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x12, 0x18, 0x0a, 0x07, 0x43, 0x6f,
-	0x6e, 0x74, 0x65, 0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x43, 0x6f, 0x6e,
-	0x74, 0x65, 0x6e, 0x74, 0x22, 0x8e, 0x01, 0x0a, 0x0c, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x53,
-	0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12,
-	0x64, 0x0a, 0x04, 0x43, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x50, 0x2e,
+	0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x22, 0x8f, 0x03,
+	0x0a, 0x08, 0x46, 0x69, 0x6c, 0x65, 0x4d, 0x65, 0x74, 0x61, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61,
+	0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x12,
+	0x0a, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x53, 0x69,
+	0x7a, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x4d, 0x6f, 0x64, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x04, 0x4d, 0x6f, 0x64, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x4d, 0x6f, 0x64, 0x54, 0x69, 0x6d,
+	0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x4d, 0x6f, 0x64, 0x54, 0x69, 0x6d, 0x65,
+	0x12, 0x20, 0x0a, 0x0b, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79,
+	0x70, 0x65, 0x12, 0x7f, 0x0a, 0x11, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x41, 0x6c,
+	0x67, 0x6f, 0x72, 0x69, 0x74, 0x68, 0x6d, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x51, 0x2e,
+	0x61, 0x6d, 0x61, 0x7a, 0x69, 0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74,
+	0x6f, 0x6e, 0x5f, 0x64, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78,
+	0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65,
+	0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x43,
+	0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x41, 0x6c, 0x67, 0x6f, 0x72, 0x69, 0x74, 0x68, 0x6d,
+	0x52, 0x11, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x41, 0x6c, 0x67, 0x6f, 0x72, 0x69,
+	0x74, 0x68, 0x6d, 0x12, 0x1c, 0x0a, 0x09, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x49, 0x64,
+	0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x49,
+	0x64, 0x12, 0x16, 0x0a, 0x06, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x06, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x50, 0x61, 0x72,
+	0x74, 0x73, 0x18, 0x09, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x50, 0x61, 0x72, 0x74, 0x73, 0x12,
+	0x16, 0x0a, 0x06, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x06, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x26, 0x0a, 0x0e, 0x44, 0x65, 0x6c, 0x74, 0x61,
+	0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x0e, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x69, 0x7a, 0x65, 0x22,
+	0x29, 0x0a, 0x0b, 0x46, 0x69, 0x6c, 0x65, 0x54, 0x72, 0x61, 0x69, 0x6c, 0x65, 0x72, 0x12, 0x1a,
+	0x0a, 0x08, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x08, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x22, 0x36, 0x0a, 0x08, 0x42, 0x6c,
+	0x6f, 0x63, 0x6b, 0x52, 0x65, 0x66, 0x12, 0x14, 0x0a, 0x05, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x14, 0x0a, 0x05,
+	0x43, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x43, 0x6f, 0x75,
+	0x6e, 0x74, 0x22, 0xda, 0x02, 0x0a, 0x09, 0x46, 0x69, 0x6c, 0x65, 0x43, 0x68, 0x75, 0x6e, 0x6b,
+	0x12, 0x1a, 0x0a, 0x07, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0c, 0x48, 0x00, 0x52, 0x07, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x12, 0x5e, 0x0a, 0x04,
+	0x4d, 0x65, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x48, 0x2e, 0x61, 0x6d, 0x61,
+	0x7a, 0x69, 0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f,
+	0x64, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70,
+	0x6c, 0x65, 0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72,
+	0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x46, 0x69, 0x6c, 0x65,
+	0x4d, 0x65, 0x74, 0x61, 0x48, 0x00, 0x52, 0x04, 0x4d, 0x65, 0x74, 0x61, 0x12, 0x67, 0x0a, 0x07,
+	0x54, 0x72, 0x61, 0x69, 0x6c, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x4b, 0x2e,
+	0x61, 0x6d, 0x61, 0x7a, 0x69, 0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74,
+	0x6f, 0x6e, 0x5f, 0x64, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78,
+	0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65,
+	0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x46,
+	0x69, 0x6c, 0x65, 0x54, 0x72, 0x61, 0x69, 0x6c, 0x65, 0x72, 0x48, 0x00, 0x52, 0x07, 0x54, 0x72,
+	0x61, 0x69, 0x6c, 0x65, 0x72, 0x12, 0x60, 0x0a, 0x05, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x48, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69, 0x6e, 0x67, 0x63, 0x68,
+	0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61, 0x6e, 0x63, 0x65, 0x5f,
+	0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x2e, 0x67, 0x72,
+	0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72,
+	0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x65, 0x66, 0x48, 0x00,
+	0x52, 0x05, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x42, 0x06, 0x0a, 0x04, 0x44, 0x61, 0x74, 0x61, 0x22,
+	0xae, 0x01, 0x0a, 0x0c, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x12, 0x18, 0x0a, 0x07, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x64, 0x0a, 0x04, 0x43, 0x6f,
+	0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x50, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69,
+	0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61,
+	0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65,
+	0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e,
+	0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64,
+	0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x04, 0x43, 0x6f, 0x64, 0x65,
+	0x12, 0x1e, 0x0a, 0x0a, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x49, 0x64, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x49, 0x64,
+	0x22, 0x2d, 0x0a, 0x0d, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f,
+	0x6e, 0x12, 0x1c, 0x0a, 0x09, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x22,
+	0x26, 0x0a, 0x0c, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12,
+	0x16, 0x0a, 0x06, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x06, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x22, 0xc4, 0x01, 0x0a, 0x0f, 0x44, 0x6f, 0x77, 0x6e,
+	0x6c, 0x6f, 0x61, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x4e,
+	0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12,
+	0x1c, 0x0a, 0x09, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x09, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x7f, 0x0a,
+	0x11, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x41, 0x6c, 0x67, 0x6f, 0x72, 0x69, 0x74,
+	0x68, 0x6d, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x51, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69,
+	0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61,
+	0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65,
+	0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e,
+	0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73,
+	0x75, 0x6d, 0x41, 0x6c, 0x67, 0x6f, 0x72, 0x69, 0x74, 0x68, 0x6d, 0x52, 0x11, 0x43, 0x68, 0x65,
+	0x63, 0x6b, 0x73, 0x75, 0x6d, 0x41, 0x6c, 0x67, 0x6f, 0x72, 0x69, 0x74, 0x68, 0x6d, 0x22, 0x84,
+	0x01, 0x0a, 0x0c, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12,
+	0x16, 0x0a, 0x06, 0x53, 0x68, 0x61, 0x32, 0x35, 0x36, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x06, 0x53, 0x68, 0x61, 0x32, 0x35, 0x36, 0x12, 0x5c, 0x0a, 0x04, 0x4d, 0x65, 0x74, 0x61, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x48, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69, 0x6e, 0x67, 0x63,
+	0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61, 0x6e, 0x63, 0x65,
+	0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x2e, 0x67,
+	0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65,
+	0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x4d, 0x65, 0x74, 0x61, 0x52,
+	0x04, 0x4d, 0x65, 0x74, 0x61, 0x22, 0x3f, 0x0a, 0x0d, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74,
+	0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x45, 0x78, 0x69, 0x73, 0x74, 0x73,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x45, 0x78, 0x69, 0x73, 0x74, 0x73, 0x12, 0x16,
+	0x0a, 0x06, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06,
+	0x53, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x22, 0x44, 0x0a, 0x10, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74,
+	0x75, 0x72, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61,
+	0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1c,
+	0x0a, 0x09, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x09, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x69, 0x7a, 0x65, 0x22, 0x3b, 0x0a, 0x0d,
+	0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x12, 0x12, 0x0a,
+	0x04, 0x57, 0x65, 0x61, 0x6b, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x57, 0x65, 0x61,
+	0x6b, 0x12, 0x16, 0x0a, 0x06, 0x53, 0x74, 0x72, 0x6f, 0x6e, 0x67, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x06, 0x53, 0x74, 0x72, 0x6f, 0x6e, 0x67, 0x22, 0xa8, 0x01, 0x0a, 0x0d, 0x46, 0x69,
+	0x6c, 0x65, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x53,
+	0x69, 0x7a, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x12,
+	0x1c, 0x0a, 0x09, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x09, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x65, 0x0a,
+	0x06, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x4d, 0x2e,
 	0x61, 0x6d, 0x61, 0x7a, 0x69, 0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74,
 	0x6f, 0x6e, 0x5f, 0x64, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78,
 	0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65,
-	0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x55,
-	0x70, 0x6c, 0x6f, 0x61, 0x64, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x43, 0x6f, 0x64, 0x65, 0x52,
-	0x04, 0x43, 0x6f, 0x64, 0x65, 0x2a, 0x57, 0x0a, 0x10, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x53,
+	0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x42,
+	0x6c, 0x6f, 0x63, 0x6b, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x52, 0x06, 0x42, 0x6c,
+	0x6f, 0x63, 0x6b, 0x73, 0x2a, 0x8d, 0x01, 0x0a, 0x11, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75,
+	0x6d, 0x41, 0x6c, 0x67, 0x6f, 0x72, 0x69, 0x74, 0x68, 0x6d, 0x12, 0x1b, 0x0a, 0x17, 0x43, 0x48,
+	0x45, 0x43, 0x4b, 0x53, 0x55, 0x4d, 0x5f, 0x41, 0x4c, 0x47, 0x4f, 0x52, 0x49, 0x54, 0x48, 0x4d,
+	0x5f, 0x4e, 0x4f, 0x4e, 0x45, 0x10, 0x00, 0x12, 0x1d, 0x0a, 0x19, 0x43, 0x48, 0x45, 0x43, 0x4b,
+	0x53, 0x55, 0x4d, 0x5f, 0x41, 0x4c, 0x47, 0x4f, 0x52, 0x49, 0x54, 0x48, 0x4d, 0x5f, 0x53, 0x48,
+	0x41, 0x32, 0x35, 0x36, 0x10, 0x01, 0x12, 0x1d, 0x0a, 0x19, 0x43, 0x48, 0x45, 0x43, 0x4b, 0x53,
+	0x55, 0x4d, 0x5f, 0x41, 0x4c, 0x47, 0x4f, 0x52, 0x49, 0x54, 0x48, 0x4d, 0x5f, 0x42, 0x4c, 0x41,
+	0x4b, 0x45, 0x33, 0x10, 0x02, 0x12, 0x1d, 0x0a, 0x19, 0x43, 0x48, 0x45, 0x43, 0x4b, 0x53, 0x55,
+	0x4d, 0x5f, 0x41, 0x4c, 0x47, 0x4f, 0x52, 0x49, 0x54, 0x48, 0x4d, 0x5f, 0x43, 0x52, 0x43, 0x33,
+	0x32, 0x43, 0x10, 0x03, 0x2a, 0xe0, 0x01, 0x0a, 0x10, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x53,
 	0x74, 0x61, 0x74, 0x75, 0x73, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x17, 0x0a, 0x13, 0x53, 0x54, 0x41,
 	0x54, 0x55, 0x53, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e,
 	0x10, 0x00, 0x12, 0x12, 0x0a, 0x0e, 0x53, 0x54, 0x41, 0x54, 0x55, 0x53, 0x5f, 0x43, 0x4f, 0x44,
 	0x45, 0x5f, 0x4f, 0x4b, 0x10, 0x01, 0x12, 0x16, 0x0a, 0x12, 0x53, 0x54, 0x41, 0x54, 0x55, 0x53,
-	0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x46, 0x41, 0x49, 0x4c, 0x45, 0x44, 0x10, 0x02, 0x32, 0xbb,
-	0x01, 0x0a, 0x11, 0x47, 0x72, 0x70, 0x63, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x65, 0x72,
-	0x76, 0x69, 0x63, 0x65, 0x12, 0xa5, 0x01, 0x0a, 0x06, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x12,
-	0x49, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69, 0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68,
-	0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f,
-	0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69,
-	0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c,
-	0x2e, 0x46, 0x69, 0x6c, 0x65, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x1a, 0x4c, 0x2e, 0x61, 0x6d, 0x61,
+	0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x46, 0x41, 0x49, 0x4c, 0x45, 0x44, 0x10, 0x02, 0x12, 0x21,
+	0x0a, 0x1d, 0x53, 0x54, 0x41, 0x54, 0x55, 0x53, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x43, 0x48,
+	0x45, 0x43, 0x4b, 0x53, 0x55, 0x4d, 0x5f, 0x4d, 0x49, 0x53, 0x4d, 0x41, 0x54, 0x43, 0x48, 0x10,
+	0x03, 0x12, 0x1e, 0x0a, 0x1a, 0x53, 0x54, 0x41, 0x54, 0x55, 0x53, 0x5f, 0x43, 0x4f, 0x44, 0x45,
+	0x5f, 0x46, 0x49, 0x4c, 0x45, 0x5f, 0x54, 0x4f, 0x4f, 0x5f, 0x4c, 0x41, 0x52, 0x47, 0x45, 0x10,
+	0x04, 0x12, 0x1e, 0x0a, 0x1a, 0x53, 0x54, 0x41, 0x54, 0x55, 0x53, 0x5f, 0x43, 0x4f, 0x44, 0x45,
+	0x5f, 0x51, 0x55, 0x4f, 0x54, 0x41, 0x5f, 0x45, 0x58, 0x43, 0x45, 0x45, 0x44, 0x45, 0x44, 0x10,
+	0x05, 0x12, 0x24, 0x0a, 0x20, 0x53, 0x54, 0x41, 0x54, 0x55, 0x53, 0x5f, 0x43, 0x4f, 0x44, 0x45,
+	0x5f, 0x49, 0x4e, 0x53, 0x55, 0x46, 0x46, 0x49, 0x43, 0x49, 0x45, 0x4e, 0x54, 0x5f, 0x53, 0x54,
+	0x4f, 0x52, 0x41, 0x47, 0x45, 0x10, 0x06, 0x32, 0xff, 0x06, 0x0a, 0x11, 0x47, 0x72, 0x70, 0x63,
+	0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0xa5, 0x01,
+	0x0a, 0x06, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x49, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69,
+	0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61,
+	0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65,
+	0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e,
+	0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x43, 0x68,
+	0x75, 0x6e, 0x6b, 0x1a, 0x4c, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69, 0x6e, 0x67, 0x63, 0x68, 0x6f,
+	0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x67,
+	0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x2e, 0x67, 0x72, 0x70,
+	0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x5f,
+	0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x53, 0x74, 0x61, 0x74, 0x75,
+	0x73, 0x22, 0x00, 0x28, 0x01, 0x12, 0xb2, 0x01, 0x0a, 0x11, 0x51, 0x75, 0x65, 0x72, 0x79, 0x55,
+	0x70, 0x6c, 0x6f, 0x61, 0x64, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x4d, 0x2e, 0x61, 0x6d,
+	0x61, 0x7a, 0x69, 0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e,
+	0x5f, 0x64, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d,
+	0x70, 0x6c, 0x65, 0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74,
+	0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x55, 0x70, 0x6c,
+	0x6f, 0x61, 0x64, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x1a, 0x4c, 0x2e, 0x61, 0x6d, 0x61,
 	0x7a, 0x69, 0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f,
 	0x64, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70,
 	0x6c, 0x65, 0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72,
 	0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x55, 0x70, 0x6c, 0x6f,
-	0x61, 0x64, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x22, 0x00, 0x28, 0x01, 0x42, 0x4f, 0x5a, 0x4d,
-	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x6d, 0x61, 0x7a, 0x69,
-	0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2f, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x2d, 0x64, 0x61,
-	0x6e, 0x63, 0x65, 0x2d, 0x67, 0x72, 0x70, 0x63, 0x2d, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65,
-	0x73, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2d, 0x66, 0x69, 0x6c, 0x65, 0x2d, 0x74, 0x72, 0x61, 0x6e,
-	0x73, 0x66, 0x65, 0x72, 0x2d, 0x74, 0x6f, 0x6f, 0x6c, 0x2f, 0x61, 0x70, 0x69, 0x62, 0x06, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x61, 0x64, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x22, 0x00, 0x12, 0xaa, 0x01, 0x0a, 0x08, 0x44,
+	0x6f, 0x77, 0x6e, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x4f, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69, 0x6e,
+	0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61, 0x6e,
+	0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73,
+	0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73,
+	0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x44, 0x6f, 0x77, 0x6e, 0x6c, 0x6f, 0x61,
+	0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x49, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69,
+	0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61,
+	0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65,
+	0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e,
+	0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x43, 0x68,
+	0x75, 0x6e, 0x6b, 0x22, 0x00, 0x30, 0x01, 0x12, 0xab, 0x01, 0x0a, 0x0a, 0x48, 0x61, 0x73, 0x43,
+	0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x12, 0x4c, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69, 0x6e, 0x67,
+	0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61, 0x6e, 0x63,
+	0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x2e,
+	0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66,
+	0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x51,
+	0x75, 0x65, 0x72, 0x79, 0x1a, 0x4d, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69, 0x6e, 0x67, 0x63, 0x68,
+	0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61, 0x6e, 0x63, 0x65, 0x5f,
+	0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x2e, 0x67, 0x72,
+	0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72,
+	0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x53, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x22, 0x00, 0x12, 0xb1, 0x01, 0x0a, 0x0c, 0x47, 0x65, 0x74, 0x53, 0x69, 0x67,
+	0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x12, 0x50, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69, 0x6e, 0x67,
+	0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61, 0x6e, 0x63,
+	0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x2e,
+	0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66,
+	0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72,
+	0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x4d, 0x2e, 0x61, 0x6d, 0x61, 0x7a, 0x69,
+	0x6e, 0x67, 0x63, 0x68, 0x6f, 0x77, 0x2e, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x6e, 0x5f, 0x64, 0x61,
+	0x6e, 0x63, 0x65, 0x5f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65,
+	0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e,
+	0x73, 0x66, 0x65, 0x72, 0x5f, 0x74, 0x6f, 0x6f, 0x6c, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x53, 0x69,
+	0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x22, 0x00, 0x42, 0x44, 0x5a, 0x42, 0x67, 0x69, 0x74,
+	0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x6d, 0x61, 0x7a, 0x69, 0x6e, 0x67, 0x63,
+	0x68, 0x6f, 0x77, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2d, 0x70, 0x6c, 0x61, 0x79, 0x67, 0x72, 0x6f,
+	0x75, 0x6e, 0x64, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2d, 0x66, 0x69, 0x6c, 0x65, 0x2d, 0x74, 0x72,
+	0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x2d, 0x74, 0x6f, 0x6f, 0x6c, 0x2f, 0x61, 0x70, 0x69, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -242,22 +1237,49 @@ func file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_t
 	return file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDescData
 }
 
-var file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_goTypes = []interface{}{
-	(UploadStatusCode)(0), // 0: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadStatusCode
-	(*FileChunk)(nil),     // 1: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileChunk
-	(*UploadStatus)(nil),  // 2: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadStatus
+	(ChecksumAlgorithm)(0),   // 0: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.ChecksumAlgorithm
+	(UploadStatusCode)(0),    // 1: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadStatusCode
+	(*FileMeta)(nil),         // 2: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileMeta
+	(*FileTrailer)(nil),      // 3: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileTrailer
+	(*BlockRef)(nil),         // 4: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.BlockRef
+	(*FileChunk)(nil),        // 5: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileChunk
+	(*UploadStatus)(nil),     // 6: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadStatus
+	(*UploadSession)(nil),    // 7: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadSession
+	(*UploadOffset)(nil),     // 8: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadOffset
+	(*DownloadRequest)(nil),  // 9: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.DownloadRequest
+	(*ContentQuery)(nil),     // 10: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.ContentQuery
+	(*ContentStatus)(nil),    // 11: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.ContentStatus
+	(*SignatureRequest)(nil), // 12: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.SignatureRequest
+	(*BlockChecksum)(nil),    // 13: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.BlockChecksum
+	(*FileSignature)(nil),    // 14: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileSignature
 }
 var file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_depIdxs = []int32{
-	0, // 0: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadStatus.Code:type_name -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadStatusCode
-	1, // 1: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService.Upload:input_type -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileChunk
-	2, // 2: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService.Upload:output_type -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadStatus
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	0,  // 0: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileMeta.ChecksumAlgorithm:type_name -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.ChecksumAlgorithm
+	2,  // 1: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileChunk.Meta:type_name -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileMeta
+	3,  // 2: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileChunk.Trailer:type_name -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileTrailer
+	4,  // 3: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileChunk.Block:type_name -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.BlockRef
+	1,  // 4: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadStatus.Code:type_name -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadStatusCode
+	0,  // 5: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.DownloadRequest.ChecksumAlgorithm:type_name -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.ChecksumAlgorithm
+	2,  // 6: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.ContentQuery.Meta:type_name -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileMeta
+	13, // 7: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileSignature.Blocks:type_name -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.BlockChecksum
+	5,  // 8: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService.Upload:input_type -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileChunk
+	7,  // 9: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService.QueryUploadOffset:input_type -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadSession
+	9,  // 10: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService.Download:input_type -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.DownloadRequest
+	10, // 11: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService.HasContent:input_type -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.ContentQuery
+	12, // 12: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService.GetSignature:input_type -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.SignatureRequest
+	6,  // 13: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService.Upload:output_type -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadStatus
+	8,  // 14: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService.QueryUploadOffset:output_type -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.UploadOffset
+	5,  // 15: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService.Download:output_type -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileChunk
+	11, // 16: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService.HasContent:output_type -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.ContentStatus
+	14, // 17: amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService.GetSignature:output_type -> amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.FileSignature
+	13, // [13:18] is the sub-list for method output_type
+	8,  // [8:13] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
 }
 
 func init() {
@@ -269,7 +1291,7 @@ func file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_t
 	}
 	if !protoimpl.UnsafeEnabled {
 		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*FileChunk); i {
+			switch v := v.(*FileMeta); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -281,6 +1303,42 @@ func file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_t
 			}
 		}
 		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FileTrailer); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BlockRef); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FileChunk); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*UploadStatus); i {
 			case 0:
 				return &v.state
@@ -292,14 +1350,116 @@ func file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_t
 				return nil
 			}
 		}
+		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*UploadSession); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*UploadOffset); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DownloadRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ContentQuery); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ContentStatus); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SignatureRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BlockChecksum); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FileSignature); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_msgTypes[3].OneofWrappers = []interface{}{
+		(*FileChunk_Content)(nil),
+		(*FileChunk_Meta)(nil),
+		(*FileChunk_Trailer)(nil),
+		(*FileChunk_Block)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto_rawDesc,
-			NumEnums:      1,
-			NumMessages:   2,
+			NumEnums:      2,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -327,6 +1487,12 @@ const _ = grpc.SupportPackageIsVersion6
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type GrpcStreamServiceClient interface {
 	Upload(ctx context.Context, opts ...grpc.CallOption) (GrpcStreamService_UploadClient, error)
+	QueryUploadOffset(ctx context.Context, in *UploadSession, opts ...grpc.CallOption) (*UploadOffset, error)
+	Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (GrpcStreamService_DownloadClient, error)
+	// HasContent is only implemented by servers running with content addressed storage.
+	HasContent(ctx context.Context, in *ContentQuery, opts ...grpc.CallOption) (*ContentStatus, error)
+	// GetSignature returns the block checksums of the server's copy of a file, used to prepare a delta upload.
+	GetSignature(ctx context.Context, in *SignatureRequest, opts ...grpc.CallOption) (*FileSignature, error)
 }
 
 type grpcStreamServiceClient struct {
@@ -371,9 +1537,74 @@ func (x *grpcStreamServiceUploadClient) CloseAndRecv() (*UploadStatus, error) {
 	return m, nil
 }
 
+func (c *grpcStreamServiceClient) QueryUploadOffset(ctx context.Context, in *UploadSession, opts ...grpc.CallOption) (*UploadOffset, error) {
+	out := new(UploadOffset)
+	err := c.cc.Invoke(ctx, "/amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService/QueryUploadOffset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *grpcStreamServiceClient) Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (GrpcStreamService_DownloadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_GrpcStreamService_serviceDesc.Streams[1], "/amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService/Download", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpcStreamServiceDownloadClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GrpcStreamService_DownloadClient interface {
+	Recv() (*FileChunk, error)
+	grpc.ClientStream
+}
+
+type grpcStreamServiceDownloadClient struct {
+	grpc.ClientStream
+}
+
+func (x *grpcStreamServiceDownloadClient) Recv() (*FileChunk, error) {
+	m := new(FileChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *grpcStreamServiceClient) HasContent(ctx context.Context, in *ContentQuery, opts ...grpc.CallOption) (*ContentStatus, error) {
+	out := new(ContentStatus)
+	err := c.cc.Invoke(ctx, "/amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService/HasContent", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *grpcStreamServiceClient) GetSignature(ctx context.Context, in *SignatureRequest, opts ...grpc.CallOption) (*FileSignature, error) {
+	out := new(FileSignature)
+	err := c.cc.Invoke(ctx, "/amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService/GetSignature", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // GrpcStreamServiceServer is the server API for GrpcStreamService service.
 type GrpcStreamServiceServer interface {
 	Upload(GrpcStreamService_UploadServer) error
+	QueryUploadOffset(context.Context, *UploadSession) (*UploadOffset, error)
+	Download(*DownloadRequest, GrpcStreamService_DownloadServer) error
+	// HasContent is only implemented by servers running with content addressed storage.
+	HasContent(context.Context, *ContentQuery) (*ContentStatus, error)
+	// GetSignature returns the block checksums of the server's copy of a file, used to prepare a delta upload.
+	GetSignature(context.Context, *SignatureRequest) (*FileSignature, error)
 }
 
 // UnimplementedGrpcStreamServiceServer can be embedded to have forward compatible implementations.
@@ -383,6 +1614,18 @@ type UnimplementedGrpcStreamServiceServer struct {
 func (*UnimplementedGrpcStreamServiceServer) Upload(GrpcStreamService_UploadServer) error {
 	return status.Errorf(codes.Unimplemented, "method Upload not implemented")
 }
+func (*UnimplementedGrpcStreamServiceServer) QueryUploadOffset(context.Context, *UploadSession) (*UploadOffset, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryUploadOffset not implemented")
+}
+func (*UnimplementedGrpcStreamServiceServer) Download(*DownloadRequest, GrpcStreamService_DownloadServer) error {
+	return status.Errorf(codes.Unimplemented, "method Download not implemented")
+}
+func (*UnimplementedGrpcStreamServiceServer) HasContent(context.Context, *ContentQuery) (*ContentStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HasContent not implemented")
+}
+func (*UnimplementedGrpcStreamServiceServer) GetSignature(context.Context, *SignatureRequest) (*FileSignature, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSignature not implemented")
+}
 
 func RegisterGrpcStreamServiceServer(s *grpc.Server, srv GrpcStreamServiceServer) {
 	s.RegisterService(&_GrpcStreamService_serviceDesc, srv)
@@ -414,16 +1657,109 @@ func (x *grpcStreamServiceUploadServer) Recv() (*FileChunk, error) {
 	return m, nil
 }
 
+func _GrpcStreamService_QueryUploadOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UploadSession)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GrpcStreamServiceServer).QueryUploadOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService/QueryUploadOffset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GrpcStreamServiceServer).QueryUploadOffset(ctx, req.(*UploadSession))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GrpcStreamService_Download_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GrpcStreamServiceServer).Download(m, &grpcStreamServiceDownloadServer{stream})
+}
+
+type GrpcStreamService_DownloadServer interface {
+	Send(*FileChunk) error
+	grpc.ServerStream
+}
+
+type grpcStreamServiceDownloadServer struct {
+	grpc.ServerStream
+}
+
+func (x *grpcStreamServiceDownloadServer) Send(m *FileChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _GrpcStreamService_HasContent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ContentQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GrpcStreamServiceServer).HasContent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService/HasContent",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GrpcStreamServiceServer).HasContent(ctx, req.(*ContentQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GrpcStreamService_GetSignature_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignatureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GrpcStreamServiceServer).GetSignature(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService/GetSignature",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GrpcStreamServiceServer).GetSignature(ctx, req.(*SignatureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _GrpcStreamService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService",
 	HandlerType: (*GrpcStreamServiceServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "QueryUploadOffset",
+			Handler:    _GrpcStreamService_QueryUploadOffset_Handler,
+		},
+		{
+			MethodName: "HasContent",
+			Handler:    _GrpcStreamService_HasContent_Handler,
+		},
+		{
+			MethodName: "GetSignature",
+			Handler:    _GrpcStreamService_GetSignature_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "Upload",
 			Handler:       _GrpcStreamService_Upload_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Download",
+			Handler:       _GrpcStreamService_Download_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/pb/messages.proto",
 }
@@ -0,0 +1,57 @@
+# -*- coding: utf-8 -*-
+import glob
+import re
+
+import matplotlib.pyplot as plt
+import numpy as np
+
+STREAMS = (1, 2, 4, 8, 16)
+
+
+def average_secs(outputs):
+    _sum = 0.0
+    for output in outputs:
+        fd = open(output)
+        line = fd.readline()
+        fd.close()
+        ret = re.match(r'used (.*?) secs', line)
+        _sum += float(ret.group(1).strip())
+    return _sum / float(len(outputs))
+
+
+def plot(secs_array):
+    # 创建一个点数为 8 x 6 的窗口, 并设置分辨率为 80 像素/每英寸
+    plt.figure(figsize=(8, 6), dpi=80)
+    # 再创建一个规格为 1 x 1 的子图
+    plt.subplot(1, 1, 1)
+    # 包含每个柱子下标的序列
+    indexes = np.arange(len(STREAMS))
+    # 包含每个柱子对应值的序列, 测试文件大小为 4G, 换算为吞吐量 (MB/s)
+    values = 4096.0 / np.asarray(secs_array, dtype=np.float32)
+    # 柱子的宽度
+    width = 0.50
+    # 绘制柱状图
+    plt.bar(indexes, values, width, label="throughput", color="#87CEFA")
+    # 添加数据标签
+    for a, b in zip(indexes, values):
+        plt.text(a, b + 0.05, '%.2f' % b, ha='center', va='bottom', fontsize=10)
+    # 设置横轴标签
+    plt.xlabel('concurrent streams')
+    # 设置纵轴标签
+    plt.ylabel('throughput (MB/s)')
+    # 添加标题
+    plt.title('throughput of uploading a 4G file when the number of streams changed')
+    # 添加纵横轴的刻度
+    plt.xticks(indexes, [str(n) for n in STREAMS])
+    # 添加图例
+    plt.legend(loc="upper left")
+    plt.show()
+
+
+if __name__ == "__main__":
+    secs_array = []
+    for streams in STREAMS:
+        outputs = glob.glob("output_streams_*_{}.log".format(streams))
+        secs = average_secs(outputs)
+        secs_array.append(secs)
+    plot(secs_array)
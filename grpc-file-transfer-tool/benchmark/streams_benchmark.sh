@@ -0,0 +1,18 @@
+#!/bin/bash
+
+run () {
+    # number of concurrent streams in "1 (single stream), 2, 4, 8, 16"
+    for streams in 1 2 4 8 16; do
+        for iter in $(seq 1 10); do
+            upload "$iter" "$streams"
+        done
+    done
+}
+
+upload () {
+    iter=$1
+    streams=$2
+    ../../file-transfer-client upload --addr=127.0.0.1:8999 --chunk=262144 --compressed=false --cert=../cert/cert.pem --resume=false --streams=$streams --file=../fixtures/4G.txt 2>&1 | tee output_streams_$(($iter))_$(($streams)).log
+}
+
+run
@@ -0,0 +1,45 @@
+package common
+
+import (
+	"crypto/sha256"
+	"hash"
+	"hash/crc32"
+	"strings"
+
+	"github.com/pkg/errors"
+	"lukechampine.com/blake3"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+// ParseChecksumAlgorithm 将命令行参数解析为校验算法, 支持 sha256/blake3/crc32c/none.
+func ParseChecksumAlgorithm(name string) (api.ChecksumAlgorithm, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE, nil
+	case "sha256":
+		return api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256, nil
+	case "blake3":
+		return api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_BLAKE3, nil
+	case "crc32c":
+		return api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_CRC32C, nil
+	default:
+		return api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE, errors.Errorf("unsupported checksum algorithm '%s'", name)
+	}
+}
+
+// NewChecksum 返回校验算法对应的哈希实例, 算法为NONE时返回nil.
+func NewChecksum(algo api.ChecksumAlgorithm) (hash.Hash, error) {
+	switch algo {
+	case api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE:
+		return nil, nil
+	case api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256:
+		return sha256.New(), nil
+	case api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_BLAKE3:
+		return blake3.New(32, nil), nil
+	case api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_CRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	default:
+		return nil, errors.Errorf("unsupported checksum algorithm %s", algo)
+	}
+}
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+func TestParseChecksumAlgorithm(t *testing.T) {
+	tests := []struct {
+		in   string
+		want api.ChecksumAlgorithm
+		ok   bool
+	}{
+		{"", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE, true},
+		{"none", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE, true},
+		{"sha256", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256, true},
+		{"SHA256", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256, true},
+		{"blake3", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_BLAKE3, true},
+		{"crc32c", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_CRC32C, true},
+		{"crc32", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE, false},
+		{"md5", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseChecksumAlgorithm(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseChecksumAlgorithm(%q) = %v, %v, want %v, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNewChecksum(t *testing.T) {
+	tests := []struct {
+		algo api.ChecksumAlgorithm
+		// want "hello"的校验和, 为空时期望不计算校验和
+		want string
+		ok   bool
+	}{
+		{api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE, "", true},
+		{api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", true},
+		{api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_BLAKE3, "ea8f163db38682925e4491c5e58d4bb3506ef8c14eb78a86e908c5624a67200f", true},
+		{api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_CRC32C, "9a71bb4c", true},
+		{api.ChecksumAlgorithm(100), "", false},
+	}
+	for _, tt := range tests {
+		h, err := NewChecksum(tt.algo)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewChecksum(%v) returned error %v, want ok %v", tt.algo, err, tt.ok)
+			continue
+		}
+		if h == nil {
+			if tt.want != "" {
+				t.Errorf("NewChecksum(%v) returned no hash", tt.algo)
+			}
+			continue
+		}
+		h.Write([]byte("hello")) // nolint
+		if got := hex.EncodeToString(h.Sum(nil)); got != tt.want {
+			t.Errorf("%v of \"hello\" = %s, want %s", tt.algo, got, tt.want)
+		}
+	}
+}
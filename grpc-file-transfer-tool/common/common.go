@@ -1,10 +1,79 @@
 package common
 
 import (
+	"sync/atomic"
 	"time"
 )
 
+const (
+	// MaxChunkSize 单次发送的最大分块大小
+	MaxChunkSize = 1 << 22
+	// RetryAfterKey 服务端繁忙拒绝请求时, 在trailer中告知客户端多少秒后重试的metadata键
+	RetryAfterKey = "retry-after"
+	// TransferIDKey 客户端为每次传输生成的ID所在的metadata键, 服务端在日志和上传结果中原样返回
+	TransferIDKey = "x-transfer-id"
+)
+
+// Stats 单个文件的传输统计
 type Stats struct {
 	StartedAt  time.Time
 	FinishedAt time.Time
+	// BytesSent 本次发送的文件内容字节数, 续传时不包含服务端已有的部分
+	BytesSent int64
+	// BytesDeduplicated 服务端已有相同内容而跳过上传的字节数
+	BytesDeduplicated int64
+	// BytesSaved 增量同步时引用服务端已有分块而不需要发送的字节数
+	BytesSaved int64
+	// Chunks 本次发送的分块数
+	Chunks int64
+	// WireBytes 经压缩和编码后实际写到连接上的字节数
+	WireBytes int64
+	// ChunkLatency 每个分块调用Send的耗时分布
+	ChunkLatency Histogram
+	// TimeToAck 发送完最后一个分块到收到服务端确认的耗时, 包含服务端落盘和提交文件的时间
+	TimeToAck time.Duration
+	// Attempts 上传尝试的次数, 包括失败后的重试
+	Attempts int
+	// TransferID 本次传输的ID, 与服务端日志中的transfer_id对应
+	TransferID string
+}
+
+// RecordChunk 记录一个分块的发送.
+func (s *Stats) RecordChunk(n int, latency time.Duration) {
+	atomic.AddInt64(&s.BytesSent, int64(n))
+	atomic.AddInt64(&s.Chunks, 1)
+	s.ChunkLatency.Observe(latency)
+}
+
+// AddWireBytes 累加实际写到连接上的字节数.
+func (s *Stats) AddWireBytes(n int) {
+	atomic.AddInt64(&s.WireBytes, int64(n))
+}
+
+// Merge 合并并发流的统计, 用于多流上传.
+func (s *Stats) Merge(o *Stats) {
+	atomic.AddInt64(&s.BytesSent, atomic.LoadInt64(&o.BytesSent))
+	atomic.AddInt64(&s.Chunks, atomic.LoadInt64(&o.Chunks))
+	atomic.AddInt64(&s.WireBytes, atomic.LoadInt64(&o.WireBytes))
+	s.ChunkLatency.Merge(&o.ChunkLatency)
+	if o.TimeToAck > s.TimeToAck {
+		s.TimeToAck = o.TimeToAck
+	}
+}
+
+// Duration 返回传输耗时.
+func (s *Stats) Duration() time.Duration {
+	return s.FinishedAt.Sub(s.StartedAt)
+}
+
+// Summary 批量传输的汇总统计
+type Summary struct {
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Files      int
+	Succeeded  int
+	Bytes      int64
+	// Attempts 成功上传的文件一共尝试的次数
+	Attempts int
+	Failures map[string]error
 }
@@ -0,0 +1,332 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+const (
+	// MinDeltaBlockSize 增量上传的最小分块大小
+	MinDeltaBlockSize = 1 << 10
+	// MaxDeltaBlocks 文件签名最多包含的分块数, 更大的文件使用更大的分块, 使签名不超过gRPC默认的4MB消息上限
+	MaxDeltaBlocks = 1 << 16
+	// StrongChecksumSize 分块强校验和的字节数
+	StrongChecksumSize = 16
+)
+
+// DeltaBlockSize 返回计算size字节文件的签名时使用的分块大小, requested为0时取文件大小的平方根.
+func DeltaBlockSize(size int64, requested int) int {
+	bs := int64(requested)
+	if bs <= 0 {
+		bs = int64(math.Sqrt(float64(size)))
+	}
+	if min := (size + MaxDeltaBlocks - 1) / MaxDeltaBlocks; bs < min {
+		bs = min
+	}
+	if bs < MinDeltaBlockSize {
+		bs = MinDeltaBlockSize
+	}
+	if bs > MaxChunkSize {
+		bs = MaxChunkSize
+	}
+	return int(bs)
+}
+
+// RollingChecksum rsync的弱校验和, 窗口每向后滑动一个字节都可以在常数时间内更新.
+type RollingChecksum struct {
+	a, b uint32
+	n    uint32
+}
+
+// NewRollingChecksum 返回覆盖window的RollingChecksum.
+func NewRollingChecksum(window []byte) *RollingChecksum {
+	r := &RollingChecksum{n: uint32(len(window))}
+	for i, c := range window {
+		r.a += uint32(c)
+		r.b += uint32(len(window)-i) * uint32(c)
+	}
+	return r
+}
+
+// Roll 把窗口向后滑动一个字节, out是移出窗口的字节, in是移入窗口的字节.
+func (r *RollingChecksum) Roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.n*uint32(out)
+}
+
+// Sum 返回当前窗口的校验和.
+func (r *RollingChecksum) Sum() uint32 {
+	return r.a&0xffff | r.b<<16
+}
+
+// StrongChecksum 返回分块的强校验和.
+func StrongChecksum(block []byte) []byte {
+	sum := sha256.Sum256(block)
+	return sum[:StrongChecksumSize]
+}
+
+// ComputeSignature 按blockSize分块读取r, 返回每个分块的校验和.
+func ComputeSignature(r io.Reader, size int64, blockSize int) (*api.FileSignature, error) {
+	sig := &api.FileSignature{
+		Size:      size,
+		BlockSize: int32(blockSize),
+		Blocks:    make([]*api.BlockChecksum, 0, (size+int64(blockSize)-1)/int64(blockSize)),
+	}
+	var (
+		buffer = make([]byte, blockSize)
+		total  int64
+	)
+	for {
+		n, err := io.ReadFull(r, buffer)
+		if n > 0 {
+			sig.Blocks = append(sig.Blocks, &api.BlockChecksum{
+				Weak:   NewRollingChecksum(buffer[:n]).Sum(),
+				Strong: StrongChecksum(buffer[:n]),
+			})
+			total += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read blocks")
+		}
+	}
+	if total != size {
+		return nil, errors.Errorf("read %d bytes, but the file has %d bytes", total, size)
+	}
+	return sig, nil
+}
+
+// DeltaEncoder 用rsync算法在本地文件中寻找与服务端分块相同的内容, 把本地文件编码为原始数据和对服务端分块的引用.
+type DeltaEncoder struct {
+	blockSize int
+	chunkSize int
+	size      int64
+	blocks    []*api.BlockChecksum
+	// weak 按弱校验和索引的完整分块, 长度不足blockSize的最后一个分块单独处理
+	weak map[uint32][]int64
+	// tags 弱校验和的16位摘要, 避免为每个字节查询map
+	tags []bool
+	// pending 尚未发送的引用, pendingBytes为它覆盖的字节数
+	pending      *api.BlockRef
+	pendingBytes int64
+
+	// SendLiteral 发送原始数据
+	SendLiteral func(p []byte) error
+	// SendBlocks 发送连续分块的引用, n为这些分块的总字节数
+	SendBlocks func(ref *api.BlockRef, n int64) error
+}
+
+// NewDeltaEncoder 返回基于服务端签名sig编码的DeltaEncoder实例, 原始数据按chunkSize拆分发送.
+func NewDeltaEncoder(sig *api.FileSignature, chunkSize int) *DeltaEncoder {
+	e := &DeltaEncoder{
+		blockSize: int(sig.GetBlockSize()),
+		chunkSize: chunkSize,
+		size:      sig.GetSize(),
+		blocks:    sig.GetBlocks(),
+		weak:      make(map[uint32][]int64, len(sig.GetBlocks())),
+		tags:      make([]bool, 1<<16),
+	}
+	for i, block := range e.blocks {
+		if int64(i+1)*int64(e.blockSize) > e.size {
+			break
+		}
+		e.weak[block.GetWeak()] = append(e.weak[block.GetWeak()], int64(i))
+		e.tags[weakTag(block.GetWeak())] = true
+	}
+	return e
+}
+
+func weakTag(sum uint32) uint16 {
+	return uint16(sum) ^ uint16(sum>>16)
+}
+
+// match 返回与window内容相同的完整分块, 优先选择紧接着上一个引用的分块以便合并引用.
+func (e *DeltaEncoder) match(sum uint32, window []byte) (int64, bool) {
+	if !e.tags[weakTag(sum)] {
+		return 0, false
+	}
+	candidates, ok := e.weak[sum]
+	if !ok {
+		return 0, false
+	}
+	strong := StrongChecksum(window)
+	if e.pending != nil {
+		if next := e.pending.Index + e.pending.Count; next < int64(len(e.blocks)) &&
+			e.blocks[next].GetWeak() == sum && bytes.Equal(e.blocks[next].GetStrong(), strong) {
+			return next, true
+		}
+	}
+	for _, idx := range candidates {
+		if bytes.Equal(e.blocks[idx].GetStrong(), strong) {
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+// matchTail 判断文件末尾不足一个分块的内容是否与服务端最后一个分块相同.
+func (e *DeltaEncoder) matchTail(tail []byte) (int64, bool) {
+	last := int64(len(e.blocks)) - 1
+	if last < 0 || e.size-last*int64(e.blockSize) != int64(len(tail)) {
+		return 0, false
+	}
+	if e.blocks[last].GetWeak() != NewRollingChecksum(tail).Sum() || !bytes.Equal(e.blocks[last].GetStrong(), StrongChecksum(tail)) {
+		return 0, false
+	}
+	return last, true
+}
+
+// ref 引用n字节的分块index, 与上一个引用连续时合并为一个引用.
+func (e *DeltaEncoder) ref(index int64, n int64) error {
+	if e.pending == nil || e.pending.Index+e.pending.Count != index {
+		if err := e.flushRef(); err != nil {
+			return err
+		}
+		e.pending = &api.BlockRef{Index: index}
+	}
+	e.pending.Count++
+	e.pendingBytes += n
+	return nil
+}
+
+func (e *DeltaEncoder) flushRef() error {
+	if e.pending == nil {
+		return nil
+	}
+	ref, n := e.pending, e.pendingBytes
+	e.pending, e.pendingBytes = nil, 0
+	return e.SendBlocks(ref, n)
+}
+
+// literal 按分块大小发送原始数据.
+func (e *DeltaEncoder) literal(p []byte) error {
+	if err := e.flushRef(); err != nil {
+		return err
+	}
+	for len(p) > 0 {
+		n := len(p)
+		if n > e.chunkSize {
+			n = e.chunkSize
+		}
+		if err := e.SendLiteral(p[:n]); err != nil {
+			return err
+		}
+		p = p[n:]
+	}
+	return nil
+}
+
+// Encode 读取r并发送编码结果, 同时用h计算整个文件的校验和.
+func (e *DeltaEncoder) Encode(r io.Reader, h hash.Hash) error {
+	var (
+		bs      = e.blockSize
+		buf     = make([]byte, 0, 2*(e.chunkSize+bs)+(1<<20))
+		pos     int // start of the window
+		lit     int // start of the literal data not sent yet
+		eof     bool
+		rolling *RollingChecksum
+	)
+	fill := func() error {
+		// keep the unsent literal data, it must go out in one piece
+		n := copy(buf[:cap(buf)], buf[lit:])
+		buf = buf[:n]
+		pos -= lit
+		lit = 0
+		for len(buf) < cap(buf) && !eof {
+			m, err := r.Read(buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+m]
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return errors.Wrap(err, "failed unexpectedly while reading file")
+			}
+		}
+		return nil
+	}
+	flushLiteral := func() error {
+		if pos == lit {
+			return nil
+		}
+		if h != nil {
+			h.Write(buf[lit:pos]) // nolint
+		}
+		err := e.literal(buf[lit:pos])
+		lit = pos
+		return err
+	}
+
+ENCODE_LOOP:
+	for {
+		// the window and the byte rolling into it must be in the buffer
+		if len(buf)-pos <= bs && !eof {
+			if err := fill(); err != nil {
+				return err
+			}
+		}
+		if len(buf)-pos < bs {
+			break ENCODE_LOOP
+		}
+
+		window := buf[pos : pos+bs]
+		if rolling == nil {
+			rolling = NewRollingChecksum(window)
+		}
+		if idx, ok := e.match(rolling.Sum(), window); ok {
+			if err := flushLiteral(); err != nil {
+				return err
+			}
+			if h != nil {
+				h.Write(window) // nolint
+			}
+			if err := e.ref(idx, int64(bs)); err != nil {
+				return err
+			}
+			pos += bs
+			lit = pos
+			rolling = nil
+			continue
+		}
+
+		if pos-lit >= e.chunkSize {
+			if err := flushLiteral(); err != nil {
+				return err
+			}
+		}
+		if pos+bs < len(buf) {
+			rolling.Roll(buf[pos], buf[pos+bs])
+		} else {
+			rolling = nil
+		}
+		pos++
+	}
+
+	if tail := buf[pos:]; len(tail) > 0 {
+		if idx, ok := e.matchTail(tail); ok {
+			if err := flushLiteral(); err != nil {
+				return err
+			}
+			if h != nil {
+				h.Write(tail) // nolint
+			}
+			if err := e.ref(idx, int64(len(tail))); err != nil {
+				return err
+			}
+			pos += len(tail)
+			lit = pos
+		}
+	}
+	pos = len(buf)
+	if err := flushLiteral(); err != nil {
+		return err
+	}
+	return e.flushRef()
+}
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestRollingChecksumRoll(t *testing.T) {
+	data := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(data)
+	// long runs of 0xff make a and b wrap around
+	for i := 1000; i < 2000; i++ {
+		data[i] = 0xff
+	}
+
+	for _, window := range []int{1, 2, 7, 1024, 3000} {
+		rolling := NewRollingChecksum(data[:window])
+		for pos := 1; pos+window <= len(data); pos++ {
+			rolling.Roll(data[pos-1], data[pos+window-1])
+			if got, want := rolling.Sum(), NewRollingChecksum(data[pos:pos+window]).Sum(); got != want {
+				t.Fatalf("window %d at %d: rolled sum %08x, want %08x", window, pos, got, want)
+			}
+		}
+	}
+}
+
+func TestDeltaBlockSize(t *testing.T) {
+	tests := []struct {
+		size      int64
+		requested int
+		want      int
+	}{
+		{0, 0, MinDeltaBlockSize},
+		{100, 0, MinDeltaBlockSize},
+		{4 << 20, 0, 2048},
+		{4 << 20, 4096, 4096},
+		{4 << 20, 10, MinDeltaBlockSize},
+		// at most MaxDeltaBlocks blocks
+		{1 << 40, 0, MaxChunkSize},
+		{(1 << 30) + 1, 1024, 16385},
+		{1 << 20, MaxChunkSize + 1, MaxChunkSize},
+	}
+	for _, tt := range tests {
+		if got := DeltaBlockSize(tt.size, tt.requested); got != tt.want {
+			t.Errorf("DeltaBlockSize(%d, %d) = %d, want %d", tt.size, tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestComputeSignature(t *testing.T) {
+	data := make([]byte, 2500)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	tests := []struct {
+		name   string
+		size   int
+		blocks int
+	}{
+		{"empty", 0, 0},
+		{"smaller than a block", 10, 1},
+		{"one block", 1024, 1},
+		{"short last block", 2500, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := ComputeSignature(bytes.NewReader(data[:tt.size]), int64(tt.size), 1024)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sig.GetBlocks()) != tt.blocks {
+				t.Fatalf("got %d blocks, want %d", len(sig.GetBlocks()), tt.blocks)
+			}
+			for i, block := range sig.GetBlocks() {
+				end := (i + 1) * 1024
+				if end > tt.size {
+					end = tt.size
+				}
+				if block.GetWeak() != NewRollingChecksum(data[i*1024:end]).Sum() || !bytes.Equal(block.GetStrong(), StrongChecksum(data[i*1024:end])) {
+					t.Errorf("block %d has wrong checksums", i)
+				}
+			}
+		})
+	}
+
+	if _, err := ComputeSignature(bytes.NewReader(data[:100]), 200, 1024); err == nil {
+		t.Error("expected an error when the reader is shorter than the size")
+	}
+}
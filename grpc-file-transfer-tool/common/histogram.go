@@ -0,0 +1,95 @@
+package common
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// histogramGrowth 相邻桶上界之比, 分位数的相对误差不超过10%
+	histogramGrowth = 1.1
+	// histogramBuckets 桶数, 最大桶上界约为1.1^300ns, 远大于任何单次发送的耗时
+	histogramBuckets = 300
+)
+
+// Histogram 指数分桶的耗时直方图, 内存占用固定, 并发安全.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets [histogramBuckets]int64
+	count   int64
+	max     time.Duration
+}
+
+// Observe 记录一次耗时.
+func (h *Histogram) Observe(d time.Duration) {
+	idx := 0
+	if d > 1 {
+		idx = int(math.Ceil(math.Log(float64(d)) / math.Log(histogramGrowth)))
+	}
+	if idx >= histogramBuckets {
+		idx = histogramBuckets - 1
+	}
+
+	h.mu.Lock()
+	h.buckets[idx]++
+	h.count++
+	if d > h.max {
+		h.max = d
+	}
+	h.mu.Unlock()
+}
+
+// Merge 将另一个直方图的数据合并进来.
+func (h *Histogram) Merge(o *Histogram) {
+	o.mu.Lock()
+	buckets, count, max := o.buckets, o.count, o.max
+	o.mu.Unlock()
+
+	h.mu.Lock()
+	for i := range buckets {
+		h.buckets[i] += buckets[i]
+	}
+	h.count += count
+	if max > h.max {
+		h.max = max
+	}
+	h.mu.Unlock()
+}
+
+// Count 返回记录的次数.
+func (h *Histogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// Percentile 返回分位数p(0~100)对应的耗时, 取所在桶的上界.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			if i == histogramBuckets-1 {
+				// the last bucket also holds everything larger
+				return h.max
+			}
+			upper := time.Duration(math.Pow(histogramGrowth, float64(i)))
+			if upper > h.max {
+				upper = h.max
+			}
+			return upper
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestHistogramPercentile(t *testing.T) {
+	// 1ms, 2ms, ..., 1000ms in random order
+	uniform := make([]time.Duration, 1000)
+	for i := range uniform {
+		uniform[i] = time.Duration(i+1) * time.Millisecond
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(uniform), func(i, j int) { uniform[i], uniform[j] = uniform[j], uniform[i] })
+
+	tests := []struct {
+		name     string
+		observed []time.Duration
+		p        float64
+		// 分位数的真实值, 结果必须落在[want, want*histogramGrowth]之间
+		want time.Duration
+	}{
+		{"empty", nil, 50, 0},
+		{"single", []time.Duration{3 * time.Millisecond}, 50, 3 * time.Millisecond},
+		{"single at p0", []time.Duration{3 * time.Millisecond}, 0, 3 * time.Millisecond},
+		{"single at p100", []time.Duration{3 * time.Millisecond}, 100, 3 * time.Millisecond},
+		{"zero", []time.Duration{0, 0}, 99, 0},
+		{"one nanosecond", []time.Duration{1}, 99, 1},
+		{"negative", []time.Duration{-time.Second}, 50, 0},
+		{"uniform p0", uniform, 0, time.Millisecond},
+		{"uniform p50", uniform, 50, 500 * time.Millisecond},
+		{"uniform p90", uniform, 90, 900 * time.Millisecond},
+		{"uniform p99", uniform, 99, 990 * time.Millisecond},
+		{"uniform p100", uniform, 100, 1000 * time.Millisecond},
+		{"outlier p50", []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond, time.Hour}, 50, time.Millisecond},
+		{"outlier p100", []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond, time.Hour}, 100, time.Hour},
+		// beyond the last bucket only the max is exact
+		{"huge", []time.Duration{1<<63 - 1}, 50, 1<<63 - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h Histogram
+			for _, d := range tt.observed {
+				h.Observe(d)
+			}
+			if h.Count() != int64(len(tt.observed)) {
+				t.Errorf("count %d, want %d", h.Count(), len(tt.observed))
+			}
+			got := h.Percentile(tt.p)
+			if got < tt.want || float64(got) > float64(tt.want)*histogramGrowth {
+				t.Errorf("p%v = %v, want %v within %v%%", tt.p, got, tt.want, (histogramGrowth-1)*100)
+			}
+		})
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	var all, a, b Histogram
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 1000; i++ {
+		d := time.Duration(r.Int63n(int64(time.Second)))
+		all.Observe(d)
+		if i%3 == 0 {
+			a.Observe(d)
+		} else {
+			b.Observe(d)
+		}
+	}
+	a.Merge(&b)
+
+	if a.Count() != all.Count() {
+		t.Fatalf("merged count %d, want %d", a.Count(), all.Count())
+	}
+	for _, p := range []float64{0, 1, 50, 90, 99, 99.9, 100} {
+		if got, want := a.Percentile(p), all.Percentile(p); got != want {
+			t.Errorf("merged p%v = %v, want %v", p, got, want)
+		}
+	}
+}
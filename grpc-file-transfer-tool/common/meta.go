@@ -0,0 +1,38 @@
+package common
+
+import (
+	"mime"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+// ContentType 根据文件扩展名推断内容类型.
+func ContentType(name string) string {
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// ApplyFileMeta 将元信息中的权限位和修改时间写到文件上.
+func ApplyFileMeta(fd *os.File, meta *api.FileMeta) error {
+	mode := os.FileMode(meta.GetMode()).Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+	if err := fd.Chmod(mode); err != nil {
+		return errors.Wrapf(err, "failed to chmod file '%s'", fd.Name())
+	}
+	if meta.GetModTime() > 0 {
+		mtime := time.Unix(0, meta.GetModTime())
+		if err := os.Chtimes(fd.Name(), mtime, mtime); err != nil {
+			return errors.Wrapf(err, "failed to change times of file '%s'", fd.Name())
+		}
+	}
+	return nil
+}
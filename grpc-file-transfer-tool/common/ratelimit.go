@@ -0,0 +1,44 @@
+package common
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// ParseRate 解析形如"50MB/s", "512KB/s", "1.5GB/s"或者"1048576"的带宽, 返回每秒字节数, 单位按1024进制换算.
+func ParseRate(s string) (int64, error) {
+	n, ok := parseBytes(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "/S"))
+	if !ok {
+		return 0, errors.Errorf("invalid rate '%s', expected something like 50MB/s", s)
+	}
+	return n, nil
+}
+
+// NewRateLimiter 返回每秒bytesPerSec字节, 最多允许突发burst字节的令牌桶, bytesPerSec<=0时返回nil表示不限速.
+func NewRateLimiter(bytesPerSec int64, burst int) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), burst)
+}
+
+// WaitBytes 阻塞直到令牌桶允许再传输n字节, l为nil时立即返回.
+func WaitBytes(ctx context.Context, l *rate.Limiter, n int) error {
+	if l == nil {
+		return nil
+	}
+	for n > 0 {
+		batch := n
+		if batch > l.Burst() {
+			batch = l.Burst()
+		}
+		if err := l.WaitN(ctx, batch); err != nil {
+			return errors.Wrapf(err, "failed to wait for bandwidth")
+		}
+		n -= batch
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"", 0, true},
+		{"0", 0, true},
+		{"1048576", 1 << 20, true},
+		{"50MB/s", 50 << 20, true},
+		{"50mb/s", 50 << 20, true},
+		{" 512KB/s ", 512 << 10, true},
+		{"512 KiB/s", 512 << 10, true},
+		{"1.5GB/s", 3 << 29, true},
+		{"2T/s", 2 << 40, true},
+		{"100B/s", 100, true},
+		{"100/s", 100, true},
+		{"50MB", 50 << 20, true},
+		{"-1MB/s", 0, false},
+		{"MB/s", 0, false},
+		{"50PB/s", 0, false},
+		{"50MB/m", 0, false},
+		{"fast", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWaitBytes(t *testing.T) {
+	if NewRateLimiter(0, 1024) != nil || NewRateLimiter(-1, 1024) != nil {
+		t.Error("expected no limiter without a rate")
+	}
+	if err := WaitBytes(context.Background(), nil, 1<<30); err != nil {
+		t.Errorf("wait without a limiter: %v", err)
+	}
+
+	// more than the burst at once is waited for in batches
+	l := NewRateLimiter(1<<20, 1024)
+	start := time.Now()
+	if err := WaitBytes(context.Background(), l, 100<<10); err != nil {
+		t.Fatalf("wait for more than the burst: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("100KB at 1MB/s took %v, want about 100ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WaitBytes(ctx, NewRateLimiter(1, 1), 10); err == nil {
+		t.Error("expected an error once the context is canceled")
+	}
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var sizeRegexp = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*(?:([KMGT])(?:I?B)?|B)?$`)
+
+// ParseSize 解析形如"10GB", "512MiB", "1.5T"或者"1048576"的大小, 返回字节数, 单位按1024进制换算.
+func ParseSize(s string) (int64, error) {
+	n, ok := parseBytes(s)
+	if !ok {
+		return 0, errors.Errorf("invalid size '%s', expected something like 10GB", s)
+	}
+	return n, nil
+}
+
+// parseBytes 解析带单位的字节数, 空字符串返回0.
+func parseBytes(s string) (int64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return 0, true
+	}
+	m := sizeRegexp.FindStringSubmatch(strings.ToUpper(s))
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	switch m[2] {
+	case "K":
+		n *= 1 << 10
+	case "M":
+		n *= 1 << 20
+	case "G":
+		n *= 1 << 30
+	case "T":
+		n *= 1 << 40
+	}
+	// float64(math.MaxInt64) rounds up to 1<<63
+	if n >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(n), true
+}
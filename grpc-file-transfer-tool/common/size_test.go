@@ -0,0 +1,42 @@
+package common
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"", 0, true},
+		{"0", 0, true},
+		{"1048576", 1 << 20, true},
+		{"10GB", 10 << 30, true},
+		{"10gb", 10 << 30, true},
+		{"10G", 10 << 30, true},
+		{"512MiB", 512 << 20, true},
+		{"512 MiB", 512 << 20, true},
+		{" 4KB ", 4 << 10, true},
+		{"1.5T", 3 << 39, true},
+		{"0.5KB", 512, true},
+		{"100B", 100, true},
+		{"8388607T", 8388607 << 40, true},
+		{"8388608T", 0, false},
+		{"99999999999999999999", 0, false},
+		{"10I", 0, false},
+		{"10IB", 0, false},
+		{"10BB", 0, false},
+		{"10PB", 0, false},
+		{"-1GB", 0, false},
+		{"1.GB", 0, false},
+		{".5GB", 0, false},
+		{"GB", 0, false},
+		{"ten", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
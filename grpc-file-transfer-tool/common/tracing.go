@@ -0,0 +1,181 @@
+package common
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// TraceExporterStdout 把span以json输出到标准输出
+	TraceExporterStdout = "stdout"
+	// TraceExporterOTLP 通过gRPC把span发送给OTLP collector, 地址等通过OTEL_EXPORTER_OTLP_*环境变量配置
+	TraceExporterOTLP = "otlp"
+	// traceExporterFilePrefix 把span以json追加写入本地文件, 例如"file:/tmp/spans.json"
+	traceExporterFilePrefix = "file:"
+)
+
+// SlowOpThreshold 耗时超过该阈值的单次读写才会创建span, 测试中设为0以记录每一次读写
+var SlowOpThreshold = time.Millisecond
+
+// tracePropagator 通过gRPC metadata传递W3C trace context
+var tracePropagator = propagation.TraceContext{}
+
+// ValidTraceExporter 判断exporter是否为支持的导出方式, 空字符串表示不导出.
+func ValidTraceExporter(exporter string) bool {
+	switch {
+	case exporter == "", exporter == TraceExporterStdout, exporter == TraceExporterOTLP:
+		return true
+	case strings.HasPrefix(exporter, traceExporterFilePrefix):
+		return len(exporter) > len(traceExporterFilePrefix)
+	}
+	return false
+}
+
+// NewTracerProvider 根据exporter创建TracerProvider, 返回的shutdown函数会导出剩余的span并释放资源.
+// exporter为空时返回不记录任何span的实现.
+func NewTracerProvider(exporter, service string) (trace.TracerProvider, func(context.Context) error, error) {
+	if exporter == "" {
+		return trace.NewNoopTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+	if !ValidTraceExporter(exporter) {
+		return nil, nil, errors.Errorf("unknown trace exporter '%s', must be stdout, otlp or file:<path>", exporter)
+	}
+
+	var (
+		opt     sdktrace.TracerProviderOption
+		closeFn = func() error { return nil }
+	)
+	switch {
+	case exporter == TraceExporterStdout:
+		exp, err := stdouttrace.New()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to create stdout trace exporter")
+		}
+		opt = sdktrace.WithBatcher(exp)
+	case exporter == TraceExporterOTLP:
+		exp, err := otlptracegrpc.New(context.Background())
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to create otlp trace exporter")
+		}
+		opt = sdktrace.WithBatcher(exp)
+	default:
+		path := strings.TrimPrefix(exporter, traceExporterFilePrefix)
+		fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to open trace file '%s'", path)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(fd))
+		if err != nil {
+			fd.Close() // nolint
+			return nil, nil, errors.Wrap(err, "failed to create file trace exporter")
+		}
+		// export synchronously so that the file is complete as soon as a span ends
+		opt = sdktrace.WithSyncer(exp)
+		closeFn = fd.Close
+	}
+
+	tp := sdktrace.NewTracerProvider(opt, sdktrace.WithResource(
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(service))))
+	shutdown := func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if cerr := closeFn(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	return tp, shutdown, nil
+}
+
+// metadataCarrier 让gRPC metadata可以承载trace context
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// InjectTraceContext 把ctx中的span写入发往服务端的metadata.
+func InjectTraceContext(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	tracePropagator.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// ExtractTraceContext 从客户端带来的metadata中取出span, 作为服务端span的父span.
+func ExtractTraceContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return tracePropagator.Extract(ctx, metadataCarrier(md))
+}
+
+// OpSpans 统计一类重复操作(例如每个分块的读取或者发送)的次数, 字节数和总耗时,
+// 只为耗时超过SlowOpThreshold的单次操作创建span, 避免大文件产生海量的span.
+type OpSpans struct {
+	ctx    context.Context
+	tracer trace.Tracer
+	name   string
+	count  int64
+	slow   int64
+	bytes  int64
+	total  time.Duration
+}
+
+// NewOpSpans 返回OpSpans实例, span的父span取自ctx.
+func NewOpSpans(ctx context.Context, tracer trace.Tracer, name string) *OpSpans {
+	return &OpSpans{ctx: ctx, tracer: tracer, name: name}
+}
+
+// Observe 记录一次从start开始到现在结束, 处理了n字节的操作.
+func (o *OpSpans) Observe(start time.Time, n int) {
+	end := time.Now()
+	d := end.Sub(start)
+	o.count++
+	o.bytes += int64(n)
+	o.total += d
+	if d >= SlowOpThreshold {
+		o.slow++
+		_, span := o.tracer.Start(o.ctx, o.name, trace.WithTimestamp(start), trace.WithAttributes(attribute.Int("bytes", n)))
+		span.End(trace.WithTimestamp(end))
+	}
+}
+
+// Attributes 返回汇总的统计, 用于设置到父span上.
+func (o *OpSpans) Attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int64(o.name+".count", o.count),
+		attribute.Int64(o.name+".slow_count", o.slow),
+		attribute.Int64(o.name+".bytes", o.bytes),
+		attribute.Float64(o.name+".seconds", o.total.Seconds()),
+	}
+}
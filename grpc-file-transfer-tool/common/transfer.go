@@ -0,0 +1,33 @@
+package common
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// maxTransferIDLen 传输ID的最大长度, 超出或者包含其他字符的ID会被服务端丢弃
+const maxTransferIDLen = 64
+
+// NewTransferID 生成一个随机的传输ID.
+func NewTransferID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidTransferID 判断传输ID是否可以安全地写入日志, 只允许字母, 数字, '-'和'_'.
+func ValidTransferID(id string) bool {
+	if id == "" || len(id) > maxTransferIDLen {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
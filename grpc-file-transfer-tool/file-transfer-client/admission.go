@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// retryAfter 判断err是否为服务端繁忙导致的拒绝, 是则返回服务端在trailer中建议的等待时间.
+func retryAfter(err error, trailer metadata.MD) (time.Duration, bool) {
+	if err == nil || status.Code(errors.Cause(err)) != codes.Unavailable {
+		return 0, false
+	}
+	values := trailer.Get(common.RetryAfterKey)
+	if len(values) == 0 {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(values[0])
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// withAdmission 调用fn发起上传, 只在服务端繁忙时按retry-after等待重试, 总共最多等待MaxAdmissionWait.
+func (cli *GRPCStreamClient) withAdmission(ctx context.Context, name string, fn func(opt grpc.CallOption) error) error {
+	_, err := cli.withRetry(ctx, name, nil, fn)
+	return err
+}
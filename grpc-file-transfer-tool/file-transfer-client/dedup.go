@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// HasContent 查询服务端是否已有内容与本地文件fn相同的文件, 有的话服务端直接以name保存这份内容.
+// 返回的stored为true时文件已经上传完成, 不需要再发送.
+func (cli *GRPCStreamClient) HasContent(ctx context.Context, fn, name string) (stored bool, err error) {
+	fd, err := os.Open(fn)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to open file '%s'", fn)
+	}
+	defer fd.Close()
+
+	meta, err := fileMeta(fd)
+	if err != nil {
+		return false, err
+	}
+	meta.Name = filepath.ToSlash(name)
+	h := sha256.New()
+	if _, err = io.Copy(h, fd); err != nil {
+		return false, errors.Wrapf(err, "failed to hash file '%s'", fn)
+	}
+
+	resp, err := cli.client.HasContent(ctx, &api.ContentQuery{Sha256: h.Sum(nil), Meta: meta})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to query content of file '%s'", fn)
+	}
+	return resp.GetStored(), nil
+}
+
+// uploadExisting 开启去重时先询问服务端是否已有相同的内容, 有的话跳过上传.
+// 查询失败(例如服务端没有开启去重)时返回false, 由调用方照常上传.
+func (cli *GRPCStreamClient) uploadExisting(ctx context.Context, fn, name string) (*common.Stats, bool) {
+	if !cli.cfg.Dedup {
+		return nil, false
+	}
+
+	stats := &common.Stats{StartedAt: time.Now()}
+	stored, err := cli.HasContent(ctx, fn, name)
+	if err != nil {
+		if status.Code(errors.Cause(err)) == codes.Unimplemented {
+			cli.logger.Info().Str("file", fn).Msg("server does not deduplicate content, upload the whole file")
+		} else {
+			cli.logger.Error().Err(err).Str("file", fn).Msg("failed to query content, upload the whole file")
+		}
+		return nil, false
+	}
+	if !stored {
+		return nil, false
+	}
+	fi, err := os.Stat(fn)
+	if err == nil {
+		stats.BytesDeduplicated = fi.Size()
+		cli.reportProgress(filepath.ToSlash(name), fi.Size(), fi.Size())
+	}
+	stats.FinishedAt = time.Now()
+	cli.logger.Info().Str("file", fn).Str("name", name).Int64("size", stats.BytesDeduplicated).Msg("server already holds the content, upload skipped")
+	return stats, true
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// syncFileAs 以rsync的方式上传文件: 先取得服务端现有文件的分块签名, 只发送变化了的原始数据和对未变分块的引用.
+// 服务端没有这个文件时照常上传整个文件.
+func (cli *GRPCStreamClient) syncFileAs(ctx context.Context, fn, name string, opts ...grpc.CallOption) (*common.Stats, error) {
+	sig, err := cli.client.GetSignature(ctx, &api.SignatureRequest{Name: filepath.ToSlash(name)})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.NotFound, codes.Unimplemented:
+			cli.logger.Info().Str("file", fn).Msg("no copy on the server to sync with, upload the whole file")
+			return cli.uploadFileAs(ctx, fn, name, opts...)
+		}
+		return nil, errors.Wrapf(err, "failed to get signature of file '%s'", name)
+	}
+
+	stats, err := cli.uploadDelta(ctx, fn, name, sig, opts...)
+	if status.Code(errors.Cause(err)) == codes.FailedPrecondition {
+		// the server's copy went away meanwhile
+		cli.logger.Info().Str("file", fn).Msg("no copy on the server to sync with, upload the whole file")
+		return cli.uploadFileAs(ctx, fn, name, opts...)
+	}
+	return stats, err
+}
+
+func (cli *GRPCStreamClient) uploadDelta(ctx context.Context, fn, name string, sig *api.FileSignature, opts ...grpc.CallOption) (*common.Stats, error) {
+	var (
+		status *api.UploadStatus
+		stats  = &common.Stats{}
+	)
+
+	fd, err := os.Open(fn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open file '%s'", fn)
+	}
+	defer fd.Close()
+
+	meta, err := fileMeta(fd)
+	if err != nil {
+		return nil, err
+	}
+	meta.Name = filepath.ToSlash(name)
+	meta.ChecksumAlgorithm = cli.checksum
+	if meta.ChecksumAlgorithm == api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE {
+		// the server relies on the checksum to tell whether its copy changed since the signature was taken
+		meta.ChecksumAlgorithm = api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256
+	}
+	meta.DeltaBlockSize = sig.GetBlockSize()
+	h, err := common.NewChecksum(meta.ChecksumAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := cli.client.Upload(withWireStats(ctx, stats), opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create upload stream for file %s", fn)
+	}
+	defer func() {
+		stream.CloseSend() // nolint
+	}()
+
+	// start to send
+	stats.StartedAt = time.Now()
+
+	if err = stream.Send(&api.FileChunk{
+		Data: &api.FileChunk_Meta{Meta: meta},
+	}); err != nil {
+		return nil, sendError(stream, err, "failed to send file meta via grpc stream")
+	}
+	cli.reportProgress(meta.Name, 0, meta.Size)
+
+	var (
+		processed int64
+		limiter   = common.NewRateLimiter(cli.cfg.RateLimit, cli.cfg.ChunkSize)
+		sendOps   = common.NewOpSpans(ctx, cli.tracer, "send")
+	)
+	defer setOpAttributes(ctx, sendOps)
+	enc := common.NewDeltaEncoder(sig, cli.cfg.ChunkSize)
+	enc.SendLiteral = func(p []byte) error {
+		if err := common.WaitBytes(ctx, limiter, len(p)); err != nil {
+			return err
+		}
+		sendAt := time.Now()
+		err := stream.Send(&api.FileChunk{
+			Data: &api.FileChunk_Content{Content: p},
+		})
+		sendOps.Observe(sendAt, len(p))
+		if err != nil {
+			return sendError(stream, err, "failed to send chunk via grpc stream")
+		}
+		stats.RecordChunk(len(p), time.Since(sendAt))
+		processed += int64(len(p))
+		cli.reportProgress(meta.Name, processed, meta.Size)
+		return nil
+	}
+	enc.SendBlocks = func(ref *api.BlockRef, n int64) error {
+		if err := stream.Send(&api.FileChunk{
+			Data: &api.FileChunk_Block{Block: ref},
+		}); err != nil {
+			return sendError(stream, err, "failed to send block reference via grpc stream")
+		}
+		processed += n
+		cli.reportProgress(meta.Name, processed, meta.Size)
+		return nil
+	}
+	if err = enc.Encode(fd, h); err != nil {
+		return nil, err
+	}
+
+	if err = stream.Send(&api.FileChunk{
+		Data: &api.FileChunk_Trailer{Trailer: &api.FileTrailer{Checksum: h.Sum(nil)}},
+	}); err != nil {
+		return nil, sendError(stream, err, "failed to send file trailer via grpc stream")
+	}
+
+	ackAt := time.Now()
+	status, err = stream.CloseAndRecv()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to receive upstream status response")
+	}
+	if status.Code != api.UploadStatusCode_STATUS_CODE_OK {
+		return nil, errors.Errorf("upload failed, msg: %s", status.Message)
+	}
+
+	// finish to receive, including the time the server takes to rebuild and commit the file
+	stats.FinishedAt = time.Now()
+	stats.TimeToAck = stats.FinishedAt.Sub(ackAt)
+	stats.BytesSaved = meta.Size - stats.BytesSent
+	cli.logger.Info().Str("file", fn).Int64("literal", stats.BytesSent).Int64("saved", stats.BytesSaved).Msg("sync finished")
+
+	return stats, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// uploadItem 待上传的单个文件
+type uploadItem struct {
+	path string
+	name string
+	size int64
+}
+
+// UploadFiles 上传单个文件, 目录(递归)或者glob匹配到的所有文件, 最多parallel个文件并发上传.
+// 文件在服务端保留相对路径: 目录以目录名为前缀, glob以其中不含通配符的前缀目录为根.
+func (cli *GRPCStreamClient) UploadFiles(ctx context.Context, pattern string, parallel int) (*common.Summary, error) {
+	if parallel <= 0 {
+		return nil, errors.Errorf("parallel must be greater than 0")
+	}
+	items, err := expandUploadPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errors.Errorf("no file matches '%s'", pattern)
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		itemCh  = make(chan uploadItem)
+		summary = &common.Summary{
+			Files:    len(items),
+			Failures: make(map[string]error),
+		}
+	)
+
+	// start to send
+	summary.StartedAt = time.Now()
+
+	// announce every file up front, so that the progress covers the whole batch
+	for _, item := range items {
+		cli.reportProgress(item.name, 0, item.size)
+	}
+
+	for i := 0; i < parallel && i < len(items); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range itemCh {
+				stat, err := cli.UploadFileAs(ctx, item.path, item.name)
+
+				mu.Lock()
+				if err != nil {
+					summary.Failures[item.name] = err
+				} else {
+					summary.Succeeded++
+					summary.Bytes += item.size
+					summary.Attempts += stat.Attempts
+				}
+				mu.Unlock()
+
+				if err != nil {
+					cli.logger.Error().Err(err).Str("file", item.path).Msg("failed to upload file")
+				} else {
+					cli.logger.Info().Str("file", item.path).Str("name", item.name).Msg("upload file successfully")
+				}
+			}
+		}()
+	}
+	for _, item := range items {
+		itemCh <- item
+	}
+	close(itemCh)
+	wg.Wait()
+
+	// finish to send
+	summary.FinishedAt = time.Now()
+
+	return summary, nil
+}
+
+// expandUploadPattern 将文件, 目录或者glob展开为待上传文件列表.
+func expandUploadPattern(pattern string) ([]uploadItem, error) {
+	var (
+		matches = []string{pattern}
+		// "dir" and "dir/" both keep "dir" in the remote names
+		root = filepath.Dir(filepath.Clean(pattern))
+		err  error
+	)
+	if hasMeta(pattern) {
+		if matches, err = filepath.Glob(pattern); err != nil {
+			return nil, errors.Wrapf(err, "invalid glob pattern '%s'", pattern)
+		}
+		root = staticPrefix(pattern)
+	}
+
+	var items []uploadItem
+	for _, match := range matches {
+		err = filepath.Walk(match, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			name, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			items = append(items, uploadItem{path: path, name: filepath.ToSlash(name), size: fi.Size()})
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to walk '%s'", match)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].name < items[j].name })
+
+	return items, nil
+}
+
+// hasMeta 判断路径中是否包含glob通配符.
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
+
+// staticPrefix 返回glob中不含通配符的前缀目录.
+func staticPrefix(pattern string) string {
+	dir := filepath.Dir(pattern)
+	for hasMeta(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
@@ -1,12 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -18,18 +29,49 @@ import (
 
 // GRPCStreamClient gRPC流客户端
 type GRPCStreamClient struct {
-	logger zerolog.Logger
-	cfg    *GRPCStreamClientCfg
-	client api.GrpcStreamServiceClient
-	conn   *grpc.ClientConn
+	logger   zerolog.Logger
+	cfg      *GRPCStreamClientCfg
+	checksum api.ChecksumAlgorithm
+	progress ProgressFunc
+	client   api.GrpcStreamServiceClient
+	conn     *grpc.ClientConn
+	tracer   trace.Tracer
+	// shutdownTracing 导出剩余的span并关闭exporter
+	shutdownTracing func(context.Context) error
 }
 
+// ProgressFunc 传输进度回调, name为服务端文件名, transferred为服务端已有的字节数, total为文件大小.
+// 回调可能在多个goroutine中被并发调用.
+type ProgressFunc func(name string, transferred, total int64)
+
 // GRPCStreamClientCfg gRPC流客户端配置
 type GRPCStreamClientCfg struct {
 	Address    string `json:"address"`
 	ChunkSize  int    `json:"chunk_size"`
 	Compressed bool   `json:"compressed"`
 	RootCert   string `json:"root_cert"`
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+	// ServerName 用于校验服务端证书的名字, 为空时使用Address中的主机名
+	ServerName string `json:"server_name"`
+	Checksum   string `json:"checksum"`
+	Resume     bool   `json:"resume"`
+	// RateLimit 每条流每秒最多传输的字节数, 0表示不限速
+	RateLimit int64 `json:"rate_limit"`
+	// Token 每个请求携带的bearer令牌
+	Token string `json:"token"`
+	// TokenFile 从文件中读取bearer令牌, 不能与Token同时配置
+	TokenFile string `json:"token_file"`
+	// MaxAdmissionWait 服务端繁忙拒绝上传时, 按服务端建议的时间等待重试的总时长上限, 0表示不重试
+	MaxAdmissionWait time.Duration `json:"max_admission_wait"`
+	// Retry 上传失败时的重试策略, 为nil时不重试
+	Retry *RetryPolicy `json:"retry"`
+	// TraceExporter OpenTelemetry span的导出方式, 可以是"stdout", "otlp"或者"file:<path>", 为空时不导出
+	TraceExporter string `json:"trace_exporter"`
+	// Dedup 上传前询问服务端是否已有内容相同的文件, 有的话跳过上传, 需要服务端开启去重
+	Dedup bool `json:"dedup"`
+	// Sync 服务端已有同名文件时只发送变化的部分(rsync增量同步), 不能与多流上传同时使用
+	Sync bool `json:"sync"`
 }
 
 // NewGRPCStreamClient 返回GRPCStreamClient实例.
@@ -44,26 +86,51 @@ func NewGRPCStreamClient(cfg *GRPCStreamClientCfg) (*GRPCStreamClient, error) {
 	}
 	if cfg.ChunkSize <= 0 {
 		return nil, errors.Errorf("chunk_size must be specified")
-	} else if cfg.ChunkSize > (1 << 22) {
+	} else if cfg.ChunkSize > common.MaxChunkSize {
 		return nil, errors.Errorf("chunk_size must be less than 4MB")
 	}
+	checksum, err := common.ParseChecksumAlgorithm(cfg.Checksum)
+	if err != nil {
+		return nil, err
+	}
 	if cfg.Compressed {
 		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor("gzip")))
 	}
-	if cfg.RootCert != "" {
-		creds, err := credentials.NewClientTLSFromFile(cfg.RootCert, "SummyChou") // change the serverNameOverride for yourself
+	opts = append(opts, grpc.WithStatsHandler(wireStatsHandler{}))
+	token, err := loadToken(cfg)
+	if err != nil {
+		return nil, err
+	}
+	secure := cfg.RootCert != "" || cfg.ClientCert != ""
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials{token: token, secure: secure}))
+	}
+	if secure {
+		tlsCfg, err := clientTLSConfig(cfg)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to create tls-grpc-client using root-cert '%s'", cfg.RootCert)
+			return nil, err
 		}
-		opts = append(opts, grpc.WithTransportCredentials(creds))
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
 	} else {
 		opts = append(opts, grpc.WithInsecure())
 	}
 
 	cli := &GRPCStreamClient{}
-	cli.logger = zerolog.New(os.Stdout).With().Str("from", "grpc stream client").Logger()
+	cli.logger = zerolog.New(os.Stderr).With().Str("from", "grpc stream client").Logger()
 	cli.cfg = cfg
+	cli.checksum = checksum
+	tp, shutdownTracing, err := common.NewTracerProvider(cfg.TraceExporter, "file-transfer-client")
+	if err != nil {
+		return nil, err
+	}
+	cli.tracer = tp.Tracer("file-transfer-client")
+	cli.shutdownTracing = shutdownTracing
+	opts = append(opts,
+		grpc.WithChainUnaryInterceptor(cli.unaryLoggingInterceptor(), traceUnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(cli.streamLoggingInterceptor(), traceStreamClientInterceptor()),
+	)
 	if cli.conn, err = grpc.Dial(cfg.Address, opts...); err != nil {
+		shutdownTracing(context.Background()) // nolint
 		return nil, errors.Wrapf(err, "failed to create tls-grpc-connection with address %s", cfg.Address)
 	}
 	cli.client = api.NewGrpcStreamServiceClient(cli.conn)
@@ -71,15 +138,103 @@ func NewGRPCStreamClient(cfg *GRPCStreamClientCfg) (*GRPCStreamClient, error) {
 	return cli, nil
 }
 
+// clientTLSConfig 根据配置构造TLS配置, 配置了客户端证书时用于双向认证.
+func clientTLSConfig(cfg *GRPCStreamClientCfg) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName: cfg.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.RootCert != "" {
+		pem, err := ioutil.ReadFile(cfg.RootCert)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read root-cert '%s'", cfg.RootCert)
+		}
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("failed to create tls-grpc-client using root-cert '%s'", cfg.RootCert)
+		}
+	}
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		if cfg.ClientCert == "" || cfg.ClientKey == "" {
+			return nil, errors.Errorf("client_cert and client_key must be specified together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load client-cert '%s' and client-key '%s'", cfg.ClientCert, cfg.ClientKey)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// OnProgress 设置传输进度回调, 每发送一个分块回调一次.
+func (cli *GRPCStreamClient) OnProgress(fn ProgressFunc) {
+	cli.progress = fn
+}
+
+// reportProgress 调用传输进度回调.
+func (cli *GRPCStreamClient) reportProgress(name string, transferred, total int64) {
+	if cli.progress != nil {
+		cli.progress(name, transferred, total)
+	}
+}
+
 // Close 停止运行gRPC流客户端.
 func (cli *GRPCStreamClient) Close() {
 	if cli.conn != nil {
 		cli.conn.Close() // nolint
 	}
+	if cli.shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := cli.shutdownTracing(ctx); err != nil {
+			cli.logger.Error().Err(err).Msg("failed to flush spans")
+		}
+	}
 }
 
-// UploadFile 上传文件.
+// UploadFile 上传文件, 服务端使用本地文件名保存.
 func (cli *GRPCStreamClient) UploadFile(ctx context.Context, fn string) (*common.Stats, error) {
+	return cli.UploadFileAs(ctx, fn, filepath.Base(fn))
+}
+
+// UploadFileAs 上传文件, 服务端使用name(相对于存储目录的路径)保存.
+// 失败时按照重试策略重新上传, 开启续传时从服务端已有的位置继续.
+func (cli *GRPCStreamClient) UploadFileAs(ctx context.Context, fn, name string) (stats *common.Stats, err error) {
+	ctx, transferID := withTransferID(ctx)
+	ctx, span := cli.tracer.Start(ctx, "UploadFile", trace.WithAttributes(
+		attribute.String("file", fn),
+		attribute.String("name", name),
+		attribute.String("transfer_id", transferID),
+	))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	if existing, ok := cli.uploadExisting(ctx, fn, name); ok {
+		existing.TransferID = transferID
+		return existing, nil
+	}
+
+	attempts, err := cli.withRetry(ctx, name, cli.cfg.Retry, func(opt grpc.CallOption) error {
+		return cli.traceAttempt(ctx, func(ctx context.Context) (err error) {
+			if cli.cfg.Sync {
+				stats, err = cli.syncFileAs(ctx, fn, name, opt)
+			} else {
+				stats, err = cli.uploadFileAs(ctx, fn, name, opt)
+			}
+			return
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.Attempts = attempts
+	stats.TransferID = transferID
+	return stats, nil
+}
+
+func (cli *GRPCStreamClient) uploadFileAs(ctx context.Context, fn, name string, opts ...grpc.CallOption) (*common.Stats, error) {
 	var (
 		status *api.UploadStatus
 		stats  = &common.Stats{}
@@ -91,7 +246,23 @@ func (cli *GRPCStreamClient) UploadFile(ctx context.Context, fn string) (*common
 	}
 	defer fd.Close()
 
-	stream, err := cli.client.Upload(ctx)
+	meta, err := fileMeta(fd)
+	if err != nil {
+		return nil, err
+	}
+	meta.Name = filepath.ToSlash(name)
+	meta.ChecksumAlgorithm = cli.checksum
+	h, err := common.NewChecksum(cli.checksum)
+	if err != nil {
+		return nil, err
+	}
+	if cli.cfg.Resume {
+		if err = cli.resume(ctx, fd, meta, h); err != nil {
+			return nil, err
+		}
+	}
+
+	stream, err := cli.client.Upload(withWireStats(ctx, stats), opts...)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create upload stream for file %s", fn)
 	}
@@ -102,10 +273,24 @@ func (cli *GRPCStreamClient) UploadFile(ctx context.Context, fn string) (*common
 	// start to send
 	stats.StartedAt = time.Now()
 
+	if err = stream.Send(&api.FileChunk{
+		Data: &api.FileChunk_Meta{Meta: meta},
+	}); err != nil {
+		return nil, sendError(stream, err, "failed to send file meta via grpc stream")
+	}
+	transferred := meta.Offset
+	cli.reportProgress(meta.Name, transferred, meta.Size)
+
+	limiter := common.NewRateLimiter(cli.cfg.RateLimit, cli.cfg.ChunkSize)
 	buffer := make([]byte, cli.cfg.ChunkSize)
+	readOps := common.NewOpSpans(ctx, cli.tracer, "read")
+	sendOps := common.NewOpSpans(ctx, cli.tracer, "send")
+	defer setOpAttributes(ctx, readOps, sendOps)
 WRITE_LOOP:
 	for {
+		readAt := time.Now()
 		n, err := fd.Read(buffer)
+		readOps.Observe(readAt, n)
 		if err != nil {
 			if err == io.EOF {
 				break WRITE_LOOP
@@ -113,16 +298,34 @@ WRITE_LOOP:
 			return nil, errors.Wrapf(err, "failed unexpectedly while copying from file to buffer")
 		}
 
+		if err = common.WaitBytes(ctx, limiter, n); err != nil {
+			return nil, err
+		}
+		sendAt := time.Now()
+		err = stream.Send(&api.FileChunk{
+			Data: &api.FileChunk_Content{Content: buffer[:n]},
+		})
+		sendOps.Observe(sendAt, n)
+		if err != nil {
+			return nil, sendError(stream, err, "failed to send chunk via grpc stream")
+		}
+		stats.RecordChunk(n, time.Since(sendAt))
+		if h != nil {
+			h.Write(buffer[:n]) // nolint
+		}
+		transferred += int64(n)
+		cli.reportProgress(meta.Name, transferred, meta.Size)
+	}
+
+	if h != nil {
 		if err = stream.Send(&api.FileChunk{
-			Content: buffer[:n],
+			Data: &api.FileChunk_Trailer{Trailer: &api.FileTrailer{Checksum: h.Sum(nil)}},
 		}); err != nil {
-			return nil, errors.Wrapf(err, "failed to send chunk via grpc stream")
+			return nil, sendError(stream, err, "failed to send file trailer via grpc stream")
 		}
 	}
 
-	// finish to receive
-	stats.FinishedAt = time.Now()
-
+	ackAt := time.Now()
 	status, err = stream.CloseAndRecv()
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to receive upstream status response")
@@ -131,5 +334,183 @@ WRITE_LOOP:
 		return nil, errors.Errorf("upload failed, msg: %s", status.Message)
 	}
 
+	// finish to receive, including the time the server takes to commit the file
+	stats.FinishedAt = time.Now()
+	stats.TimeToAck = stats.FinishedAt.Sub(ackAt)
+
 	return stats, nil
 }
+
+// DownloadFile 下载文件, out为空或者为目录时使用远端文件名保存.
+func (cli *GRPCStreamClient) DownloadFile(ctx context.Context, name, out string) (*common.Stats, error) {
+	var (
+		stats   = &common.Stats{}
+		written int64
+		trailer *api.FileTrailer
+	)
+	ctx, stats.TransferID = withTransferID(ctx)
+
+	if out == "" {
+		out = filepath.Base(name)
+	} else if fi, err := os.Stat(out); err == nil && fi.IsDir() {
+		out = filepath.Join(out, filepath.Base(name))
+	}
+	h, err := common.NewChecksum(cli.checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	// start to receive
+	stats.StartedAt = time.Now()
+
+	stream, err := cli.client.Download(ctx, &api.DownloadRequest{
+		Name:              name,
+		ChunkSize:         int32(cli.cfg.ChunkSize),
+		ChecksumAlgorithm: cli.checksum,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create download stream for file %s", name)
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to receive file meta for file %s", name)
+	}
+	meta := first.GetMeta()
+	if meta == nil {
+		return nil, errors.Errorf("file meta must be received as the first message")
+	}
+
+	limiter := common.NewRateLimiter(cli.cfg.RateLimit, cli.cfg.ChunkSize)
+	fd, err := ioutil.TempFile(filepath.Dir(out), "."+filepath.Base(out)+".*.download")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create temp file for '%s'", out)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			fd.Close()           // nolint
+			os.Remove(fd.Name()) // nolint
+		}
+	}()
+
+READ_LOOP:
+	for {
+		chunk, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break READ_LOOP
+			}
+			return nil, errors.Wrapf(err, "failed to receive chunk via grpc stream")
+		}
+		if trailer != nil {
+			return nil, errors.Errorf("received data after file trailer")
+		}
+		if chunk.GetTrailer() != nil {
+			trailer = chunk.GetTrailer()
+			continue
+		}
+		if _, err = fd.Write(chunk.GetContent()); err != nil {
+			return nil, errors.Wrapf(err, "failed unexpectedly while copying from chunk to file")
+		}
+		// pacing Recv lets grpc flow control slow the server down
+		if err = common.WaitBytes(ctx, limiter, len(chunk.GetContent())); err != nil {
+			return nil, err
+		}
+		if h != nil {
+			h.Write(chunk.GetContent()) // nolint
+		}
+		written += int64(len(chunk.GetContent()))
+	}
+
+	if written != meta.GetSize() {
+		return nil, errors.Errorf("download failed, received %d bytes, but %d bytes were declared", written, meta.GetSize())
+	}
+	if h != nil && (trailer == nil || !bytes.Equal(h.Sum(nil), trailer.GetChecksum())) {
+		return nil, errors.Errorf("download failed, checksum mismatch")
+	}
+	if err = common.ApplyFileMeta(fd, meta); err != nil {
+		return nil, err
+	}
+	if err = fd.Sync(); err != nil {
+		return nil, errors.Wrapf(err, "failed to sync file '%s'", fd.Name())
+	}
+	if err = fd.Close(); err != nil {
+		return nil, errors.Wrapf(err, "failed to close file '%s'", fd.Name())
+	}
+	if err = os.Rename(fd.Name(), out); err != nil {
+		os.Remove(fd.Name()) // nolint
+		return nil, errors.Wrapf(err, "failed to rename '%s' to '%s'", fd.Name(), out)
+	}
+	committed = true
+
+	// finish to receive
+	stats.FinishedAt = time.Now()
+
+	return stats, nil
+}
+
+// sendError 包装Send返回的错误, Send返回io.EOF说明服务端已结束该流, 真正的原因需要通过CloseAndRecv获取.
+func sendError(stream api.GrpcStreamService_UploadClient, err error, msg string) error {
+	if err == io.EOF {
+		if _, rerr := stream.CloseAndRecv(); rerr != nil {
+			err = rerr
+		}
+	}
+	return errors.Wrap(err, msg)
+}
+
+// fileMeta 根据本地文件属性构造上传元信息.
+func fileMeta(fd *os.File) (*api.FileMeta, error) {
+	fi, err := fd.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to stat file '%s'", fd.Name())
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, errors.Errorf("'%s' is not a regular file", fd.Name())
+	}
+
+	return &api.FileMeta{
+		Name:        fi.Name(),
+		Size:        fi.Size(),
+		Mode:        uint32(fi.Mode().Perm()),
+		ModTime:     fi.ModTime().UnixNano(),
+		ContentType: common.ContentType(fi.Name()),
+	}, nil
+}
+
+// resume 向服务端查询已上传的字节数, 并将本地文件的读位置移动到该处.
+func (cli *GRPCStreamClient) resume(ctx context.Context, fd *os.File, meta *api.FileMeta, h hash.Hash) error {
+	meta.SessionId = sessionID(fd.Name(), meta)
+
+	resp, err := cli.client.QueryUploadOffset(ctx, &api.UploadSession{SessionId: meta.SessionId})
+	if err != nil {
+		return errors.Wrapf(err, "failed to query upload offset for session %s", meta.SessionId)
+	}
+	offset := resp.GetOffset()
+	if offset <= 0 || offset > meta.Size {
+		return nil
+	}
+
+	// the checksum covers the whole file, so feed it with what the server already has
+	if h != nil {
+		if _, err = io.CopyN(h, fd, offset); err != nil {
+			return errors.Wrapf(err, "failed to hash the first %d bytes of file '%s'", offset, fd.Name())
+		}
+	} else if _, err = fd.Seek(offset, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "failed to seek file '%s' to %d", fd.Name(), offset)
+	}
+	meta.Offset = offset
+	cli.logger.Info().Str("session", meta.SessionId).Int64("offset", offset).Msg("resume upload")
+
+	return nil
+}
+
+// sessionID 根据文件路径, 远端文件名, 大小和修改时间生成会话ID, 文件不变时以同一名字多次上传得到的会话ID相同.
+func sessionID(fn string, meta *api.FileMeta) string {
+	if abs, err := filepath.Abs(fn); err == nil {
+		fn = abs
+	}
+	// the server binds a session to the remote name
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%d", fn, meta.Name, meta.Size, meta.ModTime)))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+func TestSessionID(t *testing.T) {
+	base := func() *api.FileMeta {
+		return &api.FileMeta{Name: "a.bin", Size: 100, ModTime: 1}
+	}
+	id := sessionID("/data/a.bin", base())
+
+	tests := []struct {
+		name   string
+		fn     string
+		modify func(meta *api.FileMeta)
+		same   bool
+	}{
+		{"same file", "/data/a.bin", func(meta *api.FileMeta) {}, true},
+		{"same path after cleaning", "/data/../data/a.bin", func(meta *api.FileMeta) {}, true},
+		{"mode does not matter", "/data/a.bin", func(meta *api.FileMeta) { meta.Mode = 0600 }, true},
+		{"other path", "/data/b.bin", func(meta *api.FileMeta) {}, false},
+		{"other remote name", "/data/a.bin", func(meta *api.FileMeta) { meta.Name = "backup/a.bin" }, false},
+		{"other size", "/data/a.bin", func(meta *api.FileMeta) { meta.Size = 101 }, false},
+		{"other mod time", "/data/a.bin", func(meta *api.FileMeta) { meta.ModTime = 2 }, false},
+	}
+	for _, tt := range tests {
+		meta := base()
+		tt.modify(meta)
+		if got := sessionID(tt.fn, meta); (got == id) != tt.same {
+			t.Errorf("%s: session id %s, first upload %s, want same %v", tt.name, got, id, tt.same)
+		}
+	}
+}
+
+func TestDownloadServerRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	// the bucket starts with a burst of one max chunk, 4MB
+	addr := startServer(t, dir, "--limit", "4MB/s")
+	if err := os.MkdirAll(filepath.Join(dir, "storage"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, data := writeRandomFile(t, filepath.Join(dir, "storage"), "limited.bin", 10<<20)
+
+	cli, err := NewGRPCStreamClient(&GRPCStreamClientCfg{
+		Address:   addr,
+		ChunkSize: 1 << 20,
+		Checksum:  "sha256",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	out := filepath.Join(dir, "out.bin")
+	start := time.Now()
+	if _, err = cli.DownloadFile(context.Background(), "limited.bin", out); err != nil {
+		t.Fatal(err)
+	}
+	// 6MB past the burst take 1.5s at 4MB/s
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("download took %v, want the server limit to slow it down", elapsed)
+	}
+	got, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("downloaded file differs from the stored file")
+	}
+}
+
+func TestUploadQuotaExhausted(t *testing.T) {
+	dir := t.TempDir()
+	addr := startServer(t, dir, "--client-quota", "1MB")
+	first, _ := writeRandomFile(t, dir, "first.bin", 600<<10)
+	second, _ := writeRandomFile(t, dir, "second.bin", 600<<10)
+
+	cli, err := NewGRPCStreamClient(&GRPCStreamClientCfg{
+		Address:   addr,
+		ChunkSize: 64 << 10,
+		Checksum:  "sha256",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if _, err = cli.UploadFile(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	_, err = cli.UploadFile(context.Background(), second)
+	st, _ := status.FromError(errors.Cause(err))
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("upload over the quota returned %v, want %v", err, codes.ResourceExhausted)
+	}
+	var code api.UploadStatusCode
+	for _, detail := range st.Details() {
+		if us, ok := detail.(*api.UploadStatus); ok {
+			code = us.GetCode()
+		}
+	}
+	if code != api.UploadStatusCode_STATUS_CODE_QUOTA_EXCEEDED {
+		t.Errorf("upload over the quota carries %v, want %v", code, api.UploadStatusCode_STATUS_CODE_QUOTA_EXCEEDED)
+	}
+}
+
+func TestUploadChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	addr := startServer(t, dir)
+	fn, data := writeRandomFile(t, dir, "sum.bin", 100<<10)
+
+	cli, err := NewGRPCStreamClient(&GRPCStreamClientCfg{Address: addr, ChunkSize: 64 << 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	checksum := func(algo api.ChecksumAlgorithm, data []byte) []byte {
+		h, err := common.NewChecksum(algo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Write(data) // nolint
+		return h.Sum(nil)
+	}
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)/2] ^= 0xff
+
+	tests := []struct {
+		name string
+		algo api.ChecksumAlgorithm
+		// trailer 客户端发送的校验和, 为nil时不发送trailer
+		trailer []byte
+		// resumable 以可续传会话上传
+		resumable bool
+		code      api.UploadStatusCode
+	}{
+		{"sha256", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256, checksum(api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256, data), false, api.UploadStatusCode_STATUS_CODE_OK},
+		{"sha256 mismatch", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256, checksum(api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256, corrupted), false, api.UploadStatusCode_STATUS_CODE_CHECKSUM_MISMATCH},
+		{"blake3 mismatch", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_BLAKE3, checksum(api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_BLAKE3, corrupted), false, api.UploadStatusCode_STATUS_CODE_CHECKSUM_MISMATCH},
+		{"crc32c mismatch", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_CRC32C, checksum(api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_CRC32C, corrupted), false, api.UploadStatusCode_STATUS_CODE_CHECKSUM_MISMATCH},
+		{"checksum of another algorithm", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_BLAKE3, checksum(api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256, data), false, api.UploadStatusCode_STATUS_CODE_CHECKSUM_MISMATCH},
+		{"missing trailer", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256, nil, false, api.UploadStatusCode_STATUS_CODE_FAILED},
+		{"resumable mismatch", api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256, checksum(api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_SHA256, corrupted), true, api.UploadStatusCode_STATUS_CODE_CHECKSUM_MISMATCH},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd, err := os.Open(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			meta, err := fileMeta(fd)
+			fd.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			meta.Name = fmt.Sprintf("sum-%d.bin", i)
+			meta.ChecksumAlgorithm = tt.algo
+			if tt.resumable {
+				meta.SessionId = sessionID(fn, meta)
+			}
+
+			stream, err := cli.client.Upload(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks := []*api.FileChunk{
+				{Data: &api.FileChunk_Meta{Meta: meta}},
+				{Data: &api.FileChunk_Content{Content: data}},
+			}
+			if tt.trailer != nil {
+				chunks = append(chunks, &api.FileChunk{Data: &api.FileChunk_Trailer{Trailer: &api.FileTrailer{Checksum: tt.trailer}}})
+			}
+			for _, chunk := range chunks {
+				if err = stream.Send(chunk); err != nil {
+					t.Fatal(err)
+				}
+			}
+			resp, err := stream.CloseAndRecv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.GetCode() != tt.code {
+				t.Fatalf("upload returned %v, want %v", resp.GetCode(), tt.code)
+			}
+
+			_, err = os.Stat(filepath.Join(dir, "storage", meta.Name))
+			if stored := err == nil; stored != (tt.code == api.UploadStatusCode_STATUS_CODE_OK) {
+				t.Errorf("file stored %v after %v", stored, tt.code)
+			}
+			if tt.resumable {
+				// the received bytes are useless, the next attempt starts over
+				offset, err := cli.client.QueryUploadOffset(context.Background(), &api.UploadSession{SessionId: meta.SessionId})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if offset.GetOffset() != 0 {
+					t.Errorf("session kept %d bytes after a checksum mismatch", offset.GetOffset())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// UploadFileParallel 将文件拆分为streams个区间, 每个区间通过一条独立的上传流并发发送, 由服务端拼装为一个文件.
+// 任何一个区间失败都会使服务端放弃整个文件, 因此按照重试策略重试时所有区间都重新上传.
+func (cli *GRPCStreamClient) UploadFileParallel(ctx context.Context, fn string, streams int) (stats *common.Stats, err error) {
+	if streams <= 1 || cli.cfg.Sync {
+		return cli.UploadFile(ctx, fn)
+	}
+
+	ctx, transferID := withTransferID(ctx)
+	ctx, span := cli.tracer.Start(ctx, "UploadFileParallel", trace.WithAttributes(
+		attribute.String("file", fn),
+		attribute.Int("streams", streams),
+		attribute.String("transfer_id", transferID),
+	))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	if existing, ok := cli.uploadExisting(ctx, fn, filepath.Base(fn)); ok {
+		existing.TransferID = transferID
+		return existing, nil
+	}
+
+	attempts, err := cli.withRetry(ctx, filepath.Base(fn), cli.cfg.Retry, func(opt grpc.CallOption) error {
+		return cli.traceAttempt(ctx, func(ctx context.Context) (err error) {
+			stats, err = cli.uploadFileParallel(ctx, fn, streams, opt)
+			return
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.Attempts = attempts
+	stats.TransferID = transferID
+	return stats, nil
+}
+
+// uploadFileParallel 完成一次并发上传的尝试, 文件太小而不值得拆分时以opts通过一条流上传.
+func (cli *GRPCStreamClient) uploadFileParallel(ctx context.Context, fn string, streams int, opts ...grpc.CallOption) (*common.Stats, error) {
+	fd, err := os.Open(fn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open file '%s'", fn)
+	}
+	defer fd.Close()
+
+	meta, err := fileMeta(fd)
+	if err != nil {
+		return nil, err
+	}
+	meta.Name = filepath.Base(fn)
+	meta.ChecksumAlgorithm = cli.checksum
+	meta.SessionId, err = randomSessionID()
+	if err != nil {
+		return nil, err
+	}
+	// never split a file into ranges smaller than a chunk
+	if n := (meta.Size + int64(cli.cfg.ChunkSize) - 1) / int64(cli.cfg.ChunkSize); n < int64(streams) {
+		streams = int(n)
+	}
+	if streams <= 1 {
+		// already inside the retries and the span of UploadFileParallel
+		return cli.uploadFileAs(ctx, fn, meta.Name, opts...)
+	}
+	meta.Parts = int32(streams)
+
+	var transferred int64
+	onSent := func(n int) {
+		cli.reportProgress(meta.Name, atomic.AddInt64(&transferred, int64(n)), meta.Size)
+	}
+	cli.reportProgress(meta.Name, 0, meta.Size)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		stats    = &common.Stats{}
+		rangeLen = meta.Size / int64(streams)
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// start to send
+	stats.StartedAt = time.Now()
+
+	for i := 0; i < streams; i++ {
+		part := proto.Clone(meta).(*api.FileMeta)
+		part.Offset = int64(i) * rangeLen
+		part.Length = rangeLen
+		if i == streams-1 {
+			part.Length = meta.Size - part.Offset
+		}
+
+		wg.Add(1)
+		go func(part *api.FileMeta) {
+			defer wg.Done()
+			ctx, span := cli.tracer.Start(ctx, "part", trace.WithAttributes(
+				attribute.Int64("offset", part.Offset),
+				attribute.Int64("length", part.Length),
+			))
+			var partStats *common.Stats
+			err := cli.withAdmission(ctx, part.Name, func(opt grpc.CallOption) (err error) {
+				var sent int
+				partStats, err = cli.uploadRange(ctx, fd, part, func(n int) {
+					sent += n
+					onSent(n)
+				}, opt)
+				if err != nil {
+					// the part will be sent again from the start
+					onSent(-sent)
+				}
+				return err
+			})
+			endSpan(span, err)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			mu.Lock()
+			stats.Merge(partStats)
+			mu.Unlock()
+		}(part)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	// finish to send
+	stats.FinishedAt = time.Now()
+
+	return stats, nil
+}
+
+// uploadRange 通过一条上传流发送文件的区间[part.Offset, part.Offset+part.Length), 每发送一个分块调用一次onSent.
+func (cli *GRPCStreamClient) uploadRange(ctx context.Context, fd *os.File, part *api.FileMeta, onSent func(n int), opts ...grpc.CallOption) (*common.Stats, error) {
+	stats := &common.Stats{}
+	h, err := common.NewChecksum(cli.checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := cli.client.Upload(withWireStats(ctx, stats), opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create upload stream for range [%d, %d)", part.Offset, part.Offset+part.Length)
+	}
+	defer func() {
+		stream.CloseSend() // nolint
+	}()
+
+	if err = stream.Send(&api.FileChunk{
+		Data: &api.FileChunk_Meta{Meta: part},
+	}); err != nil {
+		return nil, sendError(stream, err, "failed to send file meta via grpc stream")
+	}
+
+	// os.File.ReadAt is safe for concurrent use, so all ranges share the same fd
+	reader := io.NewSectionReader(fd, part.Offset, part.Length)
+	limiter := common.NewRateLimiter(cli.cfg.RateLimit, cli.cfg.ChunkSize)
+	buffer := make([]byte, cli.cfg.ChunkSize)
+	readOps := common.NewOpSpans(ctx, cli.tracer, "read")
+	sendOps := common.NewOpSpans(ctx, cli.tracer, "send")
+	defer setOpAttributes(ctx, readOps, sendOps)
+WRITE_LOOP:
+	for {
+		readAt := time.Now()
+		n, err := reader.Read(buffer)
+		readOps.Observe(readAt, n)
+		if n > 0 {
+			if err := common.WaitBytes(ctx, limiter, n); err != nil {
+				return nil, err
+			}
+			sendAt := time.Now()
+			err := stream.Send(&api.FileChunk{
+				Data: &api.FileChunk_Content{Content: buffer[:n]},
+			})
+			sendOps.Observe(sendAt, n)
+			if err != nil {
+				return nil, sendError(stream, err, "failed to send chunk via grpc stream")
+			}
+			stats.RecordChunk(n, time.Since(sendAt))
+			onSent(n)
+			if h != nil {
+				h.Write(buffer[:n]) // nolint
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				break WRITE_LOOP
+			}
+			return nil, errors.Wrapf(err, "failed unexpectedly while copying from file to buffer")
+		}
+	}
+
+	if h != nil {
+		if err = stream.Send(&api.FileChunk{
+			Data: &api.FileChunk_Trailer{Trailer: &api.FileTrailer{Checksum: h.Sum(nil)}},
+		}); err != nil {
+			return nil, sendError(stream, err, "failed to send file trailer via grpc stream")
+		}
+	}
+
+	ackAt := time.Now()
+	status, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to receive upstream status response")
+	}
+	if status.Code != api.UploadStatusCode_STATUS_CODE_OK {
+		return nil, errors.Errorf("upload failed, range [%d, %d), msg: %s", part.Offset, part.Offset+part.Length, status.Message)
+	}
+
+	stats.TimeToAck = time.Since(ackAt)
+
+	return stats, nil
+}
+
+// randomSessionID 为多流上传生成随机会话ID.
+func randomSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrapf(err, "failed to generate session id")
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// CheckHealth 调用标准的grpc.health.v1接口查询服务状态, service为空时查询整个服务端.
+func (cli *GRPCStreamClient) CheckHealth(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	resp, err := healthpb.NewHealthClient(cli.conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		cli.logger.Error().Err(err).Msg("failed to check health")
+		return healthpb.HealthCheckResponse_UNKNOWN, errors.Wrap(err, "failed to check health")
+	}
+	return resp.GetStatus(), nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// withTransferID 返回ctx中已有的传输ID, 没有时生成一个并放入发往服务端的metadata.
+// 同一次传输的重试和多条流共用一个传输ID.
+func withTransferID(ctx context.Context) (context.Context, string) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if values := md.Get(common.TransferIDKey); len(values) > 0 {
+		return ctx, values[0]
+	}
+	id := common.NewTransferID()
+	return metadata.AppendToOutgoingContext(ctx, common.TransferIDKey, id), id
+}
+
+// unaryLoggingInterceptor 返回为每个一元请求记录一条日志的拦截器.
+func (cli *GRPCStreamClient) unaryLoggingInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, id := withTransferID(ctx)
+		started := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		cli.logRequest(err, status.Code(err).String()).
+			Str("transfer_id", id).
+			Str("peer", cc.Target()).
+			Str("method", method[strings.LastIndex(method, "/")+1:]).
+			Dur("duration", time.Since(started)).
+			Msg("request finished")
+		return err
+	}
+}
+
+// streamLoggingInterceptor 返回为每条流记录一条日志的拦截器, 包括传输的文件, 文件内容字节数和结果.
+func (cli *GRPCStreamClient) streamLoggingInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, id := withTransferID(ctx)
+		ls := &loggedStream{
+			server:   desc.ServerStreams,
+			started:  time.Now(),
+			finished: make(chan struct{}),
+		}
+		ls.finish = func(err error) {
+			// ctx may end while another goroutine sends or receives
+			ls.mu.Lock()
+			file, bytes, st := ls.file, ls.bytes, ls.status
+			ls.mu.Unlock()
+
+			code := status.Code(err).String()
+			if err == nil && st != nil {
+				code = strings.TrimPrefix(st.GetCode().String(), "STATUS_CODE_")
+			}
+			cli.logRequest(err, code).
+				Str("transfer_id", id).
+				Str("peer", cc.Target()).
+				Str("method", method[strings.LastIndex(method, "/")+1:]).
+				Str("file", file).
+				Int64("bytes", bytes).
+				Dur("duration", time.Since(ls.started)).
+				Msg("stream finished")
+		}
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			ls.done(err)
+			return nil, err
+		}
+		ls.ClientStream = stream
+		go func() {
+			// streams given up without a final RecvMsg end when ctx is done
+			select {
+			case <-ctx.Done():
+				ls.done(status.FromContextError(ctx.Err()).Err())
+			case <-ls.finished:
+			}
+		}()
+		return ls, nil
+	}
+}
+
+func (cli *GRPCStreamClient) logRequest(err error, code string) *zerolog.Event {
+	if err != nil {
+		return cli.logger.Error().Err(err).Str("status", code)
+	}
+	if code != "OK" {
+		return cli.logger.Warn().Str("status", code)
+	}
+	return cli.logger.Info().Str("status", code)
+}
+
+// loggedStream 记下流传输的文件, 文件内容字节数和上传结果, 流结束时记录一条日志.
+// 流在第一次出现以下情况时结束: 收发出错, 收到最终响应或者io.EOF, ctx结束.
+type loggedStream struct {
+	grpc.ClientStream
+	// server 是否为服务端流, 服务端流在收到io.EOF时结束, 客户端流在收到响应时结束
+	server  bool
+	started time.Time
+	mu      sync.Mutex
+	file    string
+	bytes   int64
+	status  *api.UploadStatus
+	once    sync.Once
+	finish  func(err error)
+	// finished 在记录日志后关闭
+	finished chan struct{}
+}
+
+func (s *loggedStream) done(err error) {
+	s.once.Do(func() {
+		s.finish(err)
+		close(s.finished)
+	})
+}
+
+func (s *loggedStream) SendMsg(m interface{}) error {
+	s.mu.Lock()
+	switch msg := m.(type) {
+	case *api.FileChunk:
+		if msg.GetMeta() != nil {
+			s.file = msg.GetMeta().GetName()
+		}
+		s.bytes += int64(len(msg.GetContent()))
+	case *api.DownloadRequest:
+		s.file = msg.GetName()
+	}
+	s.mu.Unlock()
+	err := s.ClientStream.SendMsg(m)
+	if err != nil && err != io.EOF {
+		// io.EOF means the stream has ended, its status comes from RecvMsg
+		s.done(err)
+	}
+	return err
+}
+
+func (s *loggedStream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	if err != nil {
+		s.done(err)
+	}
+	return err
+}
+
+func (s *loggedStream) RecvMsg(m interface{}) error {
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		if err == io.EOF {
+			s.done(nil)
+		} else {
+			s.done(err)
+		}
+		return err
+	}
+	s.mu.Lock()
+	switch msg := m.(type) {
+	case *api.FileChunk:
+		s.bytes += int64(len(msg.GetContent()))
+	case *api.UploadStatus:
+		s.status = msg
+	}
+	s.mu.Unlock()
+	if !s.server {
+		s.done(nil)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/net/context"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+// logBuffer 收集并发写入的日志.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// streamLogs 返回已经记录的流结束日志.
+func (b *logBuffer) streamLogs(t *testing.T) []map[string]interface{} {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var logs []map[string]interface{}
+	for _, line := range bytes.Split(b.buf.Bytes(), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		entry := make(map[string]interface{})
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("invalid log line %s: %v", line, err)
+		}
+		if entry["message"] == "stream finished" {
+			logs = append(logs, entry)
+		}
+	}
+	return logs
+}
+
+func TestStreamLoggingFinishes(t *testing.T) {
+	dir := t.TempDir()
+	addr := startServer(t, dir)
+	_, data := writeRandomFile(t, dir, "log.bin", 64<<10)
+
+	tests := []struct {
+		name string
+		// run 打开一条流并以某种方式结束它
+		run    func(ctx context.Context, cancel context.CancelFunc, client api.GrpcStreamServiceClient) error
+		status string
+		bytes  float64
+	}{
+		{
+			name: "upload finished",
+			run: func(ctx context.Context, cancel context.CancelFunc, client api.GrpcStreamServiceClient) error {
+				stream, err := client.Upload(ctx)
+				if err != nil {
+					return err
+				}
+				stream.Send(&api.FileChunk{Data: &api.FileChunk_Meta{Meta: &api.FileMeta{Name: "a.bin", Size: int64(len(data))}}}) // nolint
+				stream.Send(&api.FileChunk{Data: &api.FileChunk_Content{Content: data}})                                           // nolint
+				_, err = stream.CloseAndRecv()
+				return err
+			},
+			status: "OK",
+			bytes:  float64(len(data)),
+		},
+		{
+			name: "upload canceled without a final receive",
+			run: func(ctx context.Context, cancel context.CancelFunc, client api.GrpcStreamServiceClient) error {
+				stream, err := client.Upload(ctx)
+				if err != nil {
+					return err
+				}
+				stream.Send(&api.FileChunk{Data: &api.FileChunk_Meta{Meta: &api.FileMeta{Name: "b.bin", Size: int64(len(data))}}}) // nolint
+				stream.Send(&api.FileChunk{Data: &api.FileChunk_Content{Content: data[:1024]}})                                    // nolint
+				cancel()
+				return nil
+			},
+			status: "Canceled",
+			bytes:  1024,
+		},
+		{
+			name: "download closed and canceled after the first chunk",
+			run: func(ctx context.Context, cancel context.CancelFunc, client api.GrpcStreamServiceClient) error {
+				stream, err := client.Download(ctx, &api.DownloadRequest{Name: "a.bin", ChunkSize: 1024})
+				if err != nil {
+					return err
+				}
+				if err = stream.CloseSend(); err != nil {
+					return err
+				}
+				if _, err = stream.Recv(); err != nil {
+					return err
+				}
+				cancel()
+				return nil
+			},
+			status: "Canceled",
+		},
+		{
+			name: "deadline exceeded",
+			run: func(ctx context.Context, cancel context.CancelFunc, client api.GrpcStreamServiceClient) error {
+				ctx, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+				defer cancel()
+				if _, err := client.Upload(ctx); err != nil {
+					return err
+				}
+				<-ctx.Done()
+				return nil
+			},
+			status: "DeadlineExceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, err := NewGRPCStreamClient(&GRPCStreamClientCfg{Address: addr, ChunkSize: 64 << 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cli.Close()
+			logs := &logBuffer{}
+			cli.logger = zerolog.New(logs)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if err = tt.run(ctx, cancel, cli.client); err != nil {
+				t.Fatal(err)
+			}
+
+			var entries []map[string]interface{}
+			for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+				if entries = logs.streamLogs(t); len(entries) > 0 || time.Now().After(deadline) {
+					break
+				}
+			}
+			if len(entries) != 1 {
+				t.Fatalf("logged %d stream lines, want 1", len(entries))
+			}
+			if entries[0]["status"] != tt.status {
+				t.Errorf("logged status %v, want %s", entries[0]["status"], tt.status)
+			}
+			if tt.bytes > 0 && entries[0]["bytes"] != tt.bytes {
+				t.Errorf("logged %v bytes, want %v", entries[0]["bytes"], tt.bytes)
+			}
+		})
+	}
+}
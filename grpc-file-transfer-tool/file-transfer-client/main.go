@@ -4,8 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/urfave/cli"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
 )
 
 func main() {
@@ -35,9 +39,194 @@ func main() {
 					Name:  "cert",
 					Usage: "root cert file",
 				},
+				&cli.StringFlag{
+					Name:  "client-cert",
+					Usage: "client cert file, used for mutual tls",
+				},
+				&cli.StringFlag{
+					Name:  "client-key",
+					Usage: "client private key file, used for mutual tls",
+				},
+				&cli.StringFlag{
+					Name:  "server-name",
+					Usage: "server name used to verify the server's cert, defaults to the host of --addr",
+				},
+				&cli.StringFlag{
+					Name:  "token",
+					Usage: "bearer token sent with every request",
+				},
+				&cli.StringFlag{
+					Name:  "token-file",
+					Usage: "file holding the bearer token sent with every request",
+				},
+				&cli.StringFlag{
+					Name:  "file",
+					Usage: "file, directory (uploaded recursively) or quoted glob pattern to upload",
+				},
+				&cli.IntFlag{
+					Name:  "parallel",
+					Usage: "number of files uploaded concurrently when uploading a directory or glob",
+					Value: 4,
+				},
+				&cli.IntFlag{
+					Name:  "streams",
+					Usage: "number of concurrent grpc streams used to upload a single file",
+					Value: 1,
+				},
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the transfer statistics as json",
+				},
+				&cli.BoolTFlag{
+					Name:  "progress",
+					Usage: "show a progress bar, or periodic log lines when stdout is not a terminal, enabled by default",
+				},
+				&cli.StringFlag{
+					Name:  "limit",
+					Usage: "bandwidth limit of every single stream, e.g. 50MB/s, unlimited by default",
+				},
+				&cli.StringFlag{
+					Name:  "checksum",
+					Usage: "checksum algorithm used to verify the upload, one of sha256, blake3, crc32c, none",
+					Value: "sha256",
+				},
+				&cli.BoolTFlag{
+					Name:  "resume",
+					Usage: "resume an interrupted upload of the same file, enabled by default",
+				},
+				&cli.DurationFlag{
+					Name:  "max-wait",
+					Usage: "how long to keep retrying when the server is too busy to accept the upload, 0 to fail at once",
+					Value: 2 * time.Minute,
+				},
+				&cli.IntFlag{
+					Name:  "retries",
+					Usage: "max attempts of every upload, including the first one, 1 to never retry",
+					Value: 4,
+				},
+				&cli.DurationFlag{
+					Name:  "retry-backoff",
+					Usage: "backoff before the first retry, doubled on every further retry and randomized by up to a half",
+					Value: 500 * time.Millisecond,
+				},
+				&cli.DurationFlag{
+					Name:  "retry-max-backoff",
+					Usage: "max backoff between two retries",
+					Value: 30 * time.Second,
+				},
+				&cli.StringFlag{
+					Name:  "retry-codes",
+					Usage: "comma separated grpc status codes worth a retry",
+					Value: "unavailable,aborted,deadline_exceeded",
+				},
+				&cli.StringFlag{
+					Name:  "trace-exporter",
+					Usage: "export opentelemetry spans to stdout, otlp (configured by OTEL_EXPORTER_OTLP_* env) or file:<path>",
+				},
+				&cli.BoolFlag{
+					Name:  "dedup",
+					Usage: "skip the upload when the server already holds the same content, requires a server running with --dedup",
+				},
+				&cli.BoolFlag{
+					Name:  "sync",
+					Usage: "only send what changed since the server's copy of the file (rsync style), implies --streams=1",
+				},
+			},
+		},
+		{
+			Name:   "download",
+			Usage:  "download a file",
+			Action: downloadAction,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "addr",
+					Usage: "grpc server's endpoint, e.g. 127.0.0.1:8999",
+				},
+				&cli.IntFlag{
+					Name:  "chunk",
+					Usage: "chunk size for every single receiving, e.g. 4096",
+					Value: 4096,
+				},
+				&cli.BoolFlag{
+					Name:  "compressed",
+					Usage: "compress the grpc stream or not",
+				},
+				&cli.StringFlag{
+					Name:  "cert",
+					Usage: "root cert file",
+				},
+				&cli.StringFlag{
+					Name:  "client-cert",
+					Usage: "client cert file, used for mutual tls",
+				},
+				&cli.StringFlag{
+					Name:  "client-key",
+					Usage: "client private key file, used for mutual tls",
+				},
+				&cli.StringFlag{
+					Name:  "server-name",
+					Usage: "server name used to verify the server's cert, defaults to the host of --addr",
+				},
+				&cli.StringFlag{
+					Name:  "token",
+					Usage: "bearer token sent with every request",
+				},
+				&cli.StringFlag{
+					Name:  "token-file",
+					Usage: "file holding the bearer token sent with every request",
+				},
 				&cli.StringFlag{
 					Name:  "file",
-					Usage: "file to upload",
+					Usage: "file to download, relative to the server's storage directory",
+				},
+				&cli.StringFlag{
+					Name:  "out",
+					Usage: "local path or directory to save the file, defaults to the current directory",
+				},
+				&cli.StringFlag{
+					Name:  "limit",
+					Usage: "bandwidth limit of every single stream, e.g. 50MB/s, unlimited by default",
+				},
+				&cli.StringFlag{
+					Name:  "checksum",
+					Usage: "checksum algorithm used to verify the download, one of sha256, blake3, crc32c, none",
+					Value: "sha256",
+				},
+			},
+		},
+		{
+			Name:   "health",
+			Usage:  "check whether the server is serving, exits with 1 if not",
+			Action: healthAction,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "addr",
+					Usage: "grpc server's endpoint, e.g. 127.0.0.1:8999",
+				},
+				&cli.StringFlag{
+					Name:  "cert",
+					Usage: "root cert file",
+				},
+				&cli.StringFlag{
+					Name:  "client-cert",
+					Usage: "client cert file, used for mutual tls",
+				},
+				&cli.StringFlag{
+					Name:  "client-key",
+					Usage: "client private key file, used for mutual tls",
+				},
+				&cli.StringFlag{
+					Name:  "server-name",
+					Usage: "server name used to verify the server's cert, defaults to the host of --addr",
+				},
+				&cli.StringFlag{
+					Name:  "service",
+					Usage: "service to check, the whole server by default",
+				},
+				&cli.DurationFlag{
+					Name:  "timeout",
+					Usage: "how long to wait for the answer",
+					Value: 5 * time.Second,
 				},
 			},
 		},
@@ -53,26 +242,178 @@ func uploadAction(ctx *cli.Context) (err error) {
 		chunkSize  = ctx.Int("chunk")
 		compressed = ctx.Bool("compressed")
 		rootCert   = ctx.String("cert")
+		clientCert = ctx.String("client-cert")
+		clientKey  = ctx.String("client-key")
+		serverName = ctx.String("server-name")
+		token      = ctx.String("token")
+		tokenFile  = ctx.String("token-file")
 		file       = ctx.String("file")
+		checksum   = ctx.String("checksum")
+		limit      = ctx.String("limit")
+		resume     = ctx.BoolT("resume")
+		parallel   = ctx.Int("parallel")
+		streams    = ctx.Int("streams")
+		asJSON     = ctx.Bool("json")
+		progress   = ctx.BoolT("progress")
+		maxWait    = ctx.Duration("max-wait")
+		retry      = DefaultRetryPolicy()
+		exporter   = ctx.String("trace-exporter")
+		dedup      = ctx.Bool("dedup")
+		sync       = ctx.Bool("sync")
 	)
 
+	rateLimit, err := common.ParseRate(limit)
+	if err != nil {
+		panic(err)
+	}
+	retry.MaxAttempts = ctx.Int("retries")
+	retry.InitialBackoff = ctx.Duration("retry-backoff")
+	retry.MaxBackoff = ctx.Duration("retry-max-backoff")
+	if retry.RetryableCodes, err = ParseRetryableCodes(ctx.String("retry-codes")); err != nil {
+		panic(err)
+	}
+
 	cli, err := NewGRPCStreamClient(&GRPCStreamClientCfg{
 		Address:    address,
 		ChunkSize:  chunkSize,
 		Compressed: compressed,
 		RootCert:   rootCert,
+		ClientCert: clientCert,
+		ClientKey:  clientKey,
+		ServerName: serverName,
+		Token:      token,
+		TokenFile:  tokenFile,
+		Checksum:   checksum,
+		RateLimit:  rateLimit,
+		Resume:     resume,
+
+		MaxAdmissionWait: maxWait,
+		Retry:            retry,
+		TraceExporter:    exporter,
+		Dedup:            dedup,
+		Sync:             sync,
 	})
 	if err != nil {
 		panic(err)
 	}
 	defer cli.Close()
 
-	stat, err := cli.UploadFile(context.Background(), file)
+	var reporter *progressReporter
+	if progress {
+		reporter = newProgressReporter(cli.logger)
+		cli.OnProgress(reporter.Update)
+	}
+
+	if fi, serr := os.Stat(file); serr == nil && fi.Mode().IsRegular() {
+		stat, err := cli.UploadFileParallel(context.Background(), file, streams)
+		reporter.Finish()
+		if err != nil {
+			panic(err)
+		}
+
+		printStats(file, chunkSize, streams, stat, asJSON)
+
+		return nil
+	}
+
+	summary, err := cli.UploadFiles(context.Background(), file, parallel)
+	reporter.Finish()
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Printf("used %.2f secs to upload '%s', while chunk size = %d\n", stat.FinishedAt.Sub(stat.StartedAt).Seconds(), file, chunkSize)
+	printSummary(file, chunkSize, parallel, summary, asJSON)
+	if len(summary.Failures) > 0 {
+		return fmt.Errorf("%d of %d files failed to upload", len(summary.Failures), summary.Files)
+	}
+
+	return
+}
 
+func downloadAction(ctx *cli.Context) (err error) {
+	var (
+		address    = ctx.String("addr")
+		chunkSize  = ctx.Int("chunk")
+		compressed = ctx.Bool("compressed")
+		rootCert   = ctx.String("cert")
+		clientCert = ctx.String("client-cert")
+		clientKey  = ctx.String("client-key")
+		serverName = ctx.String("server-name")
+		token      = ctx.String("token")
+		tokenFile  = ctx.String("token-file")
+		file       = ctx.String("file")
+		out        = ctx.String("out")
+		checksum   = ctx.String("checksum")
+		limit      = ctx.String("limit")
+	)
+
+	rateLimit, err := common.ParseRate(limit)
+	if err != nil {
+		panic(err)
+	}
+
+	cli, err := NewGRPCStreamClient(&GRPCStreamClientCfg{
+		Address:    address,
+		ChunkSize:  chunkSize,
+		Compressed: compressed,
+		RootCert:   rootCert,
+		ClientCert: clientCert,
+		ClientKey:  clientKey,
+		ServerName: serverName,
+		Token:      token,
+		TokenFile:  tokenFile,
+		Checksum:   checksum,
+		RateLimit:  rateLimit,
+	})
+	if err != nil {
+		panic(err)
+	}
+	defer cli.Close()
+
+	stat, err := cli.DownloadFile(context.Background(), file, out)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("used %.2f secs to download '%s', while chunk size = %d\n", stat.FinishedAt.Sub(stat.StartedAt).Seconds(), file, chunkSize)
+
+	return
+}
+
+func healthAction(ctx *cli.Context) (err error) {
+	var (
+		address    = ctx.String("addr")
+		rootCert   = ctx.String("cert")
+		clientCert = ctx.String("client-cert")
+		clientKey  = ctx.String("client-key")
+		serverName = ctx.String("server-name")
+		service    = ctx.String("service")
+		timeout    = ctx.Duration("timeout")
+	)
+
+	client, err := NewGRPCStreamClient(&GRPCStreamClientCfg{
+		Address:    address,
+		ChunkSize:  common.MaxChunkSize,
+		RootCert:   rootCert,
+		ClientCert: clientCert,
+		ClientKey:  clientKey,
+		ServerName: serverName,
+	})
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+	defer client.Close()
+
+	c, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	st, err := client.CheckHealth(c, service)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	fmt.Println(st)
+	if st != healthpb.HealthCheckResponse_SERVING {
+		return cli.NewExitError("", 1)
+	}
 	return
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// progressBarWidth 进度条宽度
+	progressBarWidth = 30
+	// progressBarInterval 终端进度条刷新间隔
+	progressBarInterval = 200 * time.Millisecond
+	// progressLogInterval 非终端时输出进度日志的间隔
+	progressLogInterval = 5 * time.Second
+)
+
+// progressReporter 汇总一个或多个文件的传输进度, 输出到终端进度条或者周期性的日志.
+type progressReporter struct {
+	mu        sync.Mutex
+	out       io.Writer
+	logger    zerolog.Logger
+	tty       bool
+	files     map[string]int64
+	totals    map[string]int64
+	initial   int64
+	startedAt time.Time
+	printedAt time.Time
+}
+
+// newProgressReporter 返回进度汇报器, 标准输出不是终端时退化为日志输出.
+func newProgressReporter(logger zerolog.Logger) *progressReporter {
+	return &progressReporter{
+		out:       os.Stdout,
+		logger:    logger,
+		tty:       isTerminal(os.Stdout),
+		files:     make(map[string]int64),
+		totals:    make(map[string]int64),
+		initial:   -1,
+		startedAt: time.Now(),
+	}
+}
+
+// isTerminal 判断文件是否为终端.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Update 实现ProgressFunc.
+func (p *progressReporter) Update(name string, transferred, total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.files[name] = transferred
+	p.totals[name] = total
+	if p.initial < 0 {
+		// bytes that were already on the server do not count towards the rate
+		p.initial = transferred
+	}
+
+	interval := progressLogInterval
+	if p.tty {
+		interval = progressBarInterval
+	}
+	if done, all := p.sum(); time.Since(p.printedAt) < interval && done < all {
+		return
+	}
+	p.printedAt = time.Now()
+	p.print()
+}
+
+// Finish 输出最终进度, 终端进度条会换行以免被后续输出覆盖.
+func (p *progressReporter) Finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.tty && !p.printedAt.IsZero() {
+		fmt.Fprintln(p.out) // nolint
+	}
+}
+
+// sum 返回所有文件已传输的字节数和总字节数.
+func (p *progressReporter) sum() (done, total int64) {
+	for name, n := range p.files {
+		done += n
+		total += p.totals[name]
+	}
+	return
+}
+
+func (p *progressReporter) print() {
+	done, total := p.sum()
+	elapsed := time.Since(p.startedAt).Seconds()
+
+	var (
+		percent float64
+		rate    float64
+		eta     = "--"
+	)
+	if total > 0 {
+		percent = float64(done) / float64(total) * 100
+	} else {
+		percent = 100
+	}
+	if elapsed > 0 && p.initial >= 0 {
+		rate = float64(done-p.initial) / elapsed
+	}
+	if rate > 0 {
+		eta = time.Duration(float64(total-done) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+
+	if !p.tty {
+		p.logger.Info().Int64("bytes", done).Int64("total", total).Str("percent", fmt.Sprintf("%.1f%%", percent)).
+			Str("rate", humanBytes(rate)+"/s").Str("eta", eta).Msg("upload progress")
+		return
+	}
+
+	filled := int(percent / 100 * progressBarWidth)
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+	fmt.Fprintf(p.out, "\r[%s] %5.1f%%  %s/%s  %s/s  ETA %s\033[K", // nolint
+		bar, percent, humanBytes(float64(done)), humanBytes(float64(total)), humanBytes(rate), eta)
+}
+
+// humanBytes 将字节数格式化为便于阅读的形式.
+func humanBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", n, units[i])
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// statsReport 单个文件上传统计的输出格式
+type statsReport struct {
+	File            string  `json:"file"`
+	ChunkSize       int     `json:"chunk_size"`
+	Streams         int     `json:"streams"`
+	DurationSecs    float64 `json:"duration_secs"`
+	BytesSent       int64   `json:"bytes_sent"`
+	BytesDedup      int64   `json:"bytes_deduplicated"`
+	BytesSaved      int64   `json:"bytes_saved"`
+	Chunks          int64   `json:"chunks"`
+	WireBytes       int64   `json:"wire_bytes"`
+	ThroughputMBps  float64 `json:"throughput_mb_per_sec"`
+	ChunkLatencyP50 float64 `json:"chunk_latency_p50_ms"`
+	ChunkLatencyP90 float64 `json:"chunk_latency_p90_ms"`
+	ChunkLatencyP99 float64 `json:"chunk_latency_p99_ms"`
+	TimeToAckMs     float64 `json:"time_to_ack_ms"`
+	Attempts        int     `json:"attempts"`
+	TransferID      string  `json:"transfer_id"`
+}
+
+// summaryReport 批量上传统计的输出格式
+type summaryReport struct {
+	Pattern      string            `json:"pattern"`
+	ChunkSize    int               `json:"chunk_size"`
+	Parallel     int               `json:"parallel"`
+	DurationSecs float64           `json:"duration_secs"`
+	Files        int               `json:"files"`
+	Succeeded    int               `json:"succeeded"`
+	Bytes        int64             `json:"bytes"`
+	Attempts     int               `json:"attempts"`
+	Failures     map[string]string `json:"failures,omitempty"`
+}
+
+// printStats 以文本或者json格式输出单个文件的上传统计.
+func printStats(file string, chunkSize, streams int, stat *common.Stats, asJSON bool) {
+	secs := stat.Duration().Seconds()
+	report := statsReport{
+		File:            file,
+		ChunkSize:       chunkSize,
+		Streams:         streams,
+		DurationSecs:    secs,
+		BytesSent:       stat.BytesSent,
+		BytesDedup:      stat.BytesDeduplicated,
+		BytesSaved:      stat.BytesSaved,
+		Chunks:          stat.Chunks,
+		WireBytes:       stat.WireBytes,
+		ChunkLatencyP50: millis(stat.ChunkLatency.Percentile(50)),
+		ChunkLatencyP90: millis(stat.ChunkLatency.Percentile(90)),
+		ChunkLatencyP99: millis(stat.ChunkLatency.Percentile(99)),
+		TimeToAckMs:     millis(stat.TimeToAck),
+		Attempts:        stat.Attempts,
+		TransferID:      stat.TransferID,
+	}
+	if secs > 0 {
+		report.ThroughputMBps = float64(stat.BytesSent) / secs / (1 << 20)
+	}
+	if asJSON {
+		printJSON(report)
+		return
+	}
+
+	fmt.Printf("used %.2f secs to upload '%s', while chunk size = %d, streams = %d\n", secs, file, chunkSize, streams)
+	fmt.Printf("  bytes sent:    %d (%.2f MB/s)\n", report.BytesSent, report.ThroughputMBps)
+	if report.BytesDedup > 0 {
+		fmt.Printf("  deduplicated:  %d (already on the server, upload skipped)\n", report.BytesDedup)
+	}
+	if report.BytesSaved > 0 {
+		fmt.Printf("  bytes saved:   %d (unchanged blocks reused from the server's copy)\n", report.BytesSaved)
+	}
+	fmt.Printf("  chunks:        %d\n", report.Chunks)
+	fmt.Printf("  wire bytes:    %d\n", report.WireBytes)
+	fmt.Printf("  chunk latency: p50 %.3fms, p90 %.3fms, p99 %.3fms\n", report.ChunkLatencyP50, report.ChunkLatencyP90, report.ChunkLatencyP99)
+	fmt.Printf("  time to ack:   %.3fms\n", report.TimeToAckMs)
+	fmt.Printf("  attempts:      %d\n", report.Attempts)
+	fmt.Printf("  transfer id:   %s\n", report.TransferID)
+}
+
+// printSummary 以文本或者json格式输出批量上传统计.
+func printSummary(pattern string, chunkSize, parallel int, summary *common.Summary, asJSON bool) {
+	secs := summary.FinishedAt.Sub(summary.StartedAt).Seconds()
+	if asJSON {
+		report := summaryReport{
+			Pattern:      pattern,
+			ChunkSize:    chunkSize,
+			Parallel:     parallel,
+			DurationSecs: secs,
+			Files:        summary.Files,
+			Succeeded:    summary.Succeeded,
+			Bytes:        summary.Bytes,
+			Attempts:     summary.Attempts,
+		}
+		if len(summary.Failures) > 0 {
+			report.Failures = make(map[string]string, len(summary.Failures))
+			for name, err := range summary.Failures {
+				report.Failures[name] = err.Error()
+			}
+		}
+		printJSON(report)
+		return
+	}
+
+	fmt.Printf("used %.2f secs to upload %d/%d files (%d bytes, %d attempts) from '%s', while chunk size = %d, parallel = %d\n",
+		secs, summary.Succeeded, summary.Files, summary.Bytes, summary.Attempts, pattern, chunkSize, parallel)
+	names := make([]string, 0, len(summary.Failures))
+	for name := range summary.Failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("failed to upload '%s': %v\n", name, summary.Failures[name])
+	}
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v) // nolint
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
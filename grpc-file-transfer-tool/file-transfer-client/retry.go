@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy 上传失败时的重试策略
+type RetryPolicy struct {
+	// MaxAttempts 最多尝试的次数, 包括第一次, 小于等于1表示不重试
+	MaxAttempts int `json:"max_attempts"`
+	// InitialBackoff 第一次重试前的等待时间, 之后每次乘以Multiplier, 实际等待时间在[backoff/2, backoff)之间随机
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	// MaxBackoff 重试前等待时间的上限
+	MaxBackoff time.Duration `json:"max_backoff"`
+	Multiplier float64       `json:"multiplier"`
+	// RetryableCodes 允许重试的gRPC状态码
+	RetryableCodes []codes.Code `json:"retryable_codes"`
+}
+
+// DefaultRetryPolicy 返回默认的重试策略.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		RetryableCodes: []codes.Code{codes.Unavailable, codes.Aborted, codes.DeadlineExceeded},
+	}
+}
+
+// ParseRetryableCodes 解析逗号分隔的gRPC状态码, 例如"unavailable,aborted".
+func ParseRetryableCodes(s string) ([]codes.Code, error) {
+	var retryable []codes.Code
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		var c codes.Code
+		if err := c.UnmarshalJSON([]byte(`"` + name + `"`)); err != nil {
+			return nil, errors.Errorf("unknown grpc status code '%s'", name)
+		}
+		retryable = append(retryable, c)
+	}
+	return retryable, nil
+}
+
+// retryable 判断err是否允许重试.
+func (p *RetryPolicy) retryable(err error) bool {
+	code := status.Code(errors.Cause(err))
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// backoff 返回第retries次重试前的等待时间, retries从0开始.
+func (p *RetryPolicy) backoff(retries int) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	for i := 0; i < retries && backoff < float64(p.MaxBackoff); i++ {
+		backoff *= p.Multiplier
+	}
+	if backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return time.Duration(backoff/2 + jitterRand.Float64()*backoff/2)
+}
+
+// withRetry 调用fn发起上传, 失败时按照policy退避重试, 服务端繁忙时按retry-after等待重试, 返回尝试的次数.
+// fn需要把传入的CallOption用于发起的调用, 以便拿到服务端的trailer.
+func (cli *GRPCStreamClient) withRetry(ctx context.Context, name string, policy *RetryPolicy, fn func(opt grpc.CallOption) error) (int, error) {
+	var (
+		attempts int
+		retries  int
+		deadline = time.Now().Add(cli.cfg.MaxAdmissionWait)
+	)
+	for {
+		attempts++
+		var trailer metadata.MD
+		err := fn(grpc.Trailer(&trailer))
+		if err == nil || ctx.Err() != nil {
+			return attempts, err
+		}
+
+		wait, busy := retryAfter(err, trailer)
+		switch {
+		case busy:
+			// waiting for a free slot does not use up attempts
+			if time.Now().Add(wait).After(deadline) {
+				return attempts, err
+			}
+			cli.logger.Warn().Str("file", name).Int("attempt", attempts).Msgf("server is busy, retry in %s", wait)
+		case policy != nil && retries+1 < policy.MaxAttempts && policy.retryable(err):
+			wait = policy.backoff(retries)
+			retries++
+			cli.logger.Warn().Err(err).Str("file", name).Int("attempt", attempts).Msgf("upload failed, retry in %s", wait)
+		default:
+			return attempts, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempts, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+// writeRandomFile 在dir下创建n字节的随机文件, 返回路径和内容.
+func writeRandomFile(t *testing.T, dir, name string, n int) (string, []byte) {
+	t.Helper()
+	fn := filepath.Join(dir, name)
+	data := make([]byte, n)
+	rand.Read(data) // nolint
+	if err := ioutil.WriteFile(fn, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fn, data
+}
+
+// startAttempt 模拟一次中途停止的可续传上传: 发送fn的元信息和sent, 等到服务端持久化了这些数据后返回流.
+func startAttempt(t *testing.T, ctx context.Context, cli *GRPCStreamClient, fn string, sent []byte) api.GrpcStreamService_UploadClient {
+	t.Helper()
+	fd, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := fileMeta(fd)
+	fd.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.SessionId = sessionID(fn, meta)
+	stream, err := cli.client.Upload(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Send(&api.FileChunk{Data: &api.FileChunk_Meta{Meta: meta}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Send(&api.FileChunk{Data: &api.FileChunk_Content{Content: sent}}); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		resp, err := cli.client.QueryUploadOffset(context.Background(), &api.UploadSession{SessionId: meta.SessionId})
+		if err == nil && resp.GetOffset() == int64(len(sent)) {
+			return stream
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server did not receive the earlier attempt")
+		}
+	}
+}
+
+// TestUploadRetriesBusySession 上一次尝试的流还占用着会话时, 服务端以Aborted拒绝, 客户端退避后续传成功.
+func TestUploadRetriesBusySession(t *testing.T) {
+	dir := t.TempDir()
+	addr := startServer(t, dir)
+
+	fn, data := writeRandomFile(t, dir, "busy.bin", 1<<20)
+
+	retry := DefaultRetryPolicy()
+	retry.MaxAttempts = 10
+	retry.InitialBackoff = 200 * time.Millisecond
+	retry.MaxBackoff = time.Second
+	cli, err := NewGRPCStreamClient(&GRPCStreamClientCfg{
+		Address:   addr,
+		ChunkSize: 64 << 10,
+		Checksum:  "sha256",
+		Resume:    true,
+		Retry:     retry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	// an earlier attempt whose stream the server still holds
+	holdCtx, release := context.WithCancel(context.Background())
+	defer release()
+	startAttempt(t, holdCtx, cli, fn, data[:64<<10])
+	time.AfterFunc(500*time.Millisecond, release)
+
+	stats, err := cli.UploadFile(context.Background(), fn)
+	if err != nil {
+		t.Fatalf("upload was not retried until the session was free: %v", err)
+	}
+	if stats.Attempts < 2 {
+		t.Errorf("upload took %d attempts, want the busy session to be retried", stats.Attempts)
+	}
+	stored, err := ioutil.ReadFile(filepath.Join(dir, "storage", "busy.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, data) {
+		t.Error("stored file differs from the uploaded file")
+	}
+}
+
+// TestUploadResumesAfterShortStream 客户端因为本地读错误提前关闭流时, 服务端保留已收到的数据, 下一次上传从该处续传.
+func TestUploadResumesAfterShortStream(t *testing.T) {
+	dir := t.TempDir()
+	addr := startServer(t, dir)
+	fn, data := writeRandomFile(t, dir, "short.bin", 1<<20)
+
+	cli, err := NewGRPCStreamClient(&GRPCStreamClientCfg{
+		Address:   addr,
+		ChunkSize: 64 << 10,
+		Checksum:  "sha256",
+		Resume:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	const sent = 128 << 10
+	stream := startAttempt(t, context.Background(), cli, fn, data[:sent])
+	if _, err = stream.CloseAndRecv(); status.Code(err) != codes.Aborted {
+		t.Fatalf("short stream returned %v, want %v", err, codes.Aborted)
+	}
+
+	stats, err := cli.UploadFile(context.Background(), fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.BytesSent != int64(len(data)-sent) {
+		t.Errorf("sent %d bytes, want the %d bytes after the short stream", stats.BytesSent, len(data)-sent)
+	}
+	stored, err := ioutil.ReadFile(filepath.Join(dir, "storage", "short.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, data) {
+		t.Error("stored file differs from the uploaded file")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// tokenCredentials 在每个请求的metadata中携带bearer令牌.
+type tokenCredentials struct {
+	token string
+	// secure 为true时只允许通过TLS连接发送令牌
+	secure bool
+}
+
+// GetRequestMetadata 实现credentials.PerRPCCredentials.
+func (c tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+// RequireTransportSecurity 实现credentials.PerRPCCredentials.
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return c.secure
+}
+
+// loadToken 返回配置的令牌, Token和TokenFile最多只能配置一个.
+func loadToken(cfg *GRPCStreamClientCfg) (string, error) {
+	if cfg.TokenFile == "" {
+		return cfg.Token, nil
+	}
+	if cfg.Token != "" {
+		return "", errors.Errorf("token and token_file must not be specified together")
+	}
+	token, err := ioutil.ReadFile(cfg.TokenFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read token-file '%s'", cfg.TokenFile)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
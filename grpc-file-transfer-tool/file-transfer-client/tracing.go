@@ -0,0 +1,50 @@
+package main
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// traceUnaryClientInterceptor 返回把当前span写入metadata的一元拦截器, 使服务端span成为其子span.
+func traceUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(common.InjectTraceContext(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// traceStreamClientInterceptor 返回把当前span写入metadata的流拦截器, 使服务端span成为其子span.
+func traceStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(common.InjectTraceContext(ctx), desc, cc, method, opts...)
+	}
+}
+
+// endSpan 结束span, err不为nil时把span标记为失败.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceAttempt 在一次上传尝试的span中调用fn.
+func (cli *GRPCStreamClient) traceAttempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, span := cli.tracer.Start(ctx, "attempt")
+	err := fn(ctx)
+	endSpan(span, err)
+	return err
+}
+
+// setOpAttributes 把读取和发送的汇总统计设置到ctx中的span上.
+func setOpAttributes(ctx context.Context, ops ...*common.OpSpans) {
+	var attrs []attribute.KeyValue
+	for _, op := range ops {
+		attrs = append(attrs, op.Attributes()...)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// exportedSpan file导出器写出的span中测试关心的字段
+type exportedSpan struct {
+	Name        string
+	SpanContext struct {
+		TraceID string
+	}
+}
+
+// readSpans 读取file导出器写出的所有span.
+func readSpans(t *testing.T, path string) []exportedSpan {
+	t.Helper()
+	fd, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	var spans []exportedSpan
+	dec := json.NewDecoder(fd)
+	for {
+		var span exportedSpan
+		if err := dec.Decode(&span); err == io.EOF {
+			return spans
+		} else if err != nil {
+			t.Fatalf("failed to parse spans in '%s': %v", path, err)
+		}
+		spans = append(spans, span)
+	}
+}
+
+func spanNames(spans []exportedSpan) map[string]bool {
+	names := make(map[string]bool)
+	for _, span := range spans {
+		names[span.Name] = true
+	}
+	return names
+}
+
+// startServer 编译并启动监听在unix socket上的服务端, 文件存储在dir/storage下, args为额外的命令行参数.
+// 客户端和服务端都是main包, 因此只有客户端运行在测试进程里.
+func startServer(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found, can not build the server")
+	}
+	bin := filepath.Join(dir, "file-transfer-server")
+	if out, err := exec.Command(goBin, "build", "-o", bin, "../file-transfer-server").CombinedOutput(); err != nil {
+		t.Fatalf("failed to build server: %v\n%s", err, out)
+	}
+
+	sock := filepath.Join(dir, "server.sock")
+	cmd := exec.Command(bin, append([]string{
+		"--listen", "unix://" + sock,
+		"--cert=", "--key=",
+		"--storage", filepath.Join(dir, "storage"),
+	}, args...)...)
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill() // nolint
+		cmd.Wait()         // nolint
+	})
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		if _, err = os.Stat(sock); err == nil {
+			return "unix://" + sock
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start listening")
+		}
+	}
+}
+
+func TestUploadTracing(t *testing.T) {
+	dir := t.TempDir()
+	var (
+		clientSpans = filepath.Join(dir, "client.json")
+		serverSpans = filepath.Join(dir, "server.json")
+	)
+	addr := startServer(t, dir, "--trace-exporter", "file:"+serverSpans)
+
+	// record every read and send of the client
+	threshold := common.SlowOpThreshold
+	common.SlowOpThreshold = 0
+	defer func() { common.SlowOpThreshold = threshold }()
+
+	fn := filepath.Join(dir, "traced.bin")
+	data := make([]byte, 256<<10)
+	rand.Read(data) // nolint
+	if err := ioutil.WriteFile(fn, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cli, err := NewGRPCStreamClient(&GRPCStreamClientCfg{
+		Address:   addr,
+		ChunkSize: 64 << 10,
+		Checksum:  "sha256",
+		// chunks arrive far enough apart for the server to record its slow receives
+		RateLimit:     1 << 20,
+		TraceExporter: "file:" + clientSpans,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.UploadFile(context.Background(), fn); err != nil {
+		cli.Close()
+		t.Fatal(err)
+	}
+	cli.Close()
+
+	client := readSpans(t, clientSpans)
+	// the server ends its span right after sending the response
+	var server []exportedSpan
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		if server = readSpans(t, serverSpans); spanNames(server)["Upload"] || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	for _, want := range []string{"UploadFile", "attempt", "read", "send"} {
+		if !spanNames(client)[want] {
+			t.Errorf("client exported no '%s' span", want)
+		}
+	}
+	for _, want := range []string{"Upload", "recv", "fsync", "commit"} {
+		if !spanNames(server)[want] {
+			t.Errorf("server exported no '%s' span", want)
+		}
+	}
+	if len(client) == 0 {
+		t.FailNow()
+	}
+	traceID := client[0].SpanContext.TraceID
+	for _, span := range append(client, server...) {
+		if span.SpanContext.TraceID != traceID {
+			t.Errorf("span '%s' belongs to trace %s, want %s", span.Name, span.SpanContext.TraceID, traceID)
+		}
+	}
+}
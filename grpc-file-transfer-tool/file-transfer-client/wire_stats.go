@@ -0,0 +1,38 @@
+package main
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/stats"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+type wireStatsKey struct{}
+
+// wireStatsHandler 统计每次调用经压缩和编码后实际写到连接上的字节数.
+type wireStatsHandler struct{}
+
+// withWireStats 将统计对象挂到ctx上, 使用该ctx发起的调用会把发送的字节数累加到st.
+func withWireStats(ctx context.Context, st *common.Stats) context.Context {
+	return context.WithValue(ctx, wireStatsKey{}, st)
+}
+
+func (wireStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (wireStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	out, ok := s.(*stats.OutPayload)
+	if !ok {
+		return
+	}
+	if st, ok := ctx.Value(wireStatsKey{}).(*common.Stats); ok {
+		st.AddWireBytes(out.WireLength)
+	}
+}
+
+func (wireStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (wireStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// admissionController 限制全局和每个客户端同时进行的上传数, 超出时在有界队列中等待或者直接拒绝.
+type admissionController struct {
+	maxTotal   int
+	maxClient  int
+	queueSize  int
+	queueWait  time.Duration
+	retryAfter time.Duration
+
+	mu      sync.Mutex
+	active  int
+	clients map[string]int
+	queued  int
+	// released 每次有上传结束时被关闭并替换, 用于唤醒所有排队的上传
+	released chan struct{}
+}
+
+func newAdmissionController(cfg *GrpcStreamServerCfg) *admissionController {
+	return &admissionController{
+		maxTotal:   cfg.MaxConcurrentUploads,
+		maxClient:  cfg.MaxConcurrentUploadsPerClient,
+		queueSize:  cfg.UploadQueueSize,
+		queueWait:  cfg.UploadQueueTimeout,
+		retryAfter: cfg.RetryAfter,
+		clients:    make(map[string]int),
+		released:   make(chan struct{}),
+	}
+}
+
+// admitLocked 有空闲名额时占用名额, 调用方需持有c.mu.
+func (c *admissionController) admitLocked(client string) bool {
+	if c.maxTotal > 0 && c.active >= c.maxTotal {
+		return false
+	}
+	if c.maxClient > 0 && c.clients[client] >= c.maxClient {
+		return false
+	}
+	c.active++
+	c.clients[client]++
+	return true
+}
+
+// acquire 为client的上传占用一个名额, 名额已满时最多排队等待queueWait.
+func (c *admissionController) acquire(ctx context.Context, client string) error {
+	c.mu.Lock()
+	if c.admitLocked(client) {
+		c.mu.Unlock()
+		return nil
+	}
+	if c.queued >= c.queueSize {
+		c.mu.Unlock()
+		return c.reject(ctx, "too many concurrent uploads")
+	}
+	c.queued++
+	defer func() {
+		c.mu.Lock()
+		c.queued--
+		c.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(c.queueWait)
+	defer timer.Stop()
+	for {
+		released := c.released
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+			return c.reject(ctx, "timed out waiting for a free upload slot")
+		case <-released:
+		}
+
+		c.mu.Lock()
+		if c.admitLocked(client) {
+			c.mu.Unlock()
+			return nil
+		}
+	}
+}
+
+// release 归还client的上传名额并唤醒排队的上传.
+func (c *admissionController) release(client string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.active--
+	if c.clients[client]--; c.clients[client] <= 0 {
+		delete(c.clients, client)
+	}
+	close(c.released)
+	c.released = make(chan struct{})
+}
+
+// reject 以Unavailable拒绝上传, 并在trailer中告知客户端多少秒后重试.
+func (c *admissionController) reject(ctx context.Context, reason string) error {
+	seconds := int(math.Ceil(c.retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	grpc.SetTrailer(ctx, metadata.Pairs(common.RetryAfterKey, fmt.Sprint(seconds))) // nolint
+	return status.Errorf(codes.Unavailable, "%s, retry after %ds", reason, seconds)
+}
+
+// StreamServerInterceptor 返回限制并发上传数的流拦截器, 需要放在令牌校验之后以便按令牌名字区分客户端.
+func (c *admissionController) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if info.FullMethod != serviceMethodPrefix+"Upload" {
+			return handler(srv, ss)
+		}
+		client := clientName(ss.Context())
+		if err := c.acquire(ss.Context(), client); err != nil {
+			return err
+		}
+		defer c.release(client)
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdmissionController(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  GrpcStreamServerCfg
+		// held 先占用名额的客户端, 每个都必须被立即放行
+		held []string
+		// client 接着申请名额的客户端
+		client string
+		// release 在client排队时归还名额的客户端, 为空时不归还
+		release string
+		// cancel 在client排队时取消请求
+		cancel bool
+		code   codes.Code
+	}{
+		{name: "unlimited", held: []string{"a", "a", "b"}, client: "a", code: codes.OK},
+		{name: "under the limits", cfg: GrpcStreamServerCfg{MaxConcurrentUploads: 3, MaxConcurrentUploadsPerClient: 2},
+			held: []string{"a", "b"}, client: "a", code: codes.OK},
+		{name: "total limit", cfg: GrpcStreamServerCfg{MaxConcurrentUploads: 2},
+			held: []string{"a", "b"}, client: "c", code: codes.Unavailable},
+		{name: "client limit", cfg: GrpcStreamServerCfg{MaxConcurrentUploadsPerClient: 2},
+			held: []string{"a", "a", "b"}, client: "a", code: codes.Unavailable},
+		{name: "client limit of another client", cfg: GrpcStreamServerCfg{MaxConcurrentUploadsPerClient: 2},
+			held: []string{"a", "a", "b"}, client: "b", code: codes.OK},
+		{name: "queued until a slot is free", cfg: GrpcStreamServerCfg{MaxConcurrentUploads: 2, UploadQueueSize: 1, UploadQueueTimeout: 5 * time.Second},
+			held: []string{"a", "b"}, client: "c", release: "a", code: codes.OK},
+		{name: "queued until a slot of the client is free", cfg: GrpcStreamServerCfg{MaxConcurrentUploadsPerClient: 1, UploadQueueSize: 1, UploadQueueTimeout: 5 * time.Second},
+			held: []string{"a", "b"}, client: "a", release: "a", code: codes.OK},
+		{name: "queue timeout", cfg: GrpcStreamServerCfg{MaxConcurrentUploads: 1, UploadQueueSize: 1, UploadQueueTimeout: 50 * time.Millisecond},
+			held: []string{"a"}, client: "b", code: codes.Unavailable},
+		{name: "slot of another client does not help", cfg: GrpcStreamServerCfg{MaxConcurrentUploadsPerClient: 1, UploadQueueSize: 1, UploadQueueTimeout: 100 * time.Millisecond},
+			held: []string{"a", "b"}, client: "a", release: "b", code: codes.Unavailable},
+		{name: "canceled while queued", cfg: GrpcStreamServerCfg{MaxConcurrentUploads: 1, UploadQueueSize: 1, UploadQueueTimeout: 5 * time.Second},
+			held: []string{"a"}, client: "b", cancel: true, code: codes.Canceled},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := newAdmissionController(&tt.cfg)
+			for _, client := range tt.held {
+				if err := c.acquire(context.Background(), client); err != nil {
+					t.Fatalf("acquire for '%s': %v", client, err)
+				}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					cancel()
+				}()
+			}
+			held := tt.held
+			if tt.release != "" {
+				// released while queued, not again at the end
+				for i, client := range held {
+					if client == tt.release {
+						held = append(held[:i:i], held[i+1:]...)
+						break
+					}
+				}
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					c.release(tt.release)
+				}()
+			}
+
+			err := c.acquire(ctx, tt.client)
+			if status.Code(err) != tt.code {
+				t.Fatalf("acquire for '%s' returned %v, want %v", tt.client, err, tt.code)
+			}
+			if err == nil {
+				held = append(held, tt.client)
+			}
+
+			for _, client := range held {
+				c.release(client)
+			}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.active != 0 || len(c.clients) != 0 || c.queued != 0 {
+				t.Errorf("%d active, %d queued and clients %v left after releasing every slot", c.active, c.queued, c.clients)
+			}
+		})
+	}
+}
+
+func TestAdmissionControllerQueueFull(t *testing.T) {
+	c := newAdmissionController(&GrpcStreamServerCfg{
+		MaxConcurrentUploads: 1,
+		UploadQueueSize:      1,
+		UploadQueueTimeout:   5 * time.Second,
+		RetryAfter:           1500 * time.Millisecond,
+	})
+	if err := c.acquire(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	queued := make(chan error, 1)
+	go func() { queued <- c.acquire(context.Background(), "b") }()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		c.mu.Lock()
+		n := c.queued
+		c.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("upload was not queued")
+		}
+	}
+
+	// the queue is full, rejected at once with the retry delay rounded up
+	err := c.acquire(context.Background(), "c")
+	if status.Code(err) != codes.Unavailable || !strings.Contains(err.Error(), "retry after 2s") {
+		t.Errorf("acquire with a full queue returned %v", err)
+	}
+
+	c.release("a")
+	if err = <-queued; err != nil {
+		t.Errorf("queued upload was not admitted: %v", err)
+	}
+	c.release("b")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// serverTLSConfig 根据配置构造TLS配置, 服务端证书由certs提供, 配置了ClientCA时要求并校验客户端证书.
+func serverTLSConfig(cfg *GrpcStreamServerCfg, certs *certReloader) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if cfg.ClientCA != "" {
+		pem, err := ioutil.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read client-ca '%s'", cfg.ClientCA)
+		}
+		tlsCfg.ClientCAs = x509.NewCertPool()
+		if !tlsCfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificate found in client-ca '%s'", cfg.ClientCA)
+		}
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsCfg, nil
+}
+
+// peerCertificate 返回对端经过校验的客户端证书.
+func peerCertificate(ctx context.Context) (*x509.Certificate, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return info.State.VerifiedChains[0][0], true
+}
+
+// authorizeUpload 根据客户端证书的主题判断是否允许上传, 未配置AllowedSubjects时不做限制.
+// 主题既可以按CN匹配, 也可以按完整的DN(例如"CN=ci,O=example")匹配.
+func (gsrv *GrpcStreamServer) authorizeUpload(ctx context.Context) error {
+	if len(gsrv.cfg.AllowedSubjects) == 0 {
+		return nil
+	}
+	cert, ok := peerCertificate(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "a verified client certificate is required to upload")
+	}
+	for _, subject := range gsrv.cfg.AllowedSubjects {
+		if subject == cert.Subject.CommonName || subject == cert.Subject.String() {
+			return nil
+		}
+	}
+	gsrv.logger.Error().Str("subject", cert.Subject.String()).Msg("client is not allowed to upload")
+	return status.Errorf(codes.PermissionDenied, "client '%s' is not allowed to upload", cert.Subject.String())
+}
+
+// clientName 返回调用方的名字, 依次使用令牌名字, 客户端证书的CN和对端主机地址.
+func clientName(ctx context.Context) string {
+	if identity, ok := identityFromContext(ctx); ok {
+		return identity.Name
+	}
+	if cert, ok := peerCertificate(ctx); ok {
+		return cert.Subject.CommonName
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if p.Addr.Network() == "unix" {
+			return "local"
+		}
+		// the same host uses a new port for every connection
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return "unknown"
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// testCA 在测试中签发服务端和客户端证书的CA.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发主题为subject的证书, 返回PEM格式的证书和私钥. 服务端证书对localhost有效.
+func (ca *testCA) issue(t *testing.T, subject pkix.Name, server bool) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.DNSNames = []string{"localhost"}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeServerCert 把ca签发的服务端证书和私钥写入dir, 返回文件路径.
+func writeServerCert(t *testing.T, ca *testCA, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, pkix.Name{CommonName: name}, true)
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// handshake 用serverCfg和clientCfg在本地TCP连接上完成TLS握手, 返回服务端看到的连接状态.
+func handshake(t *testing.T, serverCfg, clientCfg *tls.Config) (tls.ConnectionState, error) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	type result struct {
+		state tls.ConnectionState
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second)) // nolint
+		sc := tls.Server(conn, serverCfg)
+		err = sc.Handshake()
+		done <- result{state: sc.ConnectionState(), err: err}
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), clientCfg)
+	if err == nil {
+		// with tls 1.3 the server checks the client cert after the client is done
+		conn.Close() // nolint
+	}
+	r := <-done
+	return r.state, r.err
+}
+
+func TestMutualTLS(t *testing.T) {
+	var (
+		ca    = newTestCA(t, "test ca")
+		other = newTestCA(t, "other ca")
+		dir   = t.TempDir()
+	)
+	certFile, keyFile := writeServerCert(t, ca, dir, "localhost")
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, ca.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+
+	clientCert := func(ca *testCA, subject pkix.Name) []tls.Certificate {
+		cert, err := tls.X509KeyPair(ca.issue(t, subject, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []tls.Certificate{cert}
+	}
+	ci := pkix.Name{CommonName: "ci", Organization: []string{"example"}}
+
+	tests := []struct {
+		name            string
+		clientCA        string
+		allowedSubjects []string
+		// certs 客户端出示的证书
+		certs []tls.Certificate
+		// handshake 是否期望握手成功
+		handshake bool
+		// code 握手成功后authorizeUpload返回的错误码
+		code codes.Code
+	}{
+		{"tls without client certs", "", nil, nil, true, codes.OK},
+		{"client cert from the ca", caFile, nil, clientCert(ca, ci), true, codes.OK},
+		{"no client cert", caFile, nil, nil, false, codes.OK},
+		{"client cert from another ca", caFile, nil, clientCert(other, ci), false, codes.OK},
+		{"allowed by cn", caFile, []string{"backup", "ci"}, clientCert(ca, ci), true, codes.OK},
+		{"allowed by dn", caFile, []string{"CN=ci,O=example"}, clientCert(ca, ci), true, codes.OK},
+		{"dn of another organization", caFile, []string{"CN=ci,O=other"}, clientCert(ca, ci), true, codes.PermissionDenied},
+		{"subject not allowed", caFile, []string{"backup"}, clientCert(ca, ci), true, codes.PermissionDenied},
+		{"allow list without client certs", "", []string{"ci"}, nil, true, codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &GrpcStreamServerCfg{Cert: certFile, Key: keyFile, ClientCA: tt.clientCA, AllowedSubjects: tt.allowedSubjects}
+			serverCfg, err := serverTLSConfig(cfg, certs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			state, err := handshake(t, serverCfg, &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: tt.certs})
+			if (err == nil) != tt.handshake {
+				t.Fatalf("handshake returned %v, want ok %v", err, tt.handshake)
+			}
+			if err != nil {
+				return
+			}
+
+			gsrv := &GrpcStreamServer{cfg: cfg, logger: zerolog.Nop()}
+			ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+			if err = gsrv.authorizeUpload(ctx); status.Code(err) != tt.code {
+				t.Errorf("authorizeUpload returned %v, want %v", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestServerTLSConfigClientCA(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.pem")
+	if err := ioutil.WriteFile(bad, []byte("not a cert"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, caFile := range []string{filepath.Join(dir, "missing.pem"), bad} {
+		if _, err := serverTLSConfig(&GrpcStreamServerCfg{ClientCA: caFile}, nil); err == nil {
+			t.Errorf("accepted client_ca '%s'", caFile)
+		}
+	}
+}
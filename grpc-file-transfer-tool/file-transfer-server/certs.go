@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// certReloader 持有当前使用的证书, 通过GetCertificate为新的TLS握手提供证书.
+// 证书更新后只影响之后的握手, 已经建立的连接和流不受影响.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+// newCertReloader 加载证书并返回certReloader实例.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload 重新加载证书和私钥, 加载失败时继续使用旧的证书.
+func (r *certReloader) reload() error {
+	certTime, keyTime := r.modTimes()
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 无论成功与否都记录本次看到的修改时间, 避免文件损坏时每次检查都重复报错
+	r.certTime, r.keyTime = certTime, keyTime
+	if err != nil {
+		return errors.Wrapf(err, "failed to load cert '%s' and key '%s'", r.certFile, r.keyFile)
+	}
+	r.cert = &cert
+	return nil
+}
+
+// changed 判断证书或私钥文件自上次加载以来是否被修改过.
+func (r *certReloader) changed() bool {
+	certTime, keyTime := r.modTimes()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !certTime.Equal(r.certTime) || !keyTime.Equal(r.keyTime)
+}
+
+func (r *certReloader) modTimes() (certTime, keyTime time.Time) {
+	if fi, err := os.Stat(r.certFile); err == nil {
+		certTime = fi.ModTime()
+	}
+	if fi, err := os.Stat(r.keyFile); err == nil {
+		keyTime = fi.ModTime()
+	}
+	return
+}
+
+// GetCertificate 实现tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
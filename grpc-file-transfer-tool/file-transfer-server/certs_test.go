@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// servedCN 返回certs在新的TLS握手中提供的证书的CN.
+func servedCN(t *testing.T, certs *certReloader) string {
+	t.Helper()
+	cert, err := certs.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+// touch 把文件的修改时间往后调, 避免文件系统时间精度不够导致看不出修改.
+func touch(t *testing.T, files ...string) {
+	t.Helper()
+	for _, fn := range files {
+		fi, err := os.Stat(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mtime := fi.ModTime().Add(time.Second)
+		if err = os.Chtimes(fn, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := newTestCA(t, "test ca")
+	dir := t.TempDir()
+	certFile, keyFile := writeServerCert(t, ca, dir, "v1")
+
+	if _, err := newCertReloader(certFile, filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("loaded a cert without its key")
+	}
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// update 修改证书文件, 为nil时不修改
+		update func()
+		// changed 修改后changed()的期望结果
+		changed bool
+		// ok 期望reload成功
+		ok bool
+		// cn reload后新握手拿到的证书
+		cn string
+	}{
+		{"unchanged", nil, false, true, "v1"},
+		{"rotated", func() {
+			writeServerCert(t, ca, dir, "v2")
+			touch(t, certFile, keyFile)
+		}, true, true, "v2"},
+		{"only the key touched", func() { touch(t, keyFile) }, true, true, "v2"},
+		{"corrupted cert keeps the old one", func() {
+			if err := ioutil.WriteFile(certFile, []byte("garbage"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			touch(t, certFile)
+		}, true, false, "v2"},
+		{"fixed again", func() {
+			writeServerCert(t, ca, dir, "v3")
+			touch(t, certFile, keyFile)
+		}, true, true, "v3"},
+	}
+	for _, tt := range tests {
+		if tt.update != nil {
+			tt.update()
+		}
+		if got := certs.changed(); got != tt.changed {
+			t.Errorf("%s: changed() = %v, want %v", tt.name, got, tt.changed)
+		}
+		if err = certs.reload(); (err == nil) != tt.ok {
+			t.Errorf("%s: reload returned %v, want ok %v", tt.name, err, tt.ok)
+		}
+		// failed loads are not retried until the files change again
+		if certs.changed() {
+			t.Errorf("%s: still changed after reload", tt.name)
+		}
+		if got := servedCN(t, certs); got != tt.cn {
+			t.Errorf("%s: serving cert '%s', want '%s'", tt.name, got, tt.cn)
+		}
+	}
+}
+
+func TestWatchCertLoop(t *testing.T) {
+	ca := newTestCA(t, "test ca")
+	dir := t.TempDir()
+	certFile, keyFile := writeServerCert(t, ca, dir, "v1")
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gsrv := &GrpcStreamServer{
+		cfg:    &GrpcStreamServerCfg{Cert: certFile, Key: keyFile, CertReloadInterval: 10 * time.Millisecond},
+		logger: zerolog.Nop(),
+		certs:  certs,
+		done:   make(chan struct{}),
+	}
+	go gsrv.watchCertLoop()
+	defer close(gsrv.done)
+
+	writeServerCert(t, ca, dir, "v2")
+	touch(t, certFile, keyFile)
+	for deadline := time.Now().Add(5 * time.Second); servedCN(t, certs) != "v2"; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("rotated cert was not picked up")
+		}
+	}
+}
+
+func TestReloadCert(t *testing.T) {
+	// what SIGHUP triggers, reloads even when the mod times did not move
+	gsrv := &GrpcStreamServer{cfg: &GrpcStreamServerCfg{}, logger: zerolog.Nop()}
+	if err := gsrv.ReloadCert(); err == nil {
+		t.Error("reloaded a cert without tls")
+	}
+
+	ca := newTestCA(t, "test ca")
+	dir := t.TempDir()
+	certFile, keyFile := writeServerCert(t, ca, dir, "v1")
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gsrv.cfg.Cert, gsrv.cfg.Key, gsrv.certs = certFile, keyFile, certs
+
+	writeServerCert(t, ca, dir, "v2")
+	if err = gsrv.ReloadCert(); err != nil {
+		t.Fatal(err)
+	}
+	if got := servedCN(t, certs); got != "v2" {
+		t.Errorf("serving cert '%s' after reload, want 'v2'", got)
+	}
+
+	if err = os.Remove(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err = gsrv.ReloadCert(); err == nil {
+		t.Error("reloaded a cert without its key")
+	}
+	if got := servedCN(t, certs); got != "v2" {
+		t.Errorf("serving cert '%s' after a failed reload, want 'v2'", got)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// configEnvPrefix 覆盖配置项的环境变量前缀, 例如FILE_TRANSFER_SERVER_STORAGE_DIR覆盖storage_dir
+const configEnvPrefix = "FILE_TRANSFER_SERVER_"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// configField 按json标签查找配置项.
+func configField(cfg *GrpcStreamServerCfg, key string) (reflect.Value, bool) {
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0] == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// configKeys 返回所有配置项的名字.
+func configKeys() []string {
+	t := reflect.TypeOf(GrpcStreamServerCfg{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; key != "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// setConfigValue 把字符串形式的值写入配置项key, 用于命令行参数和环境变量.
+// 字节数和带宽可以带单位(例如10GB, 50MB/s), 时长使用Go的格式(例如30s, 24h), 列表使用分号分隔.
+func setConfigValue(cfg *GrpcStreamServerCfg, key, value string) error {
+	field, ok := configField(cfg, key)
+	if !ok {
+		return errors.Errorf("unknown config '%s'", key)
+	}
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			if _, nerr := strconv.ParseFloat(value, 64); nerr == nil {
+				// e.g. nanoseconds from a JSON encoded time.Duration, 30 would be 30ns
+				return errors.Errorf("invalid %s '%s', durations need a unit like 30s or 24h", key, value)
+			}
+			return errors.Errorf("invalid %s '%s', expected a duration like 30s", key, value)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.Errorf("invalid %s '%s', expected true or false", key, value)
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.Errorf("invalid %s '%s', expected an integer", key, value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Int64:
+		// sizes and rates, ParseRate accepts both 10GB and 50MB/s
+		n, err := common.ParseRate(value)
+		if err != nil {
+			return errors.Errorf("invalid %s '%s', expected a size like 10GB or a rate like 50MB/s", key, value)
+		}
+		field.SetInt(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ";") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return errors.Errorf("unsupported config '%s'", key)
+	}
+	return nil
+}
+
+// loadConfigFile 从JSON或者YAML文件加载配置, 文件中没有出现的配置项保持不变.
+func loadConfigFile(path string, cfg *GrpcStreamServerCfg) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read config file '%s'", path)
+	}
+	// JSON is valid YAML, so one parser serves both
+	values := make(map[string]interface{})
+	if err = yaml.Unmarshal(data, &values); err != nil {
+		return errors.Wrapf(err, "failed to parse config file '%s'", path)
+	}
+
+	for key, value := range values {
+		var s string
+		switch v := value.(type) {
+		case nil:
+			continue
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			s = strings.Join(items, ";")
+		case map[string]interface{}:
+			return errors.Errorf("invalid %s in config file '%s', expected a scalar or a list", key, path)
+		default:
+			s = fmt.Sprint(v)
+		}
+		if err = setConfigValue(cfg, key, s); err != nil {
+			return errors.Wrapf(err, "invalid config file '%s'", path)
+		}
+	}
+	return nil
+}
+
+// applyConfigEnv 用环境变量覆盖配置, 环境变量名为前缀加上大写的配置项名字.
+func applyConfigEnv(cfg *GrpcStreamServerCfg) error {
+	for _, key := range configKeys() {
+		env := configEnvPrefix + strings.ToUpper(key)
+		if value, ok := os.LookupEnv(env); ok {
+			if err := setConfigValue(cfg, key, value); err != nil {
+				return errors.Wrapf(err, "invalid environment variable %s", env)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate 校验配置, 错误信息中包含出错的配置项名字.
+func (cfg *GrpcStreamServerCfg) Validate() error {
+	if cfg.Port <= 0 || cfg.Port > 65535 {
+		return errors.Errorf("port must be in [1, 65535], got %d", cfg.Port)
+	}
+	for _, addr := range cfg.Listen {
+		if _, _, err := parseListenAddress(addr); err != nil {
+			return errors.Wrap(err, "listen")
+		}
+	}
+	if cfg.MetricsAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.MetricsAddr); err != nil {
+			return errors.Errorf("invalid metrics_addr '%s', expected host:port like :9090", cfg.MetricsAddr)
+		}
+	}
+	if !common.ValidTraceExporter(cfg.TraceExporter) {
+		return errors.Errorf("invalid trace_exporter '%s', must be stdout, otlp or file:<path>", cfg.TraceExporter)
+	}
+	if cfg.StorageDir == "" {
+		return errors.Errorf("storage_dir must be specified")
+	}
+	switch cfg.StorageBackend {
+	case "", storageBackendLocal, storageBackendMemory:
+	case storageBackendS3:
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+			return errors.Errorf("s3_endpoint and s3_bucket must be specified for the s3 storage backend")
+		}
+	default:
+		return errors.Errorf("invalid storage_backend '%s', must be local, memory or s3", cfg.StorageBackend)
+	}
+	if (cfg.Cert == "") != (cfg.Key == "") {
+		return errors.Errorf("cert and key must be specified together")
+	}
+	if cfg.Cert == "" && (cfg.ClientCA != "" || len(cfg.AllowedSubjects) > 0) {
+		return errors.Errorf("client_ca and allowed_subjects require cert and key to be specified")
+	}
+	if cfg.ClientCA != "" || len(cfg.AllowedSubjects) > 0 {
+		// unix sockets are served in plaintext, no client cert would ever be presented there
+		for _, addr := range cfg.Listen {
+			if network, _, _ := parseListenAddress(addr); network == "unix" {
+				return errors.Errorf("listen: unix socket '%s' is served without tls, it can not be combined with client_ca or allowed_subjects", addr)
+			}
+		}
+	}
+	if cfg.UploadQueueSize > 0 && cfg.UploadQueueTimeout <= 0 {
+		return errors.Errorf("upload_queue_timeout must be positive when upload_queue_size is set")
+	}
+
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		switch v.Field(i).Kind() {
+		case reflect.Int, reflect.Int64:
+			if v.Field(i).Int() < 0 {
+				return errors.Errorf("%s must not be negative", strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0])
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// configValue 返回配置项key的值的字符串形式.
+func configValue(t *testing.T, cfg *GrpcStreamServerCfg, key string) string {
+	t.Helper()
+	field, ok := configField(cfg, key)
+	if !ok {
+		t.Fatalf("unknown config '%s'", key)
+	}
+	return fmt.Sprint(field.Interface())
+}
+
+func TestSetConfigValue(t *testing.T) {
+	tests := []struct {
+		key, value string
+		// want 写入后配置项的字符串形式
+		want string
+		ok   bool
+	}{
+		{"port", "9000", "9000", true},
+		{"port", "9000.5", "", false},
+		{"port", "", "", false},
+		{"storage_dir", "/data", "/data", true},
+		{"storage_dir", "", "", true},
+		{"session_expiry", "1h30m", "1h30m0s", true},
+		{"session_expiry", "30", "", false},
+		{"session_expiry", "0", "0s", true},
+		{"rate_limit", "50MB/s", "52428800", true},
+		{"rate_limit", "1048576", "1048576", true},
+		{"max_file_size", "10GB", "10737418240", true},
+		{"max_file_size", "10 apples", "", false},
+		{"s3_insecure", "true", "true", true},
+		{"s3_insecure", "1", "true", true},
+		{"s3_insecure", "yes", "", false},
+		{"listen", "0.0.0.0:8999; unix:///run/ft.sock;;", "[0.0.0.0:8999 unix:///run/ft.sock]", true},
+		{"allowed_subjects", "", "[]", true},
+		{"no_such_key", "1", "", false},
+		{"", "1", "", false},
+	}
+	for _, tt := range tests {
+		var cfg GrpcStreamServerCfg
+		err := setConfigValue(&cfg, tt.key, tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("setConfigValue(%s, %q) returned error %v, want ok %v", tt.key, tt.value, err, tt.ok)
+			continue
+		}
+		if err == nil {
+			if got := configValue(t, &cfg, tt.key); got != tt.want {
+				t.Errorf("setConfigValue(%s, %q) set %s, want %s", tt.key, tt.value, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestConfigKeysAreSettable(t *testing.T) {
+	// every config must be reachable from flags, files and the environment
+	for _, key := range configKeys() {
+		if err := setConfigValue(&GrpcStreamServerCfg{}, key, ""); err != nil && strings.Contains(err.Error(), "unsupported") {
+			t.Errorf("config '%s' has an unsupported type", key)
+		}
+	}
+}
+
+func TestApplyConfigEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// want 覆盖后配置项的字符串形式
+		want map[string]string
+		// err 期望的错误中包含的内容, 为空时期望成功
+		err string
+	}{
+		{
+			name: "no overrides",
+			want: map[string]string{"port": "8999", "storage_dir": "storage", "listen": "[]"},
+		},
+		{
+			name: "overrides",
+			env: map[string]string{
+				"FILE_TRANSFER_SERVER_PORT":           "9000",
+				"FILE_TRANSFER_SERVER_STORAGE_DIR":    "/data",
+				"FILE_TRANSFER_SERVER_LISTEN":         "a:1;b:2",
+				"FILE_TRANSFER_SERVER_SESSION_EXPIRY": "2h",
+				"FILE_TRANSFER_SERVER_CLIENT_QUOTA":   "100GB",
+				"FILE_TRANSFER_SERVER_DEDUP":          "true",
+			},
+			want: map[string]string{
+				"port":           "9000",
+				"storage_dir":    "/data",
+				"listen":         "[a:1 b:2]",
+				"session_expiry": "2h0m0s",
+				"client_quota":   "107374182400",
+				"dedup":          "true",
+			},
+		},
+		{
+			name: "set to empty",
+			env:  map[string]string{"FILE_TRANSFER_SERVER_STORAGE_DIR": ""},
+			want: map[string]string{"storage_dir": ""},
+		},
+		{
+			name: "lower case names are ignored",
+			env:  map[string]string{"file_transfer_server_port": "9000", "FILE_TRANSFER_SERVER_port": "9000"},
+			want: map[string]string{"port": "8999"},
+		},
+		{
+			name: "invalid value",
+			env:  map[string]string{"FILE_TRANSFER_SERVER_MAX_FILE_SIZE": "big"},
+			err:  "FILE_TRANSFER_SERVER_MAX_FILE_SIZE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for env, value := range tt.env {
+				if err := os.Setenv(env, value); err != nil {
+					t.Fatal(err)
+				}
+				defer os.Unsetenv(env) // nolint
+			}
+
+			cfg := &GrpcStreamServerCfg{Port: 8999, StorageDir: "storage"}
+			err := applyConfigEnv(cfg)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one naming %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tt.want {
+				if got := configValue(t, cfg, key); got != want {
+					t.Errorf("%s = %s, want %s", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          map[string]string
+		err           string
+	}{
+		{
+			name: "yaml",
+			content: "port: 9000\nstorage_dir: /data\nsession_expiry: 12h\nrate_limit: 200MB/s\nmax_file_size: 1073741824\n" +
+				"listen:\n  - 0.0.0.0:9000\n  - unix:///run/ft.sock\ndedup: true\ntoken_file: ~\n",
+			want: map[string]string{
+				"port":           "9000",
+				"storage_dir":    "/data",
+				"session_expiry": "12h0m0s",
+				"rate_limit":     "209715200",
+				"max_file_size":  "1073741824",
+				"listen":         "[0.0.0.0:9000 unix:///run/ft.sock]",
+				"dedup":          "true",
+				"token_file":     "tokens",
+			},
+		},
+		{
+			name:    "json",
+			content: `{"port": 9000, "allowed_subjects": ["a", "CN=b,O=c"], "s3_insecure": false}`,
+			want:    map[string]string{"port": "9000", "allowed_subjects": "[a CN=b,O=c]", "s3_insecure": "false", "storage_dir": "storage"},
+		},
+		{name: "empty", content: "", want: map[string]string{"port": "8999"}},
+		{name: "unknown key", content: "prot: 9000\n", err: "prot"},
+		{name: "invalid value", content: "session_expiry: ten\n", err: "session_expiry"},
+		{name: "duration without a unit", content: `{"session_expiry": 3600000000000}`, err: "invalid session_expiry '3600000000000', durations need a unit"},
+		{name: "float duration", content: "cert_reload_interval: 1.5\n", err: "invalid cert_reload_interval '1.5', durations need a unit"},
+		{name: "nested map", content: "s3_endpoint:\n  host: minio\n", err: "s3_endpoint"},
+		{name: "not a map", content: "- port\n", err: "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "server.yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := &GrpcStreamServerCfg{Port: 8999, StorageDir: "storage", TokenFile: "tokens"}
+			err := loadConfigFile(path, cfg)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one mentioning %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tt.want {
+				if got := configValue(t, cfg, key); got != want {
+					t.Errorf("%s = %s, want %s", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *GrpcStreamServerCfg)
+		// err 期望的错误中包含的配置项名字, 为空时期望校验通过
+		err string
+	}{
+		{"defaults", func(cfg *GrpcStreamServerCfg) {}, ""},
+		{"port zero", func(cfg *GrpcStreamServerCfg) { cfg.Port = 0 }, "port"},
+		{"port too large", func(cfg *GrpcStreamServerCfg) { cfg.Port = 65536 }, "port"},
+		{"listen", func(cfg *GrpcStreamServerCfg) { cfg.Listen = []string{"localhost"} }, "listen: "},
+		{"listen port", func(cfg *GrpcStreamServerCfg) { cfg.Listen = []string{":8999", "localhost:"} }, "listen: "},
+		{"metrics_addr", func(cfg *GrpcStreamServerCfg) { cfg.MetricsAddr = "9090" }, "metrics_addr"},
+		{"trace_exporter", func(cfg *GrpcStreamServerCfg) { cfg.TraceExporter = "jaeger" }, "trace_exporter"},
+		{"storage_dir", func(cfg *GrpcStreamServerCfg) { cfg.StorageDir = "" }, "storage_dir"},
+		{"storage_backend", func(cfg *GrpcStreamServerCfg) { cfg.StorageBackend = "ftp" }, "storage_backend"},
+		{"s3 without bucket", func(cfg *GrpcStreamServerCfg) { cfg.StorageBackend, cfg.S3Endpoint = storageBackendS3, "minio:9000" }, "s3_bucket"},
+		{"cert without key", func(cfg *GrpcStreamServerCfg) { cfg.Cert = "cert.pem" }, "key"},
+		{"client_ca without tls", func(cfg *GrpcStreamServerCfg) { cfg.ClientCA = "ca.pem" }, "client_ca"},
+		{"unix socket with client_ca", func(cfg *GrpcStreamServerCfg) {
+			cfg.Cert, cfg.Key, cfg.ClientCA = "cert.pem", "key.pem", "ca.pem"
+			cfg.Listen = []string{"0.0.0.0:8999", "unix:///run/ft.sock"}
+		}, "listen: "},
+		{"unix socket with allowed_subjects", func(cfg *GrpcStreamServerCfg) {
+			cfg.Cert, cfg.Key, cfg.AllowedSubjects = "cert.pem", "key.pem", []string{"ci"}
+			cfg.Listen = []string{"unix:ft.sock"}
+		}, "allowed_subjects"},
+		{"tcp with client_ca", func(cfg *GrpcStreamServerCfg) {
+			cfg.Cert, cfg.Key, cfg.ClientCA = "cert.pem", "key.pem", "ca.pem"
+			cfg.Listen = []string{"0.0.0.0:8999"}
+		}, ""},
+		{"unix socket with tls", func(cfg *GrpcStreamServerCfg) {
+			cfg.Cert, cfg.Key = "cert.pem", "key.pem"
+			cfg.Listen = []string{"0.0.0.0:8999", "unix:///run/ft.sock"}
+		}, ""},
+		{"queue without timeout", func(cfg *GrpcStreamServerCfg) { cfg.UploadQueueSize = 1 }, "upload_queue_timeout"},
+		{"negative size", func(cfg *GrpcStreamServerCfg) { cfg.ClientQuota = -1 }, "client_quota"},
+		{"negative duration", func(cfg *GrpcStreamServerCfg) { cfg.SessionExpiry = -1 }, "session_expiry"},
+		{"negative count", func(cfg *GrpcStreamServerCfg) { cfg.MaxConcurrentUploads = -1 }, "max_concurrent_uploads"},
+	}
+	for _, tt := range tests {
+		cfg := &GrpcStreamServerCfg{Port: 8999, StorageDir: "storage"}
+		tt.modify(cfg)
+		err := cfg.Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want one naming %s", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// diskFree 返回dir所在文件系统中非特权用户可用的字节数.
+func diskFree(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, errors.Wrapf(err, "failed to statfs '%s'", dir)
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil // nolint
+}
@@ -0,0 +1,22 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// diskFree 返回dir所在磁盘中当前用户可用的字节数.
+func diskFree(dir string) (int64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid path '%s'", dir)
+	}
+	var free uint64
+	if err = windows.GetDiskFreeSpaceEx(path, &free, nil, nil); err != nil {
+		return 0, errors.Wrapf(err, "failed to get free disk space of '%s'", dir)
+	}
+	return int64(free), nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// GetSignature 返回服务端已有文件的分块校验和, 客户端据此只发送发生变化的部分.
+func (gsrv *GrpcStreamServer) GetSignature(ctx context.Context, req *api.SignatureRequest) (*api.FileSignature, error) {
+	if err := gsrv.authorizeUpload(ctx); err != nil {
+		return nil, err
+	}
+	name, err := cleanName(req.GetName())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.GetBlockSize() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid block size %d", req.GetBlockSize())
+	}
+
+	rc, meta, err := gsrv.storage.Open(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, status.Errorf(codes.NotFound, "file '%s' not found", req.GetName())
+		}
+		gsrv.logger.Error().Err(err).Msgf("failed to open file '%s'", name)
+		return nil, status.Errorf(codes.Internal, "failed to open file '%s'", req.GetName())
+	}
+	defer rc.Close()
+
+	sig, err := common.ComputeSignature(rc, meta.GetSize(), common.DeltaBlockSize(meta.GetSize(), int(req.GetBlockSize())))
+	if err != nil {
+		gsrv.logger.Error().Err(err).Msgf("failed to compute signature of file '%s'", name)
+		return nil, status.Errorf(codes.Internal, "failed to compute signature of file '%s'", req.GetName())
+	}
+	return sig, nil
+}
+
+// deltaBase 增量上传所基于的服务端现有文件
+type deltaBase struct {
+	r         io.ReaderAt
+	closer    io.Closer
+	size      int64
+	blockSize int64
+}
+
+// openDeltaBase 打开服务端现有的文件name, 存储后端不支持随机读取时先复制到本地临时文件.
+func (gsrv *GrpcStreamServer) openDeltaBase(ctx context.Context, name string, blockSize int32) (*deltaBase, error) {
+	rc, meta, err := gsrv.storage.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	base := &deltaBase{size: meta.GetSize(), blockSize: int64(blockSize)}
+	if r, ok := rc.(io.ReaderAt); ok {
+		base.r, base.closer = r, rc
+		return base, nil
+	}
+
+	defer rc.Close()
+	fd, err := createTempFile(gsrv.cfg.StorageDir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(fd, rc); err != nil {
+		abortTempFile(fd)
+		return nil, errors.Wrapf(err, "failed to copy file '%s' for random access", name)
+	}
+	base.r, base.closer = fd, closerFunc(func() error {
+		abortTempFile(fd)
+		return nil
+	})
+	return base, nil
+}
+
+// copyBlocks 把现有文件中从index开始的count个分块写入w, 返回写入的字节数.
+func (b *deltaBase) copyBlocks(w io.Writer, h hash.Hash, index, count int64) (int64, error) {
+	blocks := (b.size + b.blockSize - 1) / b.blockSize
+	// count comes from the client, index+count may overflow
+	if index < 0 || count <= 0 || index >= blocks || count > blocks-index {
+		return 0, errors.Errorf("blocks [%d, %d) out of the %d blocks of the base file", index, index+count, blocks)
+	}
+	start := index * b.blockSize
+	end := (index + count) * b.blockSize
+	if end > b.size {
+		end = b.size
+	}
+	dst := w
+	if h != nil {
+		dst = io.MultiWriter(w, h)
+	}
+	n, err := io.Copy(dst, io.NewSectionReader(b.r, start, end-start))
+	if err != nil {
+		return n, errors.Wrapf(err, "failed to copy blocks [%d, %d) of the base file", index, index+count)
+	}
+	return n, nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// uploadDelta 接收增量上传, 用收到的原始数据和对现有文件分块的引用重建新版本的文件.
+func (gsrv *GrpcStreamServer) uploadDelta(stream api.GrpcStreamService_UploadServer, meta *api.FileMeta, h hash.Hash) error {
+	var (
+		trailer *api.FileTrailer
+		written int64
+		literal int64
+		name    = meta.GetName()
+		client  = clientName(stream.Context())
+		ctx     = stream.Context()
+	)
+
+	base, err := gsrv.openDeltaBase(ctx, name, meta.GetDeltaBlockSize())
+	if err != nil {
+		gsrv.logger.Error().Err(err).Str("file", name).Msg("failed to open base file of delta upload")
+		if os.IsNotExist(err) {
+			return status.Errorf(codes.FailedPrecondition, "file '%s' not found, upload the whole file", name)
+		}
+		return status.Error(codes.Unavailable, "failed to open base file")
+	}
+	defer base.closer.Close() // nolint
+
+	w, err := gsrv.storage.Create(ctx, name)
+	if err != nil {
+		gsrv.logger.Error().Err(err).Msg("failed to prepare storage for upload")
+		return status.Error(codes.Unavailable, "failed to prepare storage for upload")
+	}
+	fail := func(code api.UploadStatusCode, msg string) error {
+		w.Abort() // nolint
+		return gsrv.sendUploadStatus(stream, code, msg)
+	}
+	// interrupt 放弃上传并返回可重试的gRPC状态码
+	interrupt := func(code codes.Code, msg string) error {
+		w.Abort() // nolint
+		return status.Error(code, msg)
+	}
+
+	recvOps := common.NewOpSpans(ctx, gsrv.tracer, "recv")
+	writeOps := common.NewOpSpans(ctx, gsrv.tracer, "write")
+	defer func() {
+		trace.SpanFromContext(ctx).SetAttributes(append(append(recvOps.Attributes(), writeOps.Attributes()...),
+			attribute.Int64("delta.literal_bytes", literal),
+			attribute.Int64("delta.reused_bytes", written-literal))...)
+	}()
+
+RECV_LOOP:
+	for {
+		recvAt := time.Now()
+		chunk, err := stream.Recv()
+		recvOps.Observe(recvAt, len(chunk.GetContent()))
+		if err != nil {
+			if err == io.EOF {
+				break RECV_LOOP
+			}
+			gsrv.logger.Error().Err(err).Msg("failed unexpectedly while reading chunks from stream")
+			return interrupt(codes.Aborted, "upload stream broke")
+		}
+		if trailer != nil {
+			gsrv.logger.Error().Str("file", name).Msg("received data after file trailer")
+			return fail(api.UploadStatusCode_STATUS_CODE_FAILED, "Upload Failed")
+		}
+		if chunk.GetTrailer() != nil {
+			trailer = chunk.GetTrailer()
+			continue
+		}
+
+		writeAt := time.Now()
+		var n int64
+		if block := chunk.GetBlock(); block != nil {
+			n, err = base.copyBlocks(w, h, block.GetIndex(), block.GetCount())
+		} else {
+			content := chunk.GetContent()
+			if err = common.WaitBytes(ctx, gsrv.limiter, len(content)); err != nil {
+				gsrv.logger.Error().Err(err).Msg("failed to wait for bandwidth")
+				return interrupt(codes.Aborted, "upload interrupted")
+			}
+			var m int
+			m, err = w.Write(content)
+			n = int64(m)
+			if err == nil && h != nil {
+				h.Write(content) // nolint
+			}
+			literal += n
+		}
+		writeOps.Observe(writeAt, int(n))
+		if err != nil {
+			gsrv.logger.Error().Err(err).Msgf("failed to rebuild file '%s'", name)
+			return fail(api.UploadStatusCode_STATUS_CODE_FAILED, "Upload Failed")
+		}
+		written += n
+		if written > meta.GetSize() {
+			gsrv.logger.Error().Str("file", name).Msgf("received more than the declared %d bytes", meta.GetSize())
+			return fail(api.UploadStatusCode_STATUS_CODE_FAILED, "Upload Failed")
+		}
+		if (written-n)/diskCheckInterval != written/diskCheckInterval {
+			if err = gsrv.checkDiskFree(meta.GetSize() - written); err != nil {
+				gsrv.logger.Error().Err(err).Str("file", name).Msg("upload aborted")
+				w.Abort() // nolint
+				return err
+			}
+		}
+	}
+	if written != meta.GetSize() {
+		gsrv.logger.Error().Str("file", name).Msgf("rebuilt %d bytes, but %d bytes were declared", written, meta.GetSize())
+		return fail(api.UploadStatusCode_STATUS_CODE_FAILED, "Upload Failed")
+	}
+	// the base file may have changed since the client got its signature, only the checksum tells
+	if trailer == nil {
+		gsrv.logger.Error().Str("file", name).Msg("missing file trailer with checksum")
+		return fail(api.UploadStatusCode_STATUS_CODE_FAILED, "Upload Failed")
+	}
+	if sum := h.Sum(nil); !bytes.Equal(sum, trailer.GetChecksum()) {
+		gsrv.logger.Error().Str("file", name).Str("algorithm", meta.GetChecksumAlgorithm().String()).
+			Msgf("checksum mismatch of rebuilt file, expected %x, got %x", trailer.GetChecksum(), sum)
+		return fail(api.UploadStatusCode_STATUS_CODE_CHECKSUM_MISMATCH, "Checksum Mismatch")
+	}
+
+	if s, ok := w.(syncer); ok {
+		if err = gsrv.fsync(ctx, s); err != nil {
+			gsrv.logger.Error().Err(err).Msgf("failed to sync file '%s'", name)
+			return interrupt(codes.Unavailable, "failed to sync uploaded file")
+		}
+	}
+	commitCtx, commitSpan := gsrv.tracer.Start(ctx, "commit")
+	err = gsrv.quota.commit(client, name, written, func() error { return w.Commit(commitCtx, meta) })
+	commitSpan.End()
+	if err != nil {
+		w.Abort() // nolint
+		if _, ok := err.(*quotaError); ok {
+			gsrv.logger.Error().Err(err).Str("client", client).Str("file", name).Msg("upload aborted")
+			return err
+		}
+		gsrv.logger.Error().Err(err).Msg("failed to commit uploaded file")
+		return status.Error(codes.Unavailable, "failed to commit uploaded file")
+	}
+
+	gsrv.logger.Info().Str("transfer_id", transferIDFromContext(ctx)).Str("client", client).Str("file", name).Int64("size", written).
+		Int64("literal", literal).Int64("reused", written-literal).Str("content_type", meta.GetContentType()).Msg("upload successfully")
+	return gsrv.sendUploadStatus(stream, api.UploadStatusCode_STATUS_CODE_OK, "Successfully Upload")
+}
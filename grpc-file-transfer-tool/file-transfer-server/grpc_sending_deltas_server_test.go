@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/rand"
+	"testing"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// randomBytes 返回n个确定的伪随机字节.
+func randomBytes(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// TestDeltaRoundTrip 用DeltaEncoder编码新文件, 再用deltaBase.copyBlocks和原始数据重建, 结果必须与新文件完全相同.
+func TestDeltaRoundTrip(t *testing.T) {
+	const (
+		blockSize = 1024
+		chunkSize = 1024
+		// the encoder reads ahead this much, a multiple of the block size
+		readAhead = 2*(chunkSize+blockSize) + (1 << 20)
+	)
+	small := randomBytes(1, 10*blockSize+300)
+	large := randomBytes(2, 3*readAhead+5000)
+
+	tests := []struct {
+		name string
+		base []byte
+		next []byte
+		// maxLiteral 最多允许发送的原始数据字节数, 小于0时不检查
+		maxLiteral int
+	}{
+		{"identical", small, small, 0},
+		{"insert", small, join(small[:3000], []byte("inserted"), small[3000:]), 2 * blockSize},
+		{"delete", small, join(small[:3000], small[3500:]), 2 * blockSize},
+		{"overwrite", small, join(small[:5000], randomBytes(3, 10), small[5010:]), 2 * blockSize},
+		{"append", small, join(small, randomBytes(4, 700)), 700 + 300},
+		{"truncate", small, small[:7*blockSize+10], 10},
+		{"truncate to a block boundary", small, small[:4*blockSize], 0},
+		{"prepend", small, join([]byte("x"), small), 1 + blockSize},
+		{"moved blocks", small, join(small[5*blockSize:], small[:5*blockSize]), 300 + blockSize},
+		{"new file smaller than a block", small, small[:100], 100},
+		{"base smaller than a block", small[:100], small[:100], 0},
+		{"both smaller than a block and different", small[:100], small[50:120], 70},
+		{"empty base", nil, small, len(small)},
+		{"empty new file", small, nil, 0},
+		{"both empty", nil, nil, 0},
+		{"unrelated", small, randomBytes(5, len(small)), -1},
+		{"identical across refills", large, large, 0},
+		{"insert before a refill", large, join(large[:readAhead-blockSize-10], []byte("y"), large[readAhead-blockSize-10:]), 2 * blockSize},
+		{"insert at a refill", large, join(large[:readAhead], []byte("z"), large[readAhead:]), 2 * blockSize},
+		{"literal run across a refill", large, join(large[:readAhead-50000], randomBytes(6, 100000), large[readAhead+50000:]), 100000 + 2*blockSize},
+		{"delete across a refill", large, join(large[:readAhead-3000], large[readAhead+3000:]), 2 * blockSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := common.ComputeSignature(bytes.NewReader(tt.base), int64(len(tt.base)), blockSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			base := &deltaBase{r: bytes.NewReader(tt.base), size: int64(len(tt.base)), blockSize: blockSize}
+
+			var (
+				rebuilt bytes.Buffer
+				literal int
+			)
+			enc := common.NewDeltaEncoder(sig, chunkSize)
+			enc.SendLiteral = func(p []byte) error {
+				if len(p) > chunkSize {
+					t.Errorf("literal of %d bytes exceeds the chunk size", len(p))
+				}
+				literal += len(p)
+				rebuilt.Write(p)
+				return nil
+			}
+			enc.SendBlocks = func(ref *api.BlockRef, n int64) error {
+				copied, err := base.copyBlocks(&rebuilt, nil, ref.GetIndex(), ref.GetCount())
+				if err != nil {
+					return err
+				}
+				if copied != n {
+					t.Errorf("blocks [%d, %d) hold %d bytes, the encoder counted %d", ref.GetIndex(), ref.GetIndex()+ref.GetCount(), copied, n)
+				}
+				return nil
+			}
+			h := sha256.New()
+			if err = enc.Encode(bytes.NewReader(tt.next), h); err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(rebuilt.Bytes(), tt.next) {
+				t.Fatalf("rebuilt %d bytes differ from the %d bytes encoded", rebuilt.Len(), len(tt.next))
+			}
+			if sum := sha256.Sum256(tt.next); !bytes.Equal(h.Sum(nil), sum[:]) {
+				t.Error("checksum computed while encoding differs from the checksum of the file")
+			}
+			if tt.maxLiteral >= 0 && literal > tt.maxLiteral {
+				t.Errorf("sent %d literal bytes, want at most %d", literal, tt.maxLiteral)
+			}
+		})
+	}
+}
+
+func TestDeltaBaseCopyBlocksRange(t *testing.T) {
+	base := &deltaBase{r: bytes.NewReader(make([]byte, 2500)), size: 2500, blockSize: 1024}
+
+	tests := []struct {
+		index, count int64
+		want         int64
+		ok           bool
+	}{
+		{0, 1, 1024, true},
+		{1, 2, 1476, true},
+		{2, 1, 452, true},
+		{0, 3, 2500, true},
+		{0, 0, 0, false},
+		{-1, 1, 0, false},
+		{3, 1, 0, false},
+		{2, 2, 0, false},
+		{1, 1<<63 - 1, 0, false},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		n, err := base.copyBlocks(&buf, nil, tt.index, tt.count)
+		if (err == nil) != tt.ok {
+			t.Errorf("copyBlocks(%d, %d) returned error %v, want ok %v", tt.index, tt.count, err, tt.ok)
+			continue
+		}
+		if n != tt.want || int64(buf.Len()) != tt.want {
+			t.Errorf("copyBlocks(%d, %d) copied %d bytes, want %d", tt.index, tt.count, n, tt.want)
+		}
+	}
+}
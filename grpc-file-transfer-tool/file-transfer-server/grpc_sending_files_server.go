@@ -1,40 +1,152 @@
 package main
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"net"
+	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 
 	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
 )
 
 // GrpcStreamServer gRPC流服务端
 type GrpcStreamServer struct {
 	logger zerolog.Logger
 	cfg    *GrpcStreamServerCfg
-	srv    *grpc.Server
-	l      net.Listener
+	// srv 在TCP监听地址上提供服务, 配置了证书时使用TLS
+	srv *grpc.Server
+	// localSrv 在unix socket上以明文提供服务, 没有配置证书时就是srv
+	localSrv  *grpc.Server
+	listeners []listener
+	health    *health.Server
+	sessions  *sessionRegistry
+	ranges    *rangedRegistry
+	limiter   *rate.Limiter
+	quota     *quotaTracker
+	certs     *certReloader
+	storage   Storage
+	metrics   *serverMetrics
+	tracer    trace.Tracer
+	// shutdownTracing 导出剩余的span并关闭exporter
+	shutdownTracing func(context.Context) error
+	// metricsSrv 在MetricsAddr上提供/metrics, 没有配置时为nil
+	metricsSrv      *http.Server
+	metricsListener net.Listener
+	done            chan struct{}
 }
 
 // GrpcStreamServerCfg gRPC流服务端配置
 type GrpcStreamServerCfg struct {
-	Port int    `json:"port"`
-	Cert string `json:"cert"`
-	Key  string `json:"key"`
+	Port int `json:"port"`
+	// Listen 监听地址, 支持"host:port", "[::1]:port"和"unix:///path/to/socket", 为空时监听所有网卡上的Port.
+	// unix socket上不使用TLS, 由文件权限控制访问, 因此不能与ClientCA和AllowedSubjects一起使用
+	Listen     []string `json:"listen"`
+	Cert       string   `json:"cert"`
+	Key        string   `json:"key"`
+	StorageDir string   `json:"storage_dir"`
+	// SessionExpiry 未完成的可续传上传保留多久, 超时后临时文件会被删除
+	SessionExpiry time.Duration `json:"session_expiry"`
+	// RateLimit 所有上传和下载共享的每秒最多传输字节数, 0表示不限速
+	RateLimit int64 `json:"rate_limit"`
+	// ClientCA 用于校验客户端证书的CA, 配置后客户端必须提供证书(双向认证)
+	ClientCA string `json:"client_ca"`
+	// AllowedSubjects 允许上传的客户端证书主题(CN或者完整DN), 为空时不限制
+	AllowedSubjects []string `json:"allowed_subjects"`
+	// TokenFile 静态令牌文件, 每行格式为"<name> <token> <permissions>"
+	TokenFile string `json:"token_file"`
+	// JWTSecretFile 校验HMAC签名JWT令牌的密钥文件
+	JWTSecretFile string `json:"jwt_secret_file"`
+	// MaxFileSize 单个文件的最大字节数, 0表示不限制
+	MaxFileSize int64 `json:"max_file_size"`
+	// ClientQuota 每个客户端(按令牌名字, 客户端证书CN或者对端地址区分)最多占用的存储字节数, 0表示不限制
+	ClientQuota int64 `json:"client_quota"`
+	// MinDiskFree 存储目录所在磁盘至少保留的空闲字节数, 0表示不检查
+	MinDiskFree int64 `json:"min_disk_free"`
+	// MaxConcurrentUploads 同时进行的上传(多流上传的每条流各算一个)的最大数量, 0表示不限制
+	MaxConcurrentUploads int `json:"max_concurrent_uploads"`
+	// MaxConcurrentUploadsPerClient 每个客户端同时进行的上传的最大数量, 0表示不限制
+	MaxConcurrentUploadsPerClient int `json:"max_concurrent_uploads_per_client"`
+	// UploadQueueSize 超出并发限制时最多允许多少个上传排队等待, 0表示直接拒绝
+	UploadQueueSize int `json:"upload_queue_size"`
+	// UploadQueueTimeout 上传最多排队等待多久
+	UploadQueueTimeout time.Duration `json:"upload_queue_timeout"`
+	// RetryAfter 拒绝上传时建议客户端多久之后重试
+	RetryAfter time.Duration `json:"retry_after"`
+	// CertReloadInterval 检查证书和私钥文件是否被修改的间隔, 修改后自动重新加载, 0表示不检查
+	CertReloadInterval time.Duration `json:"cert_reload_interval"`
+	// MetricsAddr 提供prometheus指标的HTTP监听地址, 例如":9090", 为空时不提供
+	MetricsAddr string `json:"metrics_addr"`
+	// TraceExporter OpenTelemetry span的导出方式, 可以是"stdout", "otlp"或者"file:<path>", 为空时不导出
+	TraceExporter string `json:"trace_exporter"`
+	// StorageBackend 已上传文件的存储后端, 可以是"local"(默认, 保存在StorageDir下), "memory"或者"s3".
+	// 可续传上传和多流上传的临时文件总是保存在StorageDir下
+	StorageBackend string `json:"storage_backend"`
+	// S3Endpoint S3兼容对象存储的地址, 例如"127.0.0.1:9000"
+	S3Endpoint string `json:"s3_endpoint"`
+	S3Bucket   string `json:"s3_bucket"`
+	S3Region   string `json:"s3_region"`
+	// S3AccessKey和S3SecretKey 访问对象存储的凭证, 建议通过环境变量给出
+	S3AccessKey string `json:"s3_access_key"`
+	S3SecretKey string `json:"s3_secret_key"`
+	// S3Prefix 对象名的前缀, 例如"uploads/"
+	S3Prefix string `json:"s3_prefix"`
+	// S3Insecure 使用http而不是https访问对象存储
+	S3Insecure bool `json:"s3_insecure"`
+	// Dedup 按内容的SHA-256保存文件, 内容相同的文件只占用一份空间, 并支持HasContent接口
+	Dedup bool `json:"dedup"`
 }
 
 // NewGrpcStreamServer 返回GrpcStreamServer实例.
 func NewGrpcStreamServer(cfg *GrpcStreamServerCfg) (*GrpcStreamServer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.StorageDir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create storage directory '%s'", cfg.StorageDir)
+	}
+
+	storage, err := newStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+	logger := zerolog.New(os.Stdout).With().Str("from", "grpc stream server").Logger()
+	var quota *quotaTracker
+	if cfg.ClientQuota > 0 {
+		if quota, err = newQuotaTracker(cfg.StorageDir, storage, cfg.ClientQuota, logger); err != nil {
+			return nil, err
+		}
+	}
+
 	srv := &GrpcStreamServer{}
-	srv.logger = zerolog.New(os.Stdout).With().Str("from", "grpc stream server").Logger()
+	srv.logger = logger
 	srv.cfg = cfg
+	srv.sessions = newSessionRegistry()
+	srv.ranges = newRangedRegistry()
+	srv.limiter = common.NewRateLimiter(cfg.RateLimit, common.MaxChunkSize)
+	srv.quota = quota
+	srv.storage = storage
+	srv.done = make(chan struct{})
 	return srv, nil
 }
 
@@ -45,79 +157,621 @@ func (gsrv *GrpcStreamServer) Init() error {
 		err  error
 	)
 
-	gsrv.l, err = net.Listen("tcp", fmt.Sprintf(":%d", gsrv.cfg.Port))
-	if err != nil {
-		gsrv.logger.Error().Err(err).Msgf("failed to listen on port %d", gsrv.cfg.Port)
-		return errors.Wrapf(err, "failed to listen on port %d", gsrv.cfg.Port)
-	}
-
 	if gsrv.cfg.Cert != "" && gsrv.cfg.Key != "" {
-		creds, err := credentials.NewServerTLSFromFile(gsrv.cfg.Cert, gsrv.cfg.Key)
+		gsrv.certs, err = newCertReloader(gsrv.cfg.Cert, gsrv.cfg.Key)
 		if err != nil {
 			gsrv.logger.Error().Err(err).Msgf("failed to create tls-grpc-server using cert '%s' and key '%s'", gsrv.cfg.Cert, gsrv.cfg.Key)
 			return errors.Wrapf(err, "failed to create tls-grpc-server using cert '%s' and key '%s'", gsrv.cfg.Cert, gsrv.cfg.Key)
 		}
-		opts = append(opts, grpc.Creds(creds))
+		tlsCfg, err := serverTLSConfig(gsrv.cfg, gsrv.certs)
+		if err != nil {
+			gsrv.logger.Error().Err(err).Msgf("failed to create tls-grpc-server using cert '%s' and key '%s'", gsrv.cfg.Cert, gsrv.cfg.Key)
+			return errors.Wrapf(err, "failed to create tls-grpc-server using cert '%s' and key '%s'", gsrv.cfg.Cert, gsrv.cfg.Key)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
 	}
 
+	requests := &requestLogger{logger: gsrv.logger}
+	var (
+		unaryInterceptors  = []grpc.UnaryServerInterceptor{requests.UnaryServerInterceptor()}
+		streamInterceptors = []grpc.StreamServerInterceptor{requests.StreamServerInterceptor()}
+	)
+	tp, shutdownTracing, err := common.NewTracerProvider(gsrv.cfg.TraceExporter, "file-transfer-server")
+	if err != nil {
+		gsrv.logger.Error().Err(err).Msg("failed to create tracer provider")
+		return errors.Wrap(err, "failed to create tracer provider")
+	}
+	gsrv.tracer = tp.Tracer("file-transfer-server")
+	gsrv.shutdownTracing = shutdownTracing
+	if gsrv.cfg.TraceExporter != "" {
+		tracing := &tracingInterceptor{tracer: gsrv.tracer}
+		unaryInterceptors = append(unaryInterceptors, tracing.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, tracing.StreamServerInterceptor())
+	}
+	if gsrv.cfg.MetricsAddr != "" {
+		gsrv.metrics = newServerMetrics(gsrv)
+		unaryInterceptors = append(unaryInterceptors, gsrv.metrics.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, gsrv.metrics.StreamServerInterceptor())
+	}
+	if gsrv.cfg.TokenFile != "" || gsrv.cfg.JWTSecretFile != "" {
+		auth, err := newTokenAuthenticator(gsrv.cfg.TokenFile, gsrv.cfg.JWTSecretFile)
+		if err != nil {
+			gsrv.logger.Error().Err(err).Msg("failed to create token authenticator")
+			return errors.Wrap(err, "failed to create token authenticator")
+		}
+		unaryInterceptors = append(unaryInterceptors, auth.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, auth.StreamServerInterceptor())
+	}
+	if gsrv.cfg.MaxConcurrentUploads > 0 || gsrv.cfg.MaxConcurrentUploadsPerClient > 0 {
+		streamInterceptors = append(streamInterceptors, newAdmissionController(gsrv.cfg).StreamServerInterceptor())
+	}
+	localOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	}
+	opts = append(opts, localOpts...)
+
 	gsrv.srv = grpc.NewServer(opts...)
-	api.RegisterGrpcStreamServiceServer(gsrv.srv, gsrv)
+	gsrv.localSrv = gsrv.srv
+	if gsrv.certs != nil {
+		gsrv.localSrv = grpc.NewServer(localOpts...)
+	}
+	gsrv.health = health.NewServer()
+	gsrv.health.SetServingStatus(serviceName, healthpb.HealthCheckResponse_SERVING)
+	for _, srv := range gsrv.servers() {
+		api.RegisterGrpcStreamServiceServer(srv, gsrv)
+		healthpb.RegisterHealthServer(srv, gsrv.health)
+		reflection.Register(srv)
+	}
+
+	for _, addr := range gsrv.cfg.listenAddresses() {
+		l, err := listen(addr)
+		if err != nil {
+			gsrv.logger.Error().Err(err).Msgf("failed to listen on %s", addr)
+			for _, opened := range gsrv.listeners {
+				opened.Close() // nolint
+			}
+			return err
+		}
+		srv := gsrv.srv
+		if l.Addr().Network() == "unix" {
+			srv = gsrv.localSrv
+		}
+		gsrv.listeners = append(gsrv.listeners, listener{Listener: l, addr: addr, srv: srv})
+	}
+
+	if gsrv.metrics != nil {
+		gsrv.metricsListener, err = net.Listen("tcp", gsrv.cfg.MetricsAddr)
+		if err != nil {
+			gsrv.logger.Error().Err(err).Msgf("failed to listen on %s", gsrv.cfg.MetricsAddr)
+			for _, opened := range gsrv.listeners {
+				opened.Close() // nolint
+			}
+			return errors.Wrapf(err, "failed to listen on %s", gsrv.cfg.MetricsAddr)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(gsrv.metrics.registry, promhttp.HandlerOpts{}))
+		gsrv.metricsSrv = &http.Server{Handler: mux}
+	}
 
 	return nil
 }
 
+// servers 返回所有的gRPC服务端.
+func (gsrv *GrpcStreamServer) servers() []*grpc.Server {
+	if gsrv.localSrv == nil || gsrv.localSrv == gsrv.srv {
+		return []*grpc.Server{gsrv.srv}
+	}
+	return []*grpc.Server{gsrv.srv, gsrv.localSrv}
+}
+
 // Run 开始运行gRPC流服务端.
 func (gsrv *GrpcStreamServer) Run() {
-	if err := gsrv.srv.Serve(gsrv.l); err != nil {
-		gsrv.logger.Error().Err(err)
+	if gsrv.cfg.SessionExpiry > 0 {
+		go gsrv.expireSessionsLoop()
+	}
+	if gsrv.certs != nil && gsrv.cfg.CertReloadInterval > 0 {
+		go gsrv.watchCertLoop()
+	}
+
+	var wg sync.WaitGroup
+	for _, l := range gsrv.listeners {
+		wg.Add(1)
+		go func(l listener) {
+			defer wg.Done()
+			gsrv.logger.Info().Str("listen", l.addr).Msg("start serving")
+			if err := l.srv.Serve(l); err != nil {
+				gsrv.logger.Error().Err(err).Msgf("failed to serve on %s", l.addr)
+			}
+		}(l)
+	}
+	if gsrv.metricsSrv != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gsrv.logger.Info().Str("listen", gsrv.cfg.MetricsAddr).Msg("start serving metrics")
+			if err := gsrv.metricsSrv.Serve(gsrv.metricsListener); err != nil && err != http.ErrServerClosed {
+				gsrv.logger.Error().Err(err).Msgf("failed to serve metrics on %s", gsrv.cfg.MetricsAddr)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// ReloadCert 重新加载证书和私钥, 新的证书只用于之后的TLS握手, 已经建立的连接不受影响.
+func (gsrv *GrpcStreamServer) ReloadCert() error {
+	if gsrv.certs == nil {
+		return errors.Errorf("tls is not enabled")
+	}
+	if err := gsrv.certs.reload(); err != nil {
+		gsrv.logger.Error().Err(err).Msg("failed to reload cert, keep using the old one")
+		return err
+	}
+	gsrv.logger.Info().Str("cert", gsrv.cfg.Cert).Str("key", gsrv.cfg.Key).Msg("cert reloaded")
+	return nil
+}
+
+// watchCertLoop 定期检查证书和私钥文件, 发生修改时自动重新加载.
+func (gsrv *GrpcStreamServer) watchCertLoop() {
+	ticker := time.NewTicker(gsrv.cfg.CertReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gsrv.done:
+			return
+		case <-ticker.C:
+			if gsrv.certs.changed() {
+				gsrv.ReloadCert() // nolint
+			}
+		}
 	}
 }
 
 // Close 停止运行gRPC流服务端.
 func (gsrv *GrpcStreamServer) Close() {
+	close(gsrv.done)
+	if gsrv.health != nil {
+		// let load balancers and health probes stop sending new calls while in-flight ones finish
+		gsrv.health.Shutdown()
+	}
 	if gsrv.srv != nil {
-		gsrv.srv.GracefulStop()
+		for _, srv := range gsrv.servers() {
+			srv.GracefulStop()
+		}
+	}
+	if gsrv.metricsSrv != nil {
+		gsrv.metricsSrv.Close() // nolint
+	}
+	if gsrv.shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := gsrv.shutdownTracing(ctx); err != nil {
+			gsrv.logger.Error().Err(err).Msg("failed to flush spans")
+		}
 	}
 }
 
 // Upload 实现文件传输接口.
 func (gsrv *GrpcStreamServer) Upload(stream api.GrpcStreamService_UploadServer) error {
-	var failed bool
+	var (
+		failed bool
+		// interrupted 上传因为重试可能成功的原因失败时, 返回给客户端的gRPC状态码
+		interrupted codes.Code
+		written     int64
+		trailer     *api.FileTrailer
+	)
+
+	if err := gsrv.authorizeUpload(stream.Context()); err != nil {
+		return err
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		gsrv.logger.Error().Err(err).Msg("failed to read file meta from stream")
+		return status.Error(codes.Aborted, "failed to read file meta")
+	}
+	meta := first.GetMeta()
+	name, err := validateFileMeta(meta)
+	if err != nil {
+		gsrv.logger.Error().Err(err).Msg("received invalid file meta")
+		return gsrv.sendUploadStatus(stream, api.UploadStatusCode_STATUS_CODE_FAILED, err.Error())
+	}
+	// quota and storage must agree on the name, e.g. "a//b" and "a/b" are the same file
+	meta.Name = name
+	h, err := common.NewChecksum(meta.GetChecksumAlgorithm())
+	if err != nil {
+		gsrv.logger.Error().Err(err).Msg("received invalid file meta")
+		return gsrv.sendUploadStatus(stream, api.UploadStatusCode_STATUS_CODE_FAILED, err.Error())
+	}
+	client := clientName(stream.Context())
+	if err = gsrv.admitUpload(client, meta); err != nil {
+		gsrv.logger.Error().Err(err).Str("client", client).Str("file", meta.GetName()).Msg("upload rejected")
+		// the upload can not succeed, drop what the other streams or an earlier attempt left behind
+		// but never the upload of another client or file
+		if id := meta.GetSessionId(); id != "" && meta.GetParts() > 1 {
+			gsrv.ranges.abortOwned(id, client, name)
+		} else if id != "" && gsrv.sessions.acquire(id) {
+			if owner, err := loadSessionOwner(gsrv.cfg.StorageDir, id); err == nil && (owner == nil || owner.is(client, name)) {
+				removeSession(gsrv.cfg.StorageDir, id) // nolint
+			}
+			gsrv.sessions.release(id)
+		}
+		return err
+	}
+
+	if meta.GetParts() > 1 {
+		return gsrv.uploadRange(stream, meta, h)
+	}
+	if meta.GetDeltaBlockSize() > 0 {
+		return gsrv.uploadDelta(stream, meta, h)
+	}
+
+	var (
+		w  Writer
+		fd *os.File
+	)
+	ctx := stream.Context()
+	sessionID := meta.GetSessionId()
+	if sessionID != "" {
+		if !gsrv.sessions.acquire(sessionID) {
+			// most likely the server has not noticed yet that the stream of an earlier attempt broke
+			gsrv.logger.Error().Str("session", sessionID).Msg("session is being uploaded by another stream")
+			return status.Errorf(codes.Aborted, "session '%s' is being uploaded by another stream", sessionID)
+		}
+		defer gsrv.sessions.release(sessionID)
+
+		if err = bindSession(gsrv.cfg.StorageDir, sessionID, client, name); err != nil {
+			if status.Code(err) == codes.PermissionDenied {
+				gsrv.logger.Error().Err(err).Str("client", client).Str("file", name).Msg("upload rejected")
+				return err
+			}
+			gsrv.logger.Error().Err(err).Msg("failed to prepare storage for upload")
+			return status.Error(codes.Unavailable, "failed to prepare storage for upload")
+		}
+		// the session is done once its file has been committed or removed
+		defer releaseSessionOwner(gsrv.cfg.StorageDir, sessionID)
+
+		if fd, err = openSessionFile(gsrv.cfg.StorageDir, sessionID, meta.GetOffset()); err == nil && h != nil {
+			// the checksum covers the whole file, so feed it with what we already have
+			if _, err = io.CopyN(h, io.NewSectionReader(fd, 0, meta.GetOffset()), meta.GetOffset()); err != nil {
+				fd.Close() // nolint
+			}
+		}
+		if err == nil {
+			// the session file stays local so that the upload can be resumed, the storage takes it on commit
+			w = newStagedWriter(gsrv.storage, fd, name)
+		}
+		written = meta.GetOffset()
+		if written > 0 {
+			gsrv.logger.Info().Str("session", sessionID).Int64("offset", written).Msg("resume upload")
+		}
+	} else {
+		w, err = gsrv.storage.Create(ctx, name)
+	}
+	if err != nil {
+		gsrv.logger.Error().Err(err).Msg("failed to prepare storage for upload")
+		return status.Error(codes.Unavailable, "failed to prepare storage for upload")
+	}
+
+	recvOps := common.NewOpSpans(ctx, gsrv.tracer, "recv")
+	writeOps := common.NewOpSpans(ctx, gsrv.tracer, "write")
+	defer func() {
+		trace.SpanFromContext(ctx).SetAttributes(append(recvOps.Attributes(), writeOps.Attributes()...)...)
+	}()
 
 RECV_LOOP:
 	for {
-		_, err := stream.Recv()
+		recvAt := time.Now()
+		chunk, err := stream.Recv()
+		recvOps.Observe(recvAt, len(chunk.GetContent()))
 		if err != nil {
 			if err == io.EOF {
 				failed = false
 			} else {
 				gsrv.logger.Error().Err(err).Msg("failed unexpectedly while reading chunks from stream")
-				failed = true
+				failed, interrupted = true, codes.Aborted
 			}
 			break RECV_LOOP
 		}
-		// TODO: store the uploaded file
+		if trailer != nil {
+			gsrv.logger.Error().Str("file", meta.GetName()).Msg("received data after file trailer")
+			failed = true
+			break RECV_LOOP
+		}
+		if chunk.GetTrailer() != nil {
+			trailer = chunk.GetTrailer()
+			continue
+		}
+		content := chunk.GetContent()
+		if err = common.WaitBytes(stream.Context(), gsrv.limiter, len(content)); err != nil {
+			gsrv.logger.Error().Err(err).Msg("failed to wait for bandwidth")
+			failed, interrupted = true, codes.Aborted
+			break RECV_LOOP
+		}
+		if written+int64(len(content)) > meta.GetSize() {
+			gsrv.logger.Error().Str("file", meta.GetName()).Msgf("received more than the declared %d bytes", meta.GetSize())
+			failed = true
+			break RECV_LOOP
+		}
+		if written/diskCheckInterval != (written+int64(len(content)))/diskCheckInterval {
+			if err = gsrv.checkDiskFree(meta.GetSize() - written); err != nil {
+				gsrv.logger.Error().Err(err).Str("file", meta.GetName()).Msg("upload aborted")
+				w.Abort() // nolint
+				return err
+			}
+		}
+		writeAt := time.Now()
+		_, err = w.Write(content)
+		writeOps.Observe(writeAt, len(content))
+		if err != nil {
+			gsrv.logger.Error().Err(err).Msgf("failed to write chunk of file '%s'", name)
+			failed, interrupted = true, codes.Unavailable
+			break RECV_LOOP
+		}
+		if h != nil {
+			h.Write(content) // nolint
+		}
+		written += int64(len(content))
+	}
+	if !failed && written != meta.GetSize() {
+		gsrv.logger.Error().Str("file", meta.GetName()).Msgf("received %d bytes, but %d bytes were declared", written, meta.GetSize())
+		failed = true
+		if written < meta.GetSize() && trailer == nil {
+			// the client stopped sending early, e.g. on a local read error, and may resume later
+			interrupted = codes.Aborted
+		}
+	}
+
+	if failed {
+		if interrupted == codes.OK {
+			w.Abort() // nolint
+			return gsrv.sendUploadStatus(stream, api.UploadStatusCode_STATUS_CODE_FAILED, "Upload Failed")
+		}
+		if sessionID != "" {
+			// keep what we have received, the client may resume later
+			suspendSessionFile(fd)
+		} else {
+			w.Abort() // nolint
+		}
+		return status.Error(interrupted, "upload interrupted")
 	}
 
-	if !failed {
-		gsrv.logger.Info().Msg("upload successfully")
+	if h != nil {
+		if trailer == nil {
+			gsrv.logger.Error().Str("file", meta.GetName()).Msg("missing file trailer with checksum")
+			w.Abort() // nolint
+			return gsrv.sendUploadStatus(stream, api.UploadStatusCode_STATUS_CODE_FAILED, "Upload Failed")
+		}
+		if sum := h.Sum(nil); !bytes.Equal(sum, trailer.GetChecksum()) {
+			gsrv.logger.Error().Str("file", meta.GetName()).Str("algorithm", meta.GetChecksumAlgorithm().String()).
+				Msgf("checksum mismatch, expected %x, got %x", trailer.GetChecksum(), sum)
+			w.Abort() // nolint
+			return gsrv.sendUploadStatus(stream, api.UploadStatusCode_STATUS_CODE_CHECKSUM_MISMATCH, "Checksum Mismatch")
+		}
+	}
 
-		if err := stream.SendAndClose(&api.UploadStatus{
-			Message: "Successfully Upload",
-			Code:    api.UploadStatusCode_STATUS_CODE_OK,
+	if s, ok := w.(syncer); ok {
+		if err = gsrv.fsync(ctx, s); err != nil {
+			gsrv.logger.Error().Err(err).Msgf("failed to sync file '%s'", name)
+			w.Abort() // nolint
+			return status.Error(codes.Unavailable, "failed to sync uploaded file")
+		}
+	}
+	commitCtx, commitSpan := gsrv.tracer.Start(ctx, "commit")
+	err = gsrv.quota.commit(client, name, written, func() error { return w.Commit(commitCtx, meta) })
+	commitSpan.End()
+	if err != nil {
+		w.Abort() // nolint
+		if _, ok := err.(*quotaError); ok {
+			gsrv.logger.Error().Err(err).Str("client", client).Str("file", meta.GetName()).Msg("upload aborted")
+			return err
+		}
+		gsrv.logger.Error().Err(err).Msg("failed to commit uploaded file")
+		return status.Error(codes.Unavailable, "failed to commit uploaded file")
+	}
+
+	gsrv.logger.Info().Str("transfer_id", transferIDFromContext(stream.Context())).Str("client", client).Str("file", name).Int64("size", written).Str("content_type", meta.GetContentType()).Msg("upload successfully")
+	return gsrv.sendUploadStatus(stream, api.UploadStatusCode_STATUS_CODE_OK, "Successfully Upload")
+}
+
+// admitUpload 在接收数据之前检查文件大小, 客户端配额和磁盘剩余空间.
+func (gsrv *GrpcStreamServer) admitUpload(client string, meta *api.FileMeta) error {
+	if err := gsrv.checkFileSize(meta.GetSize()); err != nil {
+		return err
+	}
+	if err := gsrv.quota.check(client, meta.GetName(), meta.GetSize()); err != nil {
+		return err
+	}
+	pending := meta.GetSize() - meta.GetOffset()
+	if meta.GetParts() > 1 {
+		pending = meta.GetLength()
+	}
+	return gsrv.checkDiskFree(pending)
+}
+
+// sendUploadStatus 向客户端返回上传结果并关闭流.
+func (gsrv *GrpcStreamServer) sendUploadStatus(stream api.GrpcStreamService_UploadServer, code api.UploadStatusCode, msg string) error {
+	if err := stream.SendAndClose(&api.UploadStatus{
+		Message:    msg,
+		Code:       code,
+		TransferId: transferIDFromContext(stream.Context()),
+	}); err != nil {
+		gsrv.logger.Error().Err(err).Msg("failed to send status code")
+		return errors.Wrapf(err, "failed to send status code")
+	}
+	return nil
+}
+
+// QueryUploadOffset 返回可续传上传在服务端已持久化的字节数.
+func (gsrv *GrpcStreamServer) QueryUploadOffset(ctx context.Context, req *api.UploadSession) (*api.UploadOffset, error) {
+	if err := gsrv.authorizeUpload(ctx); err != nil {
+		return nil, err
+	}
+	if err := validateSessionID(req.GetSessionId()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	owner, err := loadSessionOwner(gsrv.cfg.StorageDir, req.GetSessionId())
+	if err != nil {
+		gsrv.logger.Error().Err(err).Str("session", req.GetSessionId()).Msg("failed to query upload offset")
+		return nil, status.Error(codes.Internal, "failed to query upload offset")
+	}
+	if owner != nil && owner.Client != clientName(ctx) {
+		return nil, status.Errorf(codes.PermissionDenied, "session '%s' belongs to another client", req.GetSessionId())
+	}
+	offset, err := sessionOffset(gsrv.cfg.StorageDir, req.GetSessionId())
+	if err != nil {
+		gsrv.logger.Error().Err(err).Str("session", req.GetSessionId()).Msg("failed to query upload offset")
+		return nil, status.Error(codes.Internal, "failed to query upload offset")
+	}
+	return &api.UploadOffset{Offset: offset}, nil
+}
+
+// HasContent 查询服务端是否已有内容相同的文件, 请求中带有文件元信息时直接以该文件名保存这份内容,
+// 客户端因此可以跳过上传.
+func (gsrv *GrpcStreamServer) HasContent(ctx context.Context, req *api.ContentQuery) (*api.ContentStatus, error) {
+	if err := gsrv.authorizeUpload(ctx); err != nil {
+		return nil, err
+	}
+	dedup, ok := gsrv.storage.(*dedupStorage)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "content addressed storage is not enabled")
+	}
+	if len(req.GetSha256()) != sha256.Size {
+		return nil, status.Errorf(codes.InvalidArgument, "sha256 must be %d bytes", sha256.Size)
+	}
+	hash := hex.EncodeToString(req.GetSha256())
+	size, ok := dedup.contentSize(hash)
+	if !ok || req.GetMeta() == nil {
+		return &api.ContentStatus{Exists: ok}, nil
+	}
+
+	name, err := cleanName(req.GetMeta().GetName())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err = gsrv.checkFileSize(size); err != nil {
+		return nil, err
+	}
+	client := clientName(ctx)
+	err = gsrv.quota.commit(client, name, size, func() error { return dedup.link(ctx, name, hash, req.GetMeta()) })
+	if err != nil {
+		if os.IsNotExist(err) {
+			// the last copy went away meanwhile
+			return &api.ContentStatus{Exists: false}, nil
+		}
+		if _, ok := err.(*quotaError); ok {
+			gsrv.logger.Error().Err(err).Str("client", client).Str("file", name).Msg("upload aborted")
+			return nil, err
+		}
+		gsrv.logger.Error().Err(err).Str("file", name).Msg("failed to store existing content")
+		return nil, status.Error(codes.Internal, "failed to store existing content")
+	}
+
+	gsrv.logger.Info().Str("transfer_id", transferIDFromContext(ctx)).Str("client", client).Str("file", name).Int64("size", size).Str("sha256", hash).Msg("upload deduplicated")
+	return &api.ContentStatus{Exists: true, Stored: true}, nil
+}
+
+// sessionBusy 判断会话是否正在被上传.
+func (gsrv *GrpcStreamServer) sessionBusy(id string) bool {
+	return gsrv.sessions.busy(id) || gsrv.ranges.busy(id)
+}
+
+// expireSessionsLoop 定期清理过期的可续传上传.
+func (gsrv *GrpcStreamServer) expireSessionsLoop() {
+	interval := gsrv.cfg.SessionExpiry / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gsrv.done:
+			return
+		case <-ticker.C:
+			expired, err := expireSessions(gsrv.cfg.StorageDir, gsrv.cfg.SessionExpiry, gsrv.sessionBusy)
+			if err != nil {
+				gsrv.logger.Error().Err(err).Msg("failed to expire upload sessions")
+			}
+			expired = append(expired, gsrv.ranges.expire(gsrv.cfg.SessionExpiry)...)
+			for _, id := range expired {
+				gsrv.logger.Info().Str("session", id).Msg("upload session expired")
+			}
+		}
+	}
+}
+
+// Download 实现文件下载接口.
+func (gsrv *GrpcStreamServer) Download(req *api.DownloadRequest, stream api.GrpcStreamService_DownloadServer) error {
+	if req.GetChunkSize() <= 0 || req.GetChunkSize() > common.MaxChunkSize {
+		return status.Errorf(codes.InvalidArgument, "chunk size must be in (0, %d]", common.MaxChunkSize)
+	}
+	name, err := cleanName(req.GetName())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	h, err := common.NewChecksum(req.GetChecksumAlgorithm())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	rc, meta, err := gsrv.storage.Open(stream.Context(), name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return status.Errorf(codes.NotFound, "file '%s' not found", req.GetName())
+		}
+		gsrv.logger.Error().Err(err).Msgf("failed to open file '%s'", name)
+		return status.Errorf(codes.Internal, "failed to open file '%s'", req.GetName())
+	}
+	defer rc.Close()
+
+	meta.Name = req.GetName()
+	meta.ChecksumAlgorithm = req.GetChecksumAlgorithm()
+	if err = stream.Send(&api.FileChunk{
+		Data: &api.FileChunk_Meta{Meta: meta},
+	}); err != nil {
+		gsrv.logger.Error().Err(err).Msg("failed to send file meta via grpc stream")
+		return err
+	}
+
+	buffer := make([]byte, req.GetChunkSize())
+SEND_LOOP:
+	for {
+		// fill whole chunks, object store readers may return short reads
+		n, err := io.ReadFull(rc, buffer)
+		if err == io.EOF {
+			break SEND_LOOP
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			gsrv.logger.Error().Err(err).Msgf("failed unexpectedly while reading file '%s'", name)
+			return status.Errorf(codes.Internal, "failed to read file '%s'", req.GetName())
+		}
+		if err = common.WaitBytes(stream.Context(), gsrv.limiter, n); err != nil {
+			gsrv.logger.Error().Err(err).Msg("failed to wait for bandwidth")
+			return status.Error(codes.Aborted, "download interrupted")
+		}
+		if err = stream.Send(&api.FileChunk{
+			Data: &api.FileChunk_Content{Content: buffer[:n]},
 		}); err != nil {
-			gsrv.logger.Error().Err(err).Msg("failed to send status code")
-			return errors.Wrapf(err, "failed to send status code")
+			gsrv.logger.Error().Err(err).Msg("failed to send chunk via grpc stream")
+			return err
 		}
-	} else {
-		if err := stream.SendAndClose(&api.UploadStatus{
-			Message: "Upload Failed",
-			Code:    api.UploadStatusCode_STATUS_CODE_FAILED,
+		if h != nil {
+			h.Write(buffer[:n]) // nolint
+		}
+	}
+
+	if h != nil {
+		if err = stream.Send(&api.FileChunk{
+			Data: &api.FileChunk_Trailer{Trailer: &api.FileTrailer{Checksum: h.Sum(nil)}},
 		}); err != nil {
-			gsrv.logger.Error().Err(err).Msg("failed to send status code")
-			return errors.Wrapf(err, "failed to send status code")
+			gsrv.logger.Error().Err(err).Msg("failed to send file trailer via grpc stream")
+			return err
 		}
 	}
 
+	gsrv.logger.Info().Str("transfer_id", transferIDFromContext(stream.Context())).Str("client", clientName(stream.Context())).Str("file", name).Int64("size", meta.GetSize()).Msg("download successfully")
 	return nil
 }
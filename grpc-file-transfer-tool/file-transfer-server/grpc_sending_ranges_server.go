@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// rangedUpload 一个被拆分为多个区间, 由多条流并发上传的文件
+type rangedUpload struct {
+	mu sync.Mutex
+	fd *os.File
+	// client 创建上传的客户端, name 上传的文件名, 其余区间只能由同一客户端为同一文件上传
+	client string
+	name   string
+	size   int64
+	parts  int32
+	// claimed 已经有流在上传或者已经收到的区间, 按起始位置记录长度
+	claimed  map[int64]int64
+	received map[int64]int64
+	streams  int
+	aborted  bool
+	activeAt time.Time
+}
+
+// rangedRegistry 记录正在进行中的多流上传
+type rangedRegistry struct {
+	mu      sync.Mutex
+	uploads map[string]*rangedUpload
+}
+
+func newRangedRegistry() *rangedRegistry {
+	return &rangedRegistry{uploads: make(map[string]*rangedUpload)}
+}
+
+// join 加入多流上传, 第一个到达的流负责创建并预分配临时文件.
+func (r *rangedRegistry) join(dir, client string, meta *api.FileMeta) (*rangedUpload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := meta.GetSessionId()
+	if u, ok := r.uploads[id]; ok {
+		if u.client != client || u.name != meta.GetName() {
+			return nil, status.Errorf(codes.PermissionDenied, "session '%s' belongs to another client or file", id)
+		}
+		if u.size != meta.GetSize() || u.parts != meta.GetParts() {
+			return nil, errors.Errorf("session '%s' was started with a different file size or number of parts", id)
+		}
+		u.streams++
+		u.activeAt = time.Now()
+		return u, nil
+	}
+
+	// never truncate the session file of a resumable upload
+	owner, err := loadSessionOwner(dir, id)
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil {
+		return nil, status.Errorf(codes.PermissionDenied, "session '%s' belongs to another client or file", id)
+	}
+	fd, err := os.OpenFile(sessionFilePath(dir, id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open session file for '%s'", id)
+	}
+	if err = fd.Truncate(meta.GetSize()); err != nil {
+		abortTempFile(fd)
+		return nil, errors.Wrapf(err, "failed to preallocate session file for '%s'", id)
+	}
+	u := &rangedUpload{
+		fd:       fd,
+		client:   client,
+		name:     meta.GetName(),
+		size:     meta.GetSize(),
+		parts:    meta.GetParts(),
+		claimed:  make(map[int64]int64),
+		received: make(map[int64]int64),
+		streams:  1,
+		activeAt: time.Now(),
+	}
+	r.uploads[id] = u
+	return u, nil
+}
+
+// leave 离开多流上传, 上传已完成或者已失败时移除记录, 否则等待其余区间的流到达.
+func (r *rangedRegistry) leave(id string, u *rangedUpload) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u.streams--
+	u.activeAt = time.Now()
+	if u.streams > 0 {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.aborted || u.complete() {
+		delete(r.uploads, id)
+	}
+}
+
+// expire 清理超过有效期没有任何流在上传的多流上传.
+func (r *rangedRegistry) expire(expiry time.Duration) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var expired []string
+	for id, u := range r.uploads {
+		if u.streams > 0 || time.Since(u.activeAt) < expiry {
+			continue
+		}
+		delete(r.uploads, id)
+
+		u.mu.Lock()
+		if !u.aborted {
+			u.aborted = true
+			abortTempFile(u.fd)
+		}
+		u.mu.Unlock()
+		expired = append(expired, id)
+	}
+	return expired
+}
+
+// abort 放弃多流上传并删除临时文件, 其余区间的流会在提交时发现上传已失败.
+func (r *rangedRegistry) abort(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if u, ok := r.uploads[id]; ok {
+		r.abortLocked(id, u)
+	}
+}
+
+// abortOwned 与abort相同, 但只放弃client为name创建的多流上传.
+func (r *rangedRegistry) abortOwned(id, client, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if u, ok := r.uploads[id]; ok && u.client == client && u.name == name {
+		r.abortLocked(id, u)
+	}
+}
+
+// abortLocked 放弃多流上传, 调用方需持有r.mu.
+func (r *rangedRegistry) abortLocked(id string, u *rangedUpload) {
+	u.mu.Lock()
+	if !u.aborted {
+		u.aborted = true
+		abortTempFile(u.fd)
+	}
+	u.mu.Unlock()
+	if u.streams == 0 {
+		delete(r.uploads, id)
+	}
+}
+
+// busy 判断会话是否正在进行多流上传.
+func (r *rangedRegistry) busy(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.uploads[id]
+	return ok
+}
+
+// claim 占用区间[offset, offset+length), 与其余流的区间重叠时返回错误.
+func (u *rangedUpload) claim(offset, length int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.aborted {
+		return status.Error(codes.Aborted, "upload has been aborted by another stream")
+	}
+	if int32(len(u.claimed)) >= u.parts {
+		return errors.Errorf("all the %d parts have been claimed", u.parts)
+	}
+	for start, n := range u.claimed {
+		if offset < start+n && start < offset+length {
+			return errors.Errorf("range [%d, %d) overlaps range [%d, %d)", offset, offset+length, start, start+n)
+		}
+	}
+	u.claimed[offset] = length
+	return nil
+}
+
+// complete 判断收到的区间是否恰好连续地覆盖了整个文件, 调用方需持有u.mu.
+func (u *rangedUpload) complete() bool {
+	if int32(len(u.received)) != u.parts {
+		return false
+	}
+	offsets := make([]int64, 0, len(u.received))
+	for offset := range u.received {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	var next int64
+	for _, offset := range offsets {
+		if offset != next {
+			return false
+		}
+		next += u.received[offset]
+	}
+	return next == u.size
+}
+
+// uploadRange 接收文件的一个区间并用WriteAt写入临时文件, 最后一个完成的区间负责提交文件.
+func (gsrv *GrpcStreamServer) uploadRange(stream api.GrpcStreamService_UploadServer, meta *api.FileMeta, h hash.Hash) error {
+	var (
+		trailer *api.FileTrailer
+		offset  = meta.GetOffset()
+		end     = meta.GetOffset() + meta.GetLength()
+		client  = clientName(stream.Context())
+	)
+
+	u, err := gsrv.ranges.join(gsrv.cfg.StorageDir, client, meta)
+	if err != nil {
+		if status.Code(err) == codes.PermissionDenied {
+			gsrv.logger.Error().Err(err).Str("client", client).Str("file", meta.GetName()).Msg("upload rejected")
+			return err
+		}
+		gsrv.logger.Error().Err(err).Msg("failed to prepare storage for upload")
+		return status.Error(codes.Unavailable, "failed to prepare storage for upload")
+	}
+	defer gsrv.ranges.leave(meta.GetSessionId(), u)
+	if err = u.claim(offset, meta.GetLength()); err != nil {
+		gsrv.logger.Error().Err(err).Str("file", meta.GetName()).Msg("rejected range of parallel upload")
+		gsrv.ranges.abort(meta.GetSessionId())
+		if status.Code(err) == codes.Aborted {
+			return err
+		}
+		return gsrv.sendUploadStatus(stream, api.UploadStatusCode_STATUS_CODE_FAILED, "Upload Failed")
+	}
+
+	abort := func() {
+		u.mu.Lock()
+		if !u.aborted {
+			u.aborted = true
+			abortTempFile(u.fd)
+		}
+		u.mu.Unlock()
+	}
+	fail := func(code api.UploadStatusCode, msg string) error {
+		abort()
+		return gsrv.sendUploadStatus(stream, code, msg)
+	}
+	// interrupt 放弃上传并返回可重试的gRPC状态码, 客户端会重新上传所有区间
+	interrupt := func(code codes.Code, msg string) error {
+		abort()
+		return status.Error(code, msg)
+	}
+
+	ctx := stream.Context()
+	recvOps := common.NewOpSpans(ctx, gsrv.tracer, "recv")
+	writeOps := common.NewOpSpans(ctx, gsrv.tracer, "write")
+	defer func() {
+		trace.SpanFromContext(ctx).SetAttributes(append(recvOps.Attributes(), writeOps.Attributes()...)...)
+	}()
+
+RECV_LOOP:
+	for {
+		recvAt := time.Now()
+		chunk, err := stream.Recv()
+		recvOps.Observe(recvAt, len(chunk.GetContent()))
+		if err != nil {
+			if err == io.EOF {
+				break RECV_LOOP
+			}
+			gsrv.logger.Error().Err(err).Msg("failed unexpectedly while reading chunks from stream")
+			return interrupt(codes.Aborted, "upload stream broke")
+		}
+		if trailer != nil {
+			gsrv.logger.Error().Str("file", meta.GetName()).Msg("received data after file trailer")
+			return fail(api.UploadStatusCode_STATUS_CODE_FAILED, "Upload Failed")
+		}
+		if chunk.GetTrailer() != nil {
+			trailer = chunk.GetTrailer()
+			continue
+		}
+		content := chunk.GetContent()
+		if err = common.WaitBytes(stream.Context(), gsrv.limiter, len(content)); err != nil {
+			gsrv.logger.Error().Err(err).Msg("failed to wait for bandwidth")
+			return interrupt(codes.Aborted, "upload interrupted")
+		}
+		if offset+int64(len(content)) > end {
+			gsrv.logger.Error().Str("file", meta.GetName()).Msgf("received more than the declared range [%d, %d)", meta.GetOffset(), end)
+			return fail(api.UploadStatusCode_STATUS_CODE_FAILED, "Upload Failed")
+		}
+		if (offset-meta.GetOffset())/diskCheckInterval != (offset-meta.GetOffset()+int64(len(content)))/diskCheckInterval {
+			if err = gsrv.checkDiskFree(end - offset); err != nil {
+				gsrv.logger.Error().Err(err).Str("file", meta.GetName()).Msg("upload aborted")
+				abort()
+				return err
+			}
+		}
+		// os.File.WriteAt is safe for concurrent use with non-overlapping ranges
+		writeAt := time.Now()
+		_, err = u.fd.WriteAt(content, offset)
+		writeOps.Observe(writeAt, len(content))
+		if err != nil {
+			gsrv.logger.Error().Err(err).Msgf("failed to write chunk into temp file '%s'", u.fd.Name())
+			return interrupt(codes.Unavailable, "failed to write uploaded range")
+		}
+		if h != nil {
+			h.Write(content) // nolint
+		}
+		offset += int64(len(content))
+	}
+	if offset != end {
+		gsrv.logger.Error().Str("file", meta.GetName()).Msgf("received %d bytes, but range [%d, %d) was declared", offset-meta.GetOffset(), meta.GetOffset(), end)
+		return fail(api.UploadStatusCode_STATUS_CODE_FAILED, "Upload Failed")
+	}
+	if h != nil {
+		if trailer == nil {
+			gsrv.logger.Error().Str("file", meta.GetName()).Msg("missing file trailer with checksum")
+			return fail(api.UploadStatusCode_STATUS_CODE_FAILED, "Upload Failed")
+		}
+		if sum := h.Sum(nil); !bytes.Equal(sum, trailer.GetChecksum()) {
+			gsrv.logger.Error().Str("file", meta.GetName()).Str("algorithm", meta.GetChecksumAlgorithm().String()).
+				Msgf("checksum mismatch of range [%d, %d), expected %x, got %x", meta.GetOffset(), end, trailer.GetChecksum(), sum)
+			return fail(api.UploadStatusCode_STATUS_CODE_CHECKSUM_MISMATCH, "Checksum Mismatch")
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.aborted {
+		return status.Error(codes.Aborted, "upload has been aborted by another stream")
+	}
+	u.received[meta.GetOffset()] = meta.GetLength()
+	if !u.complete() {
+		return gsrv.sendUploadStatus(stream, api.UploadStatusCode_STATUS_CODE_OK, "Part Received")
+	}
+
+	if err = gsrv.fsync(ctx, u.fd); err != nil {
+		gsrv.logger.Error().Err(err).Msgf("failed to sync session file '%s'", u.fd.Name())
+		u.aborted = true
+		abortTempFile(u.fd)
+		return status.Error(codes.Unavailable, "failed to sync uploaded file")
+	}
+	w := newStagedWriter(gsrv.storage, u.fd, meta.GetName())
+	commitCtx, commitSpan := gsrv.tracer.Start(ctx, "commit")
+	err = gsrv.quota.commit(client, meta.GetName(), u.size, func() error { return w.Commit(commitCtx, meta) })
+	commitSpan.End()
+	if err != nil {
+		u.aborted = true
+		w.Abort() // nolint
+		if _, ok := err.(*quotaError); ok {
+			gsrv.logger.Error().Err(err).Str("client", client).Str("file", meta.GetName()).Msg("upload aborted")
+			return err
+		}
+		gsrv.logger.Error().Err(err).Msg("failed to commit uploaded file")
+		return status.Error(codes.Unavailable, "failed to commit uploaded file")
+	}
+
+	gsrv.logger.Info().Str("transfer_id", transferIDFromContext(stream.Context())).Str("client", client).Str("file", meta.GetName()).Int64("size", u.size).Int32("parts", u.parts).Str("content_type", meta.GetContentType()).Msg("upload successfully")
+	return gsrv.sendUploadStatus(stream, api.UploadStatusCode_STATUS_CODE_OK, "Successfully Upload")
+}
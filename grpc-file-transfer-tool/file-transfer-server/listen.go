@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// listener 一个监听地址及在其上提供服务的gRPC服务端
+type listener struct {
+	net.Listener
+	addr string
+	srv  *grpc.Server
+}
+
+// parseListenAddress 解析监听地址, 支持"host:port", "[::1]:port", "tcp://host:port"和"unix:///path/to/socket".
+func parseListenAddress(addr string) (network, address string, err error) {
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		network, address = "unix", strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "unix:"):
+		network, address = "unix", strings.TrimPrefix(addr, "unix:")
+	default:
+		network, address = "tcp", strings.TrimPrefix(addr, "tcp://")
+	}
+
+	if network == "unix" {
+		if address == "" {
+			return "", "", errors.Errorf("invalid listen address '%s', missing socket path", addr)
+		}
+		return network, address, nil
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", errors.Errorf("invalid listen address '%s', expected host:port, [ipv6]:port or unix:///path", addr)
+	}
+	// LookupPort takes an empty port for 0, which would listen on a random port
+	if _, err = net.LookupPort("tcp", port); err != nil || port == "" {
+		return "", "", errors.Errorf("invalid listen address '%s', bad port '%s'", addr, port)
+	}
+	return network, address, nil
+}
+
+// listen 监听addr, unix socket文件已存在且没有进程在监听时先删除它.
+func listen(addr string) (net.Listener, error) {
+	network, address, err := parseListenAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if fi, err := os.Lstat(address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			if conn, err := net.DialTimeout("unix", address, time.Second); err == nil {
+				conn.Close() // nolint
+				return nil, errors.Errorf("unix socket '%s' is in use by another process", address)
+			}
+			// left behind by a process that did not exit cleanly
+			os.Remove(address) // nolint
+		}
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on %s", addr)
+	}
+	return l, nil
+}
+
+// listenAddresses 返回所有监听地址, 没有配置Listen时监听所有网卡上的Port.
+func (cfg *GrpcStreamServerCfg) listenAddresses() []string {
+	if len(cfg.Listen) > 0 {
+		return cfg.Listen
+	}
+	return []string{fmt.Sprintf(":%d", cfg.Port)}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	tests := []struct {
+		addr             string
+		network, address string
+		ok               bool
+	}{
+		{"0.0.0.0:8999", "tcp", "0.0.0.0:8999", true},
+		{":8999", "tcp", ":8999", true},
+		{"localhost:8999", "tcp", "localhost:8999", true},
+		{"tcp://127.0.0.1:8999", "tcp", "127.0.0.1:8999", true},
+		{"[::1]:8999", "tcp", "[::1]:8999", true},
+		{"[::]:0", "tcp", "[::]:0", true},
+		{"127.0.0.1:https", "tcp", "127.0.0.1:https", true},
+		{"unix:///run/ft.sock", "unix", "/run/ft.sock", true},
+		{"unix:ft.sock", "unix", "ft.sock", true},
+		{"unix://", "", "", false},
+		{"unix:", "", "", false},
+		{"localhost", "", "", false},
+		{"8999", "", "", false},
+		{"::1:8999", "", "", false},
+		{"localhost:", "", "", false},
+		{"localhost:65536", "", "", false},
+		{"localhost:-1", "", "", false},
+		{"localhost:no-such-service", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		network, address, err := parseListenAddress(tt.addr)
+		if (err == nil) != tt.ok || network != tt.network || address != tt.address {
+			t.Errorf("parseListenAddress(%q) = %q, %q, %v, want %q, %q, ok %v", tt.addr, network, address, err, tt.network, tt.address, tt.ok)
+		}
+	}
+}
+
+func TestListenAddresses(t *testing.T) {
+	tests := []struct {
+		cfg  GrpcStreamServerCfg
+		want string
+	}{
+		{GrpcStreamServerCfg{Port: 8999}, "[:8999]"},
+		{GrpcStreamServerCfg{Port: 8999, Listen: []string{"127.0.0.1:9000", "unix:///run/ft.sock"}}, "[127.0.0.1:9000 unix:///run/ft.sock]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(tt.cfg.listenAddresses()); got != tt.want {
+			t.Errorf("listenAddresses() of %v = %s, want %s", tt.cfg.Listen, got, tt.want)
+		}
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "ft.sock")
+	addr := "unix://" + sock
+
+	l, err := listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = listen(addr); err == nil {
+		t.Error("listened on a socket in use by another listener")
+	}
+
+	// a socket left behind by a crashed process is replaced
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close() // nolint
+	if _, err = os.Lstat(sock); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = listen(addr); err != nil {
+		t.Fatalf("failed to replace a stale socket: %v", err)
+	}
+	l.Close() // nolint
+
+	// but never a regular file
+	if err = ioutil.WriteFile(sock, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = listen(addr); err == nil {
+		t.Error("listened on a path holding a regular file")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+type transferIDKey struct{}
+
+// withTransferID 取出客户端在metadata中带来的传输ID放入context, 没有或者不合法时生成一个新的.
+func withTransferID(ctx context.Context) (context.Context, string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := ""
+	if values := md.Get(common.TransferIDKey); len(values) > 0 && common.ValidTransferID(values[0]) {
+		id = values[0]
+	} else {
+		id = common.NewTransferID()
+	}
+	return context.WithValue(ctx, transferIDKey{}, id), id
+}
+
+// transferIDFromContext 返回本次请求的传输ID.
+func transferIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(transferIDKey{}).(string)
+	return id
+}
+
+// peerAddress 返回对端地址.
+func peerAddress(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// requestLogger 为每个请求记录一条日志, 包括对端, 接口, 文件, 字节数, 耗时, 结果和传输ID.
+type requestLogger struct {
+	logger zerolog.Logger
+}
+
+// UnaryServerInterceptor 返回记录请求日志的一元拦截器, 需要放在最前面以便其余拦截器拿到传输ID.
+func (l *requestLogger) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, id := withTransferID(ctx)
+		started := time.Now()
+		resp, err := handler(ctx, req)
+		l.log(err, resultCode(nil, err)).
+			Str("transfer_id", id).
+			Str("peer", peerAddress(ctx)).
+			Str("method", info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]).
+			Dur("duration", time.Since(started)).
+			Msg("request finished")
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor 返回记录请求日志的流拦截器, 需要放在最前面以便其余拦截器拿到传输ID.
+func (l *requestLogger) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, id := withTransferID(ss.Context())
+		ls := &loggedStream{ServerStream: ss, ctx: ctx}
+		started := time.Now()
+		err := handler(srv, ls)
+		l.log(err, resultCode(ls.status, err)).
+			Str("transfer_id", id).
+			Str("peer", peerAddress(ctx)).
+			Str("method", info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]).
+			Str("file", ls.file).
+			Int64("bytes", ls.bytes).
+			Dur("duration", time.Since(started)).
+			Msg("stream finished")
+		return err
+	}
+}
+
+func (l *requestLogger) log(err error, code string) *zerolog.Event {
+	if err != nil {
+		return l.logger.Error().Err(err).Str("status", code)
+	}
+	if code != "OK" {
+		return l.logger.Warn().Str("status", code)
+	}
+	return l.logger.Info().Str("status", code)
+}
+
+// loggedStream 记下流传输的文件, 文件内容字节数和上传结果, 并替换context以携带传输ID.
+type loggedStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	file   string
+	bytes  int64
+	status *api.UploadStatus
+}
+
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *loggedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	switch msg := m.(type) {
+	case *api.FileChunk:
+		if msg.GetMeta() != nil {
+			s.file = msg.GetMeta().GetName()
+		}
+		s.bytes += int64(len(msg.GetContent()))
+	case *api.DownloadRequest:
+		s.file = msg.GetName()
+	}
+	return nil
+}
+
+func (s *loggedStream) SendMsg(m interface{}) error {
+	switch msg := m.(type) {
+	case *api.FileChunk:
+		s.bytes += int64(len(msg.GetContent()))
+	case *api.UploadStatus:
+		s.status = msg
+	}
+	return s.ServerStream.SendMsg(m)
+}
@@ -2,24 +2,142 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 var (
-	portFlag     = flag.Int("port", 8999, "server port")
-	certFileFlag = flag.String("cert", "grpc-file-transfer-tool/cert/cert.pem", "cert file")
-	keyFileFlag  = flag.String("key", "grpc-file-transfer-tool/cert/key.pem", "private key file")
+	configFlag = flag.String("config", "", "json or yaml config file, see GrpcStreamServerCfg for the keys")
+
+	issueFlag      = flag.String("issue-jwt", "", "print a jwt for the given name signed with --jwt-secret-file and exit")
+	issuePermsFlag = flag.String("issue-jwt-permissions", "upload,download", "comma separated permissions of the issued jwt")
+	issueTTLFlag   = flag.Duration("issue-jwt-ttl", 24*time.Hour, "lifetime of the issued jwt")
 )
 
+// configFlags 命令行参数对应的配置项, 参数的默认值就是配置项的默认值.
+var configFlags = map[string]string{
+	"port":                   "port",
+	"listen":                 "listen",
+	"cert":                   "cert",
+	"key":                    "key",
+	"storage":                "storage_dir",
+	"session-expiry":         "session_expiry",
+	"limit":                  "rate_limit",
+	"client-ca":              "client_ca",
+	"allowed-subjects":       "allowed_subjects",
+	"token-file":             "token_file",
+	"jwt-secret-file":        "jwt_secret_file",
+	"max-file-size":          "max_file_size",
+	"client-quota":           "client_quota",
+	"min-disk-free":          "min_disk_free",
+	"max-uploads":            "max_concurrent_uploads",
+	"max-uploads-per-client": "max_concurrent_uploads_per_client",
+	"upload-queue":           "upload_queue_size",
+	"upload-queue-timeout":   "upload_queue_timeout",
+	"retry-after":            "retry_after",
+	"cert-reload-interval":   "cert_reload_interval",
+	"metrics-addr":           "metrics_addr",
+	"trace-exporter":         "trace_exporter",
+	"storage-backend":        "storage_backend",
+	"s3-endpoint":            "s3_endpoint",
+	"s3-bucket":              "s3_bucket",
+	"s3-region":              "s3_region",
+	"s3-access-key":          "s3_access_key",
+	"s3-secret-key":          "s3_secret_key",
+	"s3-prefix":              "s3_prefix",
+	"s3-insecure":            "s3_insecure",
+	"dedup":                  "dedup",
+}
+
+func init() {
+	flag.Int("port", 8999, "server port, listens on all interfaces unless --listen is given")
+	flag.String("listen", "", "semicolon separated listen addresses, e.g. '127.0.0.1:8999;[::1]:8999;unix:///run/file-transfer.sock'")
+	flag.String("cert", "grpc-file-transfer-tool/cert/cert.pem", "cert file")
+	flag.String("key", "grpc-file-transfer-tool/cert/key.pem", "private key file")
+	flag.String("storage", "grpc-file-transfer-tool/storage", "directory to store uploaded files")
+	flag.Duration("session-expiry", 24*time.Hour, "how long to keep unfinished resumable uploads")
+	flag.String("limit", "", "bandwidth limit shared by all uploads and downloads, e.g. 200MB/s, unlimited by default")
+	flag.String("client-ca", "", "CA used to verify client certs, enables mutual tls")
+	flag.String("allowed-subjects", "", "semicolon separated client cert subjects (CN or full DN) allowed to upload")
+	flag.String("token-file", "", "static token file, every line is '<name> <token> <permissions>', enables token auth")
+	flag.String("jwt-secret-file", "", "hmac secret used to verify jwt bearer tokens, enables token auth")
+	flag.String("max-file-size", "", "max size of a single uploaded file, e.g. 10GB, unlimited by default")
+	flag.String("client-quota", "", "max storage used by every client (token name, cert CN or peer host), e.g. 100GB, unlimited by default")
+	flag.String("min-disk-free", "", "reject uploads that would leave less free disk space than this, e.g. 5GB")
+	flag.Int("max-uploads", 0, "max concurrent upload streams, unlimited by default")
+	flag.Int("max-uploads-per-client", 0, "max concurrent upload streams of every client, unlimited by default")
+	flag.Int("upload-queue", 0, "number of uploads allowed to wait for a free slot, 0 to reject at once")
+	flag.Duration("upload-queue-timeout", 30*time.Second, "how long a queued upload waits for a free slot")
+	flag.Duration("retry-after", 5*time.Second, "how long rejected clients are told to wait before retrying")
+	flag.Duration("cert-reload-interval", 10*time.Second, "how often to check cert and key files for changes, 0 to only reload on SIGHUP")
+	flag.String("metrics-addr", "", "address serving prometheus metrics on /metrics, e.g. :9090, disabled by default")
+	flag.String("trace-exporter", "", "export opentelemetry spans to stdout, otlp (configured by OTEL_EXPORTER_OTLP_* env) or file:<path>")
+	flag.String("storage-backend", "local", "where uploaded files are kept: local (under --storage), memory or s3")
+	flag.String("s3-endpoint", "", "endpoint of the s3 compatible object store, e.g. 127.0.0.1:9000")
+	flag.String("s3-bucket", "", "bucket to store uploaded files in")
+	flag.String("s3-region", "", "region of the bucket")
+	flag.String("s3-access-key", "", "s3 access key, prefer FILE_TRANSFER_SERVER_S3_ACCESS_KEY")
+	flag.String("s3-secret-key", "", "s3 secret key, prefer FILE_TRANSFER_SERVER_S3_SECRET_KEY")
+	flag.String("s3-prefix", "", "prefix of object names, e.g. uploads/")
+	flag.Bool("s3-insecure", false, "access the object store over plain http")
+	flag.Bool("dedup", false, "store every distinct content once, keyed by its sha256, and let clients skip uploading content the server already holds")
+}
+
+// loadConfig 依次使用命令行参数的默认值, 配置文件, 环境变量和命令行上给出的参数构造配置.
+func loadConfig() (*GrpcStreamServerCfg, error) {
+	var (
+		cfg = &GrpcStreamServerCfg{}
+		err error
+	)
+	flag.VisitAll(func(f *flag.Flag) {
+		if key, ok := configFlags[f.Name]; ok && err == nil {
+			err = setConfigValue(cfg, key, f.DefValue)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if *configFlag != "" {
+		if err = loadConfigFile(*configFlag, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err = applyConfigEnv(cfg); err != nil {
+		return nil, err
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := configFlags[f.Name]; ok && err == nil {
+			if err = setConfigValue(cfg, key, f.Value.String()); err != nil {
+				err = errors.Wrapf(err, "invalid flag --%s", f.Name)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
 func main() {
 	flag.Parse()
 
-	cfg := &GrpcStreamServerCfg{
-		Port: *portFlag,
-		Cert: *certFileFlag,
-		Key:  *keyFileFlag,
+	cfg, err := loadConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	if *issueFlag != "" {
+		token, err := issueJWTFromFlags(cfg)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(token)
+		return
 	}
 
 	srv, err := NewGrpcStreamServer(cfg)
@@ -36,12 +154,31 @@ func main() {
 	}()
 
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
 MAIN_LOOP:
 	for { // nolint
 		select {
-		case <-sigCh:
+		case sig := <-sigCh:
+			if sig == syscall.SIGHUP {
+				srv.ReloadCert() // nolint
+				continue
+			}
 			break MAIN_LOOP
 		}
 	}
 }
+
+func issueJWTFromFlags(cfg *GrpcStreamServerCfg) (string, error) {
+	if cfg.JWTSecretFile == "" {
+		return "", fmt.Errorf("jwt_secret_file must be specified to issue a jwt")
+	}
+	secret, err := loadJWTSecret(cfg.JWTSecretFile)
+	if err != nil {
+		return "", err
+	}
+	perms, err := parsePermissions(*issuePermsFlag)
+	if err != nil {
+		return "", err
+	}
+	return issueJWT(secret, *issueFlag, perms, *issueTTLFlag)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+const (
+	metricsNamespace = "file_transfer"
+	// storageStatsTTL 存储占用的统计结果缓存这么久, 避免每次抓取都列出整个存储
+	storageStatsTTL = 30 * time.Second
+	// storageListTimeout 统计存储占用时列出文件的超时时间, 与prometheus默认的抓取超时一致
+	storageListTimeout = 10 * time.Second
+)
+
+// serverMetrics 服务端的prometheus指标
+type serverMetrics struct {
+	registry *prometheus.Registry
+
+	uploadsStarted   prometheus.Counter
+	uploadsSucceeded prometheus.Counter
+	uploadsFailed    *prometheus.CounterVec
+	receivedBytes    prometheus.Counter
+	chunkSize        prometheus.Histogram
+	streamDuration   *prometheus.HistogramVec
+	activeStreams    *prometheus.GaugeVec
+	requestDuration  *prometheus.HistogramVec
+}
+
+// newServerMetrics 返回serverMetrics实例, 所有指标注册在独立的registry中.
+func newServerMetrics(gsrv *GrpcStreamServer) *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		uploadsStarted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "uploads_started_total",
+			Help:      "Number of upload streams opened, every stream of a multi-stream upload counts.",
+		}),
+		uploadsSucceeded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "uploads_succeeded_total",
+			Help:      "Number of upload streams finished with status OK.",
+		}),
+		uploadsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "uploads_failed_total",
+			Help:      "Number of upload streams finished with any other status, by upload status or grpc code.",
+		}, []string{"code"}),
+		receivedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "received_bytes_total",
+			Help:      "File content bytes received by upload streams.",
+		}),
+		chunkSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "chunk_size_bytes",
+			Help:      "Size of the file content chunks received.",
+			Buckets:   prometheus.ExponentialBuckets(1024, 4, 8),
+		}),
+		streamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "stream_duration_seconds",
+			Help:      "Duration of upload and download streams, by method and status code.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"method", "code"}),
+		activeStreams: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "active_streams",
+			Help:      "Number of upload and download streams in progress, by method.",
+		}, []string{"method"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of unary requests, e.g. QueryUploadOffset, by method and status code.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 8),
+		}, []string{"method", "code"}),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.uploadsStarted,
+		m.uploadsSucceeded,
+		m.uploadsFailed,
+		m.receivedBytes,
+		m.chunkSize,
+		m.streamDuration,
+		m.activeStreams,
+		m.requestDuration,
+		&storageCollector{gsrv: gsrv},
+	)
+	return m
+}
+
+// StreamServerInterceptor 返回统计流指标的拦截器, 需要放在最前面以便统计被其余拦截器拒绝的上传.
+func (m *serverMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+		upload := info.FullMethod == serviceMethodPrefix+"Upload"
+
+		started := time.Now()
+		m.activeStreams.WithLabelValues(method).Inc()
+		defer m.activeStreams.WithLabelValues(method).Dec()
+		if upload {
+			m.uploadsStarted.Inc()
+		}
+
+		ms := &meteredStream{ServerStream: ss, metrics: m}
+		err := handler(srv, ms)
+
+		code := resultCode(ms.status, err)
+		m.streamDuration.WithLabelValues(method, code).Observe(time.Since(started).Seconds())
+		if upload {
+			if code == "OK" {
+				m.uploadsSucceeded.Inc()
+			} else {
+				m.uploadsFailed.WithLabelValues(code).Inc()
+			}
+		}
+		return err
+	}
+}
+
+// UnaryServerInterceptor 返回统计一元请求数和耗时的拦截器, 与流拦截器放在同样的位置.
+func (m *serverMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+		started := time.Now()
+		resp, err := handler(ctx, req)
+		m.requestDuration.WithLabelValues(method, status.Code(err).String()).Observe(time.Since(started).Seconds())
+		return resp, err
+	}
+}
+
+// resultCode 返回流的结果, 优先使用上传结果(例如CHECKSUM_MISMATCH), 否则使用gRPC状态码(例如Unavailable).
+func resultCode(sent *api.UploadStatus, err error) string {
+	if err != nil {
+		st := status.Convert(err)
+		for _, detail := range st.Details() {
+			if us, ok := detail.(*api.UploadStatus); ok {
+				return strings.TrimPrefix(us.GetCode().String(), "STATUS_CODE_")
+			}
+		}
+		return st.Code().String()
+	}
+	if sent != nil {
+		return strings.TrimPrefix(sent.GetCode().String(), "STATUS_CODE_")
+	}
+	return "OK"
+}
+
+// meteredStream 统计收到的文件内容并记下发送给客户端的上传结果.
+type meteredStream struct {
+	grpc.ServerStream
+	metrics *serverMetrics
+	status  *api.UploadStatus
+}
+
+func (s *meteredStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	// block references of delta uploads carry no content
+	if chunk, ok := m.(*api.FileChunk); ok && chunk.GetMeta() == nil && chunk.GetTrailer() == nil && chunk.GetBlock() == nil {
+		s.metrics.receivedBytes.Add(float64(len(chunk.GetContent())))
+		s.metrics.chunkSize.Observe(float64(len(chunk.GetContent())))
+	}
+	return nil
+}
+
+func (s *meteredStream) SendMsg(m interface{}) error {
+	if us, ok := m.(*api.UploadStatus); ok {
+		s.status = us
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+var (
+	storageUsedDesc = prometheus.NewDesc(metricsNamespace+"_storage_used_bytes",
+		"Total size of the files in the storage directory.", nil, nil)
+	storageFilesDesc = prometheus.NewDesc(metricsNamespace+"_storage_files",
+		"Number of files in the storage directory.", nil, nil)
+	diskFreeDesc = prometheus.NewDesc(metricsNamespace+"_disk_free_bytes",
+		"Free space on the disk holding the storage directory.", nil, nil)
+	clientUsedDesc = prometheus.NewDesc(metricsNamespace+"_client_storage_used_bytes",
+		"Storage used by every client, only reported when client quotas are enabled.", []string{"client"}, nil)
+)
+
+// storageCollector 在抓取时统计存储目录的占用情况, 文件数和占用空间最多每storageStatsTTL统计一次.
+type storageCollector struct {
+	gsrv *GrpcStreamServer
+
+	mu       sync.Mutex
+	listedAt time.Time
+	used     int64
+	files    int
+}
+
+func (c *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- storageUsedDesc
+	ch <- storageFilesDesc
+	ch <- diskFreeDesc
+	ch <- clientUsedDesc
+}
+
+// storageStats 返回存储中文件的总大小和数量, 缓存过期时才重新列出文件.
+func (c *storageCollector) storageStats() (int64, int, error) {
+	// concurrent scrapes wait for a single listing
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.listedAt.IsZero() && time.Since(c.listedAt) < storageStatsTTL {
+		return c.used, c.files, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storageListTimeout)
+	defer cancel()
+	files, err := c.gsrv.storage.List(ctx, "")
+	if err != nil {
+		return 0, 0, err
+	}
+	c.used = 0
+	for _, f := range files {
+		c.used += f.GetSize()
+	}
+	c.files = len(files)
+	c.listedAt = time.Now()
+	return c.used, c.files, nil
+}
+
+func (c *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	if used, files, err := c.storageStats(); err != nil {
+		c.gsrv.logger.Error().Err(err).Msg("failed to collect storage metrics")
+	} else {
+		ch <- prometheus.MustNewConstMetric(storageUsedDesc, prometheus.GaugeValue, float64(used))
+		ch <- prometheus.MustNewConstMetric(storageFilesDesc, prometheus.GaugeValue, float64(files))
+	}
+
+	if free, err := diskFree(c.gsrv.cfg.StorageDir); err != nil {
+		c.gsrv.logger.Error().Err(err).Msg("failed to get free disk space")
+	} else {
+		ch <- prometheus.MustNewConstMetric(diskFreeDesc, prometheus.GaugeValue, float64(free))
+	}
+
+	for client, used := range c.gsrv.quota.usageByClient() {
+		ch <- prometheus.MustNewConstMetric(clientUsedDesc, prometheus.GaugeValue, float64(used), client)
+	}
+}
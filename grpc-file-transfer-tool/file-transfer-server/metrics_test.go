@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "server.sock")
+	gsrv, err := NewGrpcStreamServer(&GrpcStreamServerCfg{
+		Port:        8999,
+		Listen:      []string{"unix://" + sock},
+		StorageDir:  filepath.Join(dir, "storage"),
+		MetricsAddr: "127.0.0.1:0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = gsrv.Init(); err != nil {
+		t.Fatal(err)
+	}
+	go gsrv.Run()
+	defer gsrv.Close()
+
+	conn, err := grpc.Dial("unix://"+sock, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewGrpcStreamServiceClient(conn)
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err = client.QueryUploadOffset(ctx, &api.UploadSession{SessionId: "0123456789abcdef"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.QueryUploadOffset(ctx, &api.UploadSession{SessionId: "../x"}) // nolint
+	client.HasContent(ctx, &api.ContentQuery{})                          // nolint
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/metrics", gsrv.metricsListener.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`file_transfer_request_duration_seconds_count{code="OK",method="QueryUploadOffset"} 2`,
+		`file_transfer_request_duration_seconds_count{code="InvalidArgument",method="QueryUploadOffset"} 1`,
+		`file_transfer_request_duration_seconds_count{code="Unimplemented",method="HasContent"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics are missing %s", want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+const (
+	// quotaLedgerName 记录每个文件归属哪个客户端的账本, 以保留前缀命名从而不会被列出或者下载
+	quotaLedgerName = ".upload-owners.json"
+	// diskCheckInterval 上传过程中每写入这么多字节检查一次磁盘剩余空间
+	diskCheckInterval = 16 << 20
+)
+
+// quotaError 上传超出了某项限制
+type quotaError struct {
+	code api.UploadStatusCode
+	msg  string
+}
+
+func (e *quotaError) Error() string {
+	return e.msg
+}
+
+// GRPCStatus 以ResourceExhausted结束上传, 并在错误详情中附带具体的上传结果.
+func (e *quotaError) GRPCStatus() *status.Status {
+	st := status.New(codes.ResourceExhausted, e.msg)
+	if detailed, err := st.WithDetails(&api.UploadStatus{Message: e.msg, Code: e.code}); err == nil {
+		return detailed
+	}
+	return st
+}
+
+func errFileTooLarge(size, max int64) error {
+	return &quotaError{
+		code: api.UploadStatusCode_STATUS_CODE_FILE_TOO_LARGE,
+		msg:  fmt.Sprintf("file size %d exceeds the limit of %d bytes", size, max),
+	}
+}
+
+func errQuotaExceeded(client string, used, size, quota int64) error {
+	return &quotaError{
+		code: api.UploadStatusCode_STATUS_CODE_QUOTA_EXCEEDED,
+		msg:  fmt.Sprintf("client '%s' uses %d bytes, another %d bytes would exceed the quota of %d bytes", client, used, size, quota),
+	}
+}
+
+func errInsufficientStorage(free, min int64) error {
+	return &quotaError{
+		code: api.UploadStatusCode_STATUS_CODE_INSUFFICIENT_STORAGE,
+		msg:  fmt.Sprintf("only %d bytes free on the server, must keep at least %d bytes free", free, min),
+	}
+}
+
+// fileOwner 文件的归属
+type fileOwner struct {
+	Client string `json:"client"`
+	Size   int64  `json:"size"`
+}
+
+// quotaTracker 统计每个客户端已经占用的存储空间, 账本保存在存储目录下, 重启后继续生效.
+type quotaTracker struct {
+	mu     sync.Mutex
+	dir    string
+	quota  int64
+	owners map[string]fileOwner
+	usage  map[string]int64
+	// reserved 每个客户端正在提交的文件所预留的字节数
+	reserved map[string]int64
+	logger   zerolog.Logger
+}
+
+// newQuotaTracker 加载账本并返回quotaTracker实例, 账本中已经不存在的文件会被忽略.
+// 账本总是保存在本地的dir下, 文件的实际大小从storage中查询.
+func newQuotaTracker(dir string, storage Storage, quota int64, logger zerolog.Logger) (*quotaTracker, error) {
+	q := &quotaTracker{
+		dir:      dir,
+		quota:    quota,
+		owners:   make(map[string]fileOwner),
+		usage:    make(map[string]int64),
+		reserved: make(map[string]int64),
+		logger:   logger,
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, quotaLedgerName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return q, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read quota ledger in '%s'", dir)
+	}
+	owners := make(map[string]fileOwner)
+	if err = json.Unmarshal(data, &owners); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse quota ledger in '%s'", dir)
+	}
+	for name, owner := range owners {
+		// files may have been removed or replaced behind our back
+		fi, err := storage.Stat(context.Background(), name)
+		if err != nil {
+			continue
+		}
+		owner.Size = fi.GetSize()
+		q.owners[name] = owner
+		q.usage[owner.Client] += owner.Size
+	}
+	return q, nil
+}
+
+// check 判断client再上传一个size字节的文件name是否会超出配额.
+func (q *quotaTracker) check(client, name string, size int64) error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.checkLocked(client, name, size)
+}
+
+func (q *quotaTracker) checkLocked(client, name string, size int64) error {
+	used := q.usage[client] + q.reserved[client]
+	if owner, ok := q.owners[name]; ok && owner.Client == client {
+		// overwriting one's own file frees the old copy
+		used -= owner.Size
+	}
+	if used+size > q.quota {
+		return errQuotaExceeded(client, used, size, q.quota)
+	}
+	return nil
+}
+
+// commit 在不超出配额的前提下调用commitFn提交文件, 成功后把文件记到client名下.
+// 提交前先在锁内为client预留size字节, 并发上传不会一起突破配额, 而提交本身不持有锁.
+// 文件提交成功后账本保存失败只记录日志, 文件仍然算作上传成功.
+func (q *quotaTracker) commit(client, name string, size int64, commitFn func() error) error {
+	if q == nil {
+		return commitFn()
+	}
+	q.mu.Lock()
+	if err := q.checkLocked(client, name, size); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	q.reserved[client] += size
+	q.mu.Unlock()
+
+	err := commitFn()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.reserved[client] -= size; q.reserved[client] == 0 {
+		delete(q.reserved, client)
+	}
+	if err != nil {
+		return err
+	}
+	if owner, ok := q.owners[name]; ok {
+		q.usage[owner.Client] -= owner.Size
+	}
+	q.owners[name] = fileOwner{Client: client, Size: size}
+	q.usage[client] += size
+	if err = q.saveLocked(); err != nil {
+		// the ledger is rewritten by the next commit, and the file is owned in memory meanwhile
+		q.logger.Error().Err(err).Str("client", client).Str("file", name).Msg("failed to save quota ledger")
+	}
+	return nil
+}
+
+// usageByClient 返回每个客户端已经占用的存储字节数.
+func (q *quotaTracker) usageByClient() map[string]int64 {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	usage := make(map[string]int64, len(q.usage))
+	for client, used := range q.usage {
+		if used > 0 {
+			usage[client] = used
+		}
+	}
+	return usage
+}
+
+// saveLocked 原子地写入账本, 调用方需持有q.mu.
+func (q *quotaTracker) saveLocked() error {
+	data, err := json.Marshal(q.owners)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal quota ledger")
+	}
+	fd, err := createTempFile(q.dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to save quota ledger")
+	}
+	if _, err = fd.Write(data); err != nil {
+		abortTempFile(fd)
+		return errors.Wrap(err, "failed to save quota ledger")
+	}
+	if err = commitTempFile(fd, filepath.Join(q.dir, quotaLedgerName)); err != nil {
+		os.Remove(fd.Name()) // nolint
+		return errors.Wrap(err, "failed to save quota ledger")
+	}
+	return nil
+}
+
+// checkFileSize 检查声明的文件大小是否超出限制.
+func (gsrv *GrpcStreamServer) checkFileSize(size int64) error {
+	if gsrv.cfg.MaxFileSize > 0 && size > gsrv.cfg.MaxFileSize {
+		return errFileTooLarge(size, gsrv.cfg.MaxFileSize)
+	}
+	return nil
+}
+
+// checkDiskFree 检查再写入pending字节后磁盘剩余空间是否仍然不低于水位线.
+func (gsrv *GrpcStreamServer) checkDiskFree(pending int64) error {
+	if gsrv.cfg.MinDiskFree <= 0 {
+		return nil
+	}
+	free, err := diskFree(gsrv.cfg.StorageDir)
+	if err != nil {
+		gsrv.logger.Error().Err(err).Msg("failed to get free disk space")
+		return nil
+	}
+	if free-pending < gsrv.cfg.MinDiskFree {
+		return errInsufficientStorage(free, gsrv.cfg.MinDiskFree)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+// uploadStatusCode 检查err是否为带有UploadStatus详情的ResourceExhausted, 返回详情中的结果码.
+func uploadStatusCode(t *testing.T, err error) api.UploadStatusCode {
+	t.Helper()
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		t.Fatalf("got %v, want %v", err, codes.ResourceExhausted)
+	}
+	for _, detail := range st.Details() {
+		if us, ok := detail.(*api.UploadStatus); ok {
+			if us.GetMessage() != st.Message() {
+				t.Errorf("upload status message %q differs from %q", us.GetMessage(), st.Message())
+			}
+			return us.GetCode()
+		}
+	}
+	t.Fatalf("%v carries no upload status", err)
+	return 0
+}
+
+func TestQuotaErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		code api.UploadStatusCode
+	}{
+		{errFileTooLarge(11, 10), api.UploadStatusCode_STATUS_CODE_FILE_TOO_LARGE},
+		{errQuotaExceeded("ci", 8, 3, 10), api.UploadStatusCode_STATUS_CODE_QUOTA_EXCEEDED},
+		{errInsufficientStorage(1, 5), api.UploadStatusCode_STATUS_CODE_INSUFFICIENT_STORAGE},
+	}
+	for _, tt := range tests {
+		if code := uploadStatusCode(t, tt.err); code != tt.code {
+			t.Errorf("%v carries %v, want %v", tt.err, code, tt.code)
+		}
+	}
+}
+
+func TestQuotaTracker(t *testing.T) {
+	type upload struct {
+		client, name string
+		size         int64
+		// fail 让提交本身失败
+		fail bool
+		// code 期望的结果码, STATUS_CODE_UNKNOWN表示成功或者提交失败
+		code api.UploadStatusCode
+	}
+	exceeded := api.UploadStatusCode_STATUS_CODE_QUOTA_EXCEEDED
+
+	tests := []struct {
+		name    string
+		uploads []upload
+		// usage 上传之后每个客户端的占用
+		usage map[string]int64
+	}{
+		{
+			name:    "under the quota",
+			uploads: []upload{{client: "a", name: "1", size: 60}, {client: "a", name: "2", size: 40}},
+			usage:   map[string]int64{"a": 100},
+		},
+		{
+			name:    "exhausted",
+			uploads: []upload{{client: "a", name: "1", size: 60}, {client: "a", name: "2", size: 41, code: exceeded}},
+			usage:   map[string]int64{"a": 60},
+		},
+		{
+			name:    "single file over the quota",
+			uploads: []upload{{client: "a", name: "1", size: 101, code: exceeded}},
+			usage:   map[string]int64{},
+		},
+		{
+			name:    "quotas are per client",
+			uploads: []upload{{client: "a", name: "1", size: 100}, {client: "b", name: "2", size: 100}},
+			usage:   map[string]int64{"a": 100, "b": 100},
+		},
+		{
+			name:    "overwriting an own file frees the old copy",
+			uploads: []upload{{client: "a", name: "1", size: 80}, {client: "a", name: "1", size: 90}},
+			usage:   map[string]int64{"a": 90},
+		},
+		{
+			name:    "overwriting a file of another client moves it",
+			uploads: []upload{{client: "a", name: "1", size: 80}, {client: "b", name: "2", size: 50}, {client: "b", name: "1", size: 50}},
+			usage:   map[string]int64{"b": 100},
+		},
+		{
+			name:    "overwriting a file of another client counts in full",
+			uploads: []upload{{client: "b", name: "2", size: 60}, {client: "a", name: "1", size: 80}, {client: "b", name: "1", size: 50, code: exceeded}},
+			usage:   map[string]int64{"a": 80, "b": 60},
+		},
+		{
+			name:    "failed commits release the reservation",
+			uploads: []upload{{client: "a", name: "1", size: 100, fail: true}, {client: "a", name: "2", size: 100}},
+			usage:   map[string]int64{"a": 100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := newQuotaTracker(t.TempDir(), newMemoryStorage(), 100, zerolog.Nop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range tt.uploads {
+				commitErr := errors.New("commit failed")
+				err := q.commit(u.client, u.name, u.size, func() error {
+					if u.fail {
+						return commitErr
+					}
+					return nil
+				})
+				switch {
+				case u.code != api.UploadStatusCode_STATUS_CODE_UNKNOWN:
+					if code := uploadStatusCode(t, err); code != u.code {
+						t.Errorf("upload of '%s' by '%s' carries %v, want %v", u.name, u.client, code, u.code)
+					}
+				case u.fail:
+					if err != commitErr {
+						t.Errorf("upload of '%s' by '%s' returned %v, want the commit error", u.name, u.client, err)
+					}
+				case err != nil:
+					t.Errorf("upload of '%s' by '%s': %v", u.name, u.client, err)
+				}
+			}
+			usage := q.usageByClient()
+			if len(usage) != len(tt.usage) {
+				t.Errorf("usage %v, want %v", usage, tt.usage)
+			}
+			for client, want := range tt.usage {
+				if usage[client] != want {
+					t.Errorf("usage %v, want %v", usage, tt.usage)
+					break
+				}
+			}
+			if len(q.reserved) != 0 {
+				t.Errorf("reservations %v left", q.reserved)
+			}
+		})
+	}
+}
+
+func TestQuotaTrackerReservation(t *testing.T) {
+	q, err := newQuotaTracker(t.TempDir(), newMemoryStorage(), 100, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = q.commit("a", "1", 60, func() error {
+		// a concurrent upload of the same client sees the bytes being committed
+		if code := uploadStatusCode(t, q.check("a", "2", 50)); code != api.UploadStatusCode_STATUS_CODE_QUOTA_EXCEEDED {
+			t.Errorf("concurrent check carries %v", code)
+		}
+		return q.check("b", "2", 50)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQuotaTrackerLedger(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	storage := newMemoryStorage()
+	put := func(name, content string) {
+		t.Helper()
+		w, err := storage.Create(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content)) // nolint
+		if err = w.Commit(ctx, &api.FileMeta{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q, err := newQuotaTracker(dir, storage, 10, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []struct{ client, name, content string }{{"a", "1", "aaaa"}, {"a", "2", "aa"}, {"b", "3", "bbb"}} {
+		if err = q.commit(f.client, f.name, int64(len(f.content)), func() error { put(f.name, f.content); return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// removed and replaced behind the server's back while it was down
+	if err = storage.Delete(ctx, "2"); err != nil {
+		t.Fatal(err)
+	}
+	put("3", "bbbbbbbb")
+
+	q, err = newQuotaTracker(dir, storage, 10, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage := q.usageByClient()
+	if usage["a"] != 4 || usage["b"] != 8 || len(usage) != 2 {
+		t.Errorf("usage after restart %v, want a 4 and b 8", usage)
+	}
+	if err = q.check("b", "4", 3); err == nil || !strings.Contains(err.Error(), "quota") {
+		t.Errorf("quota of 'b' was not exhausted after restart: %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// sessionFilePrefix 可续传上传的临时文件前缀
+	sessionFilePrefix = ".session-"
+	// sessionFileSuffix 可续传上传的临时文件后缀
+	sessionFileSuffix = ".part"
+	// sessionOwnerSuffix 记录会话所属客户端和文件名的文件后缀
+	sessionOwnerSuffix = ".owner"
+)
+
+var sessionIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// sessionRegistry 记录正在进行中的可续传上传, 防止同一会话被并发写入.
+type sessionRegistry struct {
+	mu     sync.Mutex
+	active map[string]struct{}
+}
+
+func newSessionRegistry() *sessionRegistry {
+	return &sessionRegistry{active: make(map[string]struct{})}
+}
+
+// acquire 占用会话, 会话已被占用时返回false.
+func (r *sessionRegistry) acquire(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.active[id]; ok {
+		return false
+	}
+	r.active[id] = struct{}{}
+	return true
+}
+
+// release 释放会话.
+func (r *sessionRegistry) release(id string) {
+	r.mu.Lock()
+	delete(r.active, id)
+	r.mu.Unlock()
+}
+
+// busy 判断会话是否正在上传.
+func (r *sessionRegistry) busy(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.active[id]
+	return ok
+}
+
+// validateSessionID 校验会话ID, 会话ID会被用作文件名的一部分.
+func validateSessionID(id string) error {
+	if !sessionIDRegexp.MatchString(id) {
+		return errors.Errorf("invalid session id '%s'", id)
+	}
+	return nil
+}
+
+// sessionFilePath 返回会话对应的临时文件路径.
+func sessionFilePath(dir, id string) string {
+	return filepath.Join(dir, sessionFilePrefix+id+sessionFileSuffix)
+}
+
+// sessionOwnerPath 返回记录会话所属客户端和文件名的文件路径.
+func sessionOwnerPath(dir, id string) string {
+	return filepath.Join(dir, sessionFilePrefix+id+sessionOwnerSuffix)
+}
+
+// sessionOwner 创建会话的客户端和上传的文件名, 只有同一客户端上传同一文件时才能续传
+type sessionOwner struct {
+	Client string `json:"client"`
+	Name   string `json:"name"`
+}
+
+// is 判断会话是否由client为name创建.
+func (o *sessionOwner) is(client, name string) bool {
+	return o.Client == client && o.Name == name
+}
+
+// loadSessionOwner 读取会话的所属记录, 会话不存在时返回nil.
+func loadSessionOwner(dir, id string) (*sessionOwner, error) {
+	data, err := ioutil.ReadFile(sessionOwnerPath(dir, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read owner of session '%s'", id)
+	}
+	var owner sessionOwner
+	if err = json.Unmarshal(data, &owner); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse owner of session '%s'", id)
+	}
+	return &owner, nil
+}
+
+// bindSession 在会话创建时记录所属客户端和文件名, 会话已属于其他客户端或者其他文件时返回PermissionDenied.
+func bindSession(dir, id, client, name string) error {
+	owner, err := loadSessionOwner(dir, id)
+	if err != nil {
+		return err
+	}
+	if owner != nil {
+		if !owner.is(client, name) {
+			return status.Errorf(codes.PermissionDenied, "session '%s' belongs to another client or file", id)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(&sessionOwner{Client: client, Name: name})
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode owner of session '%s'", id)
+	}
+	fd, err := createTempFile(dir)
+	if err != nil {
+		return err
+	}
+	if _, err = fd.Write(data); err != nil {
+		abortTempFile(fd)
+		return errors.Wrapf(err, "failed to write owner of session '%s'", id)
+	}
+	if err = commitTempFile(fd, sessionOwnerPath(dir, id)); err != nil {
+		os.Remove(fd.Name()) // nolint
+		return err
+	}
+	return nil
+}
+
+// releaseSessionOwner 会话临时文件已被提交或删除时删除所属记录.
+func releaseSessionOwner(dir, id string) {
+	if _, err := os.Stat(sessionFilePath(dir, id)); os.IsNotExist(err) {
+		os.Remove(sessionOwnerPath(dir, id)) // nolint
+	}
+}
+
+// removeSession 删除会话临时文件及其所属记录.
+func removeSession(dir, id string) error {
+	if err := os.Remove(sessionFilePath(dir, id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(sessionOwnerPath(dir, id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// sessionOffset 返回会话临时文件中已持久化的字节数.
+func sessionOffset(dir, id string) (int64, error) {
+	fi, err := os.Stat(sessionFilePath(dir, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.Wrapf(err, "failed to stat session file for '%s'", id)
+	}
+	return fi.Size(), nil
+}
+
+// openSessionFile 打开会话临时文件, 截断到offset处并将写位置移动到offset.
+func openSessionFile(dir, id string, offset int64) (*os.File, error) {
+	fd, err := os.OpenFile(sessionFilePath(dir, id), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open session file for '%s'", id)
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close() // nolint
+		return nil, errors.Wrapf(err, "failed to stat session file for '%s'", id)
+	}
+	if offset < 0 || offset > fi.Size() {
+		fd.Close() // nolint
+		return nil, errors.Errorf("invalid offset %d for session '%s' holding %d bytes", offset, id, fi.Size())
+	}
+	if err = fd.Truncate(offset); err != nil {
+		fd.Close() // nolint
+		return nil, errors.Wrapf(err, "failed to truncate session file for '%s'", id)
+	}
+	if _, err = fd.Seek(offset, io.SeekStart); err != nil {
+		fd.Close() // nolint
+		return nil, errors.Wrapf(err, "failed to seek session file for '%s'", id)
+	}
+	return fd, nil
+}
+
+// suspendSessionFile 持久化已接收的数据并关闭会话临时文件, 以便之后续传.
+func suspendSessionFile(fd *os.File) {
+	fd.Sync()  // nolint
+	fd.Close() // nolint
+}
+
+// expireSessions 删除超过有效期未被续传的会话临时文件及其所属记录.
+func expireSessions(dir string, expiry time.Duration, busy func(id string) bool) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read storage directory '%s'", dir)
+	}
+
+	var expired []string
+	for _, fi := range infos {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasPrefix(name, sessionFilePrefix) {
+			continue
+		}
+		var id string
+		switch {
+		case strings.HasSuffix(name, sessionFileSuffix):
+			id = strings.TrimSuffix(strings.TrimPrefix(name, sessionFilePrefix), sessionFileSuffix)
+		case strings.HasSuffix(name, sessionOwnerSuffix):
+			id = strings.TrimSuffix(strings.TrimPrefix(name, sessionFilePrefix), sessionOwnerSuffix)
+			// expires together with the session file, unless that is gone already
+			if _, err = os.Stat(sessionFilePath(dir, id)); !os.IsNotExist(err) {
+				continue
+			}
+		default:
+			continue
+		}
+		if time.Since(fi.ModTime()) < expiry || busy(id) {
+			continue
+		}
+		if err = removeSession(dir, id); err != nil {
+			return expired, errors.Wrapf(err, "failed to remove expired session '%s'", id)
+		}
+		expired = append(expired, id)
+	}
+	return expired, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBindSession(t *testing.T) {
+	dir := t.TempDir()
+	if err := bindSession(dir, "s1", "alice", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		client, name string
+		code         codes.Code
+	}{
+		{"alice", "a.txt", codes.OK},
+		{"bob", "a.txt", codes.PermissionDenied},
+		{"alice", "b.txt", codes.PermissionDenied},
+		{"bob", "b.txt", codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		if err := bindSession(dir, "s1", tt.client, tt.name); status.Code(err) != tt.code {
+			t.Errorf("bindSession(%s, %s) returned %v, want %v", tt.client, tt.name, err, tt.code)
+		}
+	}
+
+	// the owner is dropped together with the session file only
+	if err := ioutil.WriteFile(sessionFilePath(dir, "s1"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	releaseSessionOwner(dir, "s1")
+	if owner, err := loadSessionOwner(dir, "s1"); err != nil || owner == nil || !owner.is("alice", "a.txt") {
+		t.Fatalf("owner of a session holding data: %v, %v", owner, err)
+	}
+	os.Remove(sessionFilePath(dir, "s1")) // nolint
+	releaseSessionOwner(dir, "s1")
+	if owner, err := loadSessionOwner(dir, "s1"); err != nil || owner != nil {
+		t.Fatalf("owner of a finished session: %v, %v", owner, err)
+	}
+	if err := bindSession(dir, "s1", "bob", "b.txt"); err != nil {
+		t.Errorf("binding a finished session: %v", err)
+	}
+}
+
+func TestExpireSessions(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	create := func(path string, modTime time.Time) {
+		t.Helper()
+		if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// expired, with an owner created even earlier
+	create(sessionFilePath(dir, "expired"), old)
+	create(sessionOwnerPath(dir, "expired"), old.Add(-time.Hour))
+	// owner is old, but the data was written recently
+	create(sessionFilePath(dir, "active"), time.Now())
+	create(sessionOwnerPath(dir, "active"), old)
+	// expired, but being uploaded
+	create(sessionFilePath(dir, "busy"), old)
+	create(sessionOwnerPath(dir, "busy"), old)
+	// left behind without data
+	create(sessionOwnerPath(dir, "orphan"), old)
+	create(sessionOwnerPath(dir, "fresh-orphan"), time.Now())
+	create(filepath.Join(dir, "file.txt"), old)
+
+	expired, err := expireSessions(dir, time.Minute, func(id string) bool { return id == "busy" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(expired)
+	if got := fmt.Sprint(expired); got != "[expired orphan]" {
+		t.Errorf("expired sessions: %s", got)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, fi := range infos {
+		left = append(left, fi.Name())
+	}
+	want := "[.session-active.owner .session-active.part .session-busy.owner .session-busy.part .session-fresh-orphan.owner file.txt]"
+	if got := fmt.Sprint(left); got != want {
+		t.Errorf("left files: %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+const (
+	// tmpFilePattern 上传过程中临时文件的命名模式
+	tmpFilePattern = ".upload-*.tmp"
+)
+
+// 存储后端的名字
+const (
+	storageBackendLocal  = "local"
+	storageBackendMemory = "memory"
+	storageBackendS3     = "s3"
+)
+
+// Storage 已上传文件的存储后端, 文件名是使用'/'分隔的相对路径.
+// 不存在的文件返回的错误满足os.IsNotExist.
+type Storage interface {
+	// Create 返回写入文件name的Writer, 写入的内容在Commit之前不可见.
+	Create(ctx context.Context, name string) (Writer, error)
+	// Open 打开文件用于读取, 同时返回文件的元信息.
+	Open(ctx context.Context, name string) (io.ReadCloser, *api.FileMeta, error)
+	// Stat 返回文件的元信息.
+	Stat(ctx context.Context, name string) (*api.FileMeta, error)
+	// List 列出名字以prefix开头的文件.
+	List(ctx context.Context, prefix string) ([]*api.FileMeta, error)
+	// Delete 删除文件.
+	Delete(ctx context.Context, name string) error
+}
+
+// Writer 正在写入的文件, 必须以Commit或者Abort结束.
+type Writer interface {
+	io.Writer
+	// Commit 使写入的内容以meta中的权限位和修改时间出现在文件名下, 覆盖已有的文件.
+	Commit(ctx context.Context, meta *api.FileMeta) error
+	// Abort 丢弃写入的内容, 在Commit失败之后调用也是安全的.
+	Abort() error
+}
+
+// syncer 可以把已写入的数据落盘的Writer
+type syncer interface {
+	Sync() error
+}
+
+// fileImporter 可以直接接收本地文件的存储后端, 避免再复制一次.
+// importFile返回时fd已经被关闭, 成功时fd对应的文件已被移走或者删除.
+type fileImporter interface {
+	importFile(ctx context.Context, fd *os.File, name string, meta *api.FileMeta) error
+}
+
+// newStorage 根据配置创建存储后端, 开启去重时在存储后端之上按内容保存文件.
+func newStorage(cfg *GrpcStreamServerCfg) (Storage, error) {
+	var (
+		backend Storage
+		err     error
+	)
+	switch cfg.StorageBackend {
+	case "", storageBackendLocal:
+		backend = newLocalStorage(cfg.StorageDir)
+	case storageBackendMemory:
+		backend = newMemoryStorage()
+	case storageBackendS3:
+		if backend, err = newS3Storage(cfg); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("unknown storage backend '%s'", cfg.StorageBackend)
+	}
+	if cfg.Dedup {
+		return newDedupStorage(cfg.StorageDir, backend)
+	}
+	return backend, nil
+}
+
+// stagedWriter 先把数据写入存储目录下的本地文件, 提交时再交给存储后端.
+// 可续传上传和多流上传的数据总是先落在本地, 以便断点续传和按偏移写入.
+type stagedWriter struct {
+	storage Storage
+	fd      *os.File
+	name    string
+}
+
+func newStagedWriter(storage Storage, fd *os.File, name string) *stagedWriter {
+	return &stagedWriter{storage: storage, fd: fd, name: name}
+}
+
+func (w *stagedWriter) Write(p []byte) (int, error) {
+	return w.fd.Write(p)
+}
+
+// Sync 把已写入的数据落盘.
+func (w *stagedWriter) Sync() error {
+	return w.fd.Sync()
+}
+
+func (w *stagedWriter) Commit(ctx context.Context, meta *api.FileMeta) error {
+	if importer, ok := w.storage.(fileImporter); ok {
+		return importer.importFile(ctx, w.fd, w.name, meta)
+	}
+
+	if _, err := w.fd.Seek(0, io.SeekStart); err != nil {
+		w.fd.Close() // nolint
+		return errors.Wrapf(err, "failed to seek temp file '%s'", w.fd.Name())
+	}
+	dst, err := w.storage.Create(ctx, w.name)
+	if err != nil {
+		w.fd.Close() // nolint
+		return err
+	}
+	if _, err = io.Copy(dst, w.fd); err != nil {
+		dst.Abort()  // nolint
+		w.fd.Close() // nolint
+		return errors.Wrapf(err, "failed to copy temp file '%s' into storage", w.fd.Name())
+	}
+	if err = dst.Commit(ctx, meta); err != nil {
+		dst.Abort()  // nolint
+		w.fd.Close() // nolint
+		return err
+	}
+	abortTempFile(w.fd)
+	return nil
+}
+
+func (w *stagedWriter) Abort() error {
+	abortTempFile(w.fd)
+	return nil
+}
+
+// createTempFile 在存储目录下创建临时文件, 上传完成前数据都写入该文件.
+func createTempFile(dir string) (*os.File, error) {
+	fd, err := ioutil.TempFile(dir, tmpFilePattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create temp file under '%s'", dir)
+	}
+	return fd, nil
+}
+
+// commitTempFile 将临时文件落盘并原子地重命名为目标文件.
+func commitTempFile(fd *os.File, dst string) error {
+	if err := fd.Sync(); err != nil {
+		fd.Close() // nolint
+		return errors.Wrapf(err, "failed to sync temp file '%s'", fd.Name())
+	}
+	if err := fd.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close temp file '%s'", fd.Name())
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create directory for '%s'", dst)
+	}
+	if err := os.Rename(fd.Name(), dst); err != nil {
+		return errors.Wrapf(err, "failed to rename temp file '%s' to '%s'", fd.Name(), dst)
+	}
+	return nil
+}
+
+// abortTempFile 关闭并删除临时文件.
+func abortTempFile(fd *os.File) {
+	fd.Close()           // nolint
+	os.Remove(fd.Name()) // nolint
+}
+
+// validateFileMeta 校验上传元信息, 返回规范化之后的文件名.
+func validateFileMeta(meta *api.FileMeta) (string, error) {
+	if meta == nil {
+		return "", errors.Errorf("file meta must be sent as the first message")
+	}
+	if meta.GetSize() < 0 {
+		return "", errors.Errorf("invalid file size %d", meta.GetSize())
+	}
+	if meta.GetSessionId() != "" {
+		if err := validateSessionID(meta.GetSessionId()); err != nil {
+			return "", err
+		}
+	}
+	if meta.GetParts() > 1 {
+		if meta.GetSessionId() == "" {
+			return "", errors.Errorf("session id must be specified when uploading a file in %d parts", meta.GetParts())
+		}
+		if meta.GetOffset() < 0 || meta.GetLength() < 0 || meta.GetOffset()+meta.GetLength() > meta.GetSize() {
+			return "", errors.Errorf("invalid range [%d, %d) of file with %d bytes", meta.GetOffset(), meta.GetOffset()+meta.GetLength(), meta.GetSize())
+		}
+	} else if meta.GetOffset() < 0 || meta.GetOffset() > meta.GetSize() || (meta.GetOffset() > 0 && meta.GetSessionId() == "") {
+		return "", errors.Errorf("invalid offset %d", meta.GetOffset())
+	}
+	if bs := meta.GetDeltaBlockSize(); bs != 0 {
+		if bs < common.MinDeltaBlockSize || bs > common.MaxChunkSize {
+			return "", errors.Errorf("delta block size must be in [%d, %d], got %d", common.MinDeltaBlockSize, common.MaxChunkSize, bs)
+		}
+		if meta.GetSessionId() != "" || meta.GetParts() > 1 {
+			return "", errors.Errorf("delta uploads can not be resumed or split into parts")
+		}
+		// block references are only as good as the checksum verifying the rebuilt file
+		if meta.GetChecksumAlgorithm() == api.ChecksumAlgorithm_CHECKSUM_ALGORITHM_NONE {
+			return "", errors.Errorf("delta uploads must be verified by a checksum")
+		}
+	}
+	return cleanName(meta.GetName())
+}
+
+// cleanName 规范化客户端给出的相对路径, 拒绝逃逸出存储目录的路径和保留的文件名.
+func cleanName(name string) (string, error) {
+	if name == "" {
+		return "", errors.Errorf("file name must be specified")
+	}
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("invalid file name '%s'", name)
+	}
+	if reservedName(filepath.Base(clean)) {
+		return "", errors.Errorf("file name '%s' is reserved", name)
+	}
+	return filepath.ToSlash(clean), nil
+}
+
+// reservedName 判断文件名是否为上传过程中使用的临时文件名.
+func reservedName(base string) bool {
+	return strings.HasPrefix(base, ".upload-") || strings.HasPrefix(base, sessionFilePrefix)
+}
+
+// notExist 返回满足os.IsNotExist的错误.
+func notExist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
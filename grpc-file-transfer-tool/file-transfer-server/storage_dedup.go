@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+const (
+	// dedupIndexName 记录每个文件名对应哪份内容的索引, 以保留前缀命名从而不会被列出或者下载
+	dedupIndexName = ".upload-index.json"
+	// blobNamePrefix 内容在存储后端中的名字前缀, 后面跟着内容的SHA-256
+	blobNamePrefix = ".upload-blob-"
+)
+
+// dedupEntry 一个文件名指向的内容和文件属性
+type dedupEntry struct {
+	Hash    string `json:"hash"`
+	Size    int64  `json:"size"`
+	Mode    uint32 `json:"mode"`
+	ModTime int64  `json:"mod_time"`
+}
+
+// contentRef 一份内容被多少个文件名引用
+type contentRef struct {
+	refs int
+	// pins 正在提交这份内容的上传数, 大于0时即使没有文件名引用内容也不会被删除
+	pins int
+	size int64
+	// stored 内容已经保存在存储后端中
+	stored bool
+}
+
+// dedupStorage 按内容的SHA-256在存储后端中保存每份内容一次, 文件名只是指向内容的引用,
+// 重复上传相同的内容不会占用更多的空间, 最后一个引用被覆盖或者删除时内容才被删除.
+// 索引保存在本地的存储目录下, 重启后继续生效.
+type dedupStorage struct {
+	mu       sync.Mutex
+	dir      string
+	backend  Storage
+	entries  map[string]dedupEntry
+	contents map[string]*contentRef
+}
+
+// newDedupStorage 加载索引并返回dedupStorage实例, 内容已经不存在的文件会被忽略.
+func newDedupStorage(dir string, backend Storage) (*dedupStorage, error) {
+	s := &dedupStorage{
+		dir:      dir,
+		backend:  backend,
+		entries:  make(map[string]dedupEntry),
+		contents: make(map[string]*contentRef),
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, dedupIndexName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read dedup index in '%s'", dir)
+	}
+	entries := make(map[string]dedupEntry)
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse dedup index in '%s'", dir)
+	}
+	missing := make(map[string]bool)
+	for name, e := range entries {
+		if _, ok := s.contents[e.Hash]; !ok && !missing[e.Hash] {
+			// e.g. the memory backend loses every blob on restart
+			meta, err := backend.Stat(context.Background(), blobName(e.Hash))
+			if err != nil {
+				missing[e.Hash] = true
+				continue
+			}
+			s.contents[e.Hash] = &contentRef{size: meta.GetSize(), stored: true}
+		}
+		if missing[e.Hash] {
+			continue
+		}
+		s.entries[name] = e
+		s.contents[e.Hash].refs++
+	}
+	return s, nil
+}
+
+// blobName 返回内容在存储后端中的名字.
+func blobName(hash string) string {
+	return blobNamePrefix + hash
+}
+
+func (s *dedupStorage) Create(ctx context.Context, name string) (Writer, error) {
+	fd, err := createTempFile(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	return newStagedWriter(s, fd, name), nil
+}
+
+// importFile 计算临时文件的SHA-256, 存储后端还没有这份内容时才把它交给存储后端, 然后把name指向这份内容.
+// 交给存储后端时不持有s.mu, 期间内容被钉住而不会因为并发的覆盖或者删除被删掉.
+func (s *dedupStorage) importFile(ctx context.Context, fd *os.File, name string, meta *api.FileMeta) error {
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		fd.Close() // nolint
+		return errors.Wrapf(err, "failed to seek temp file '%s'", fd.Name())
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, fd)
+	if err != nil {
+		fd.Close() // nolint
+		return errors.Wrapf(err, "failed to hash temp file '%s'", fd.Name())
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	s.mu.Lock()
+	ref, ok := s.contents[hash]
+	if !ok {
+		ref = &contentRef{size: size}
+		s.contents[hash] = ref
+	}
+	ref.pins++
+	// a concurrent upload of the same content may still be storing it, storing it twice does no harm
+	stored := ref.stored
+	s.mu.Unlock()
+
+	if stored {
+		abortTempFile(fd)
+	} else {
+		err = newStagedWriter(s.backend, fd, blobName(hash)).Commit(ctx, &api.FileMeta{Mode: 0444})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ref.pins--
+	if err != nil {
+		s.releaseLocked(ctx, hash)
+		return err
+	}
+	ref.stored = true
+	return s.linkLocked(ctx, name, dedupEntry{Hash: hash, Size: size, Mode: meta.GetMode(), ModTime: meta.GetModTime()})
+}
+
+// contentSize 返回内容的大小, 没有这份内容时返回false.
+func (s *dedupStorage) contentSize(hash string) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ref, ok := s.contents[hash]
+	if !ok || !ref.stored {
+		return 0, false
+	}
+	return ref.size, true
+}
+
+// link 让name指向已有的内容hash, 文件属性取自meta. 没有这份内容时返回满足os.IsNotExist的错误.
+func (s *dedupStorage) link(ctx context.Context, name, hash string, meta *api.FileMeta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ref, ok := s.contents[hash]
+	if !ok || !ref.stored {
+		return notExist("link", blobName(hash))
+	}
+	return s.linkLocked(ctx, name, dedupEntry{Hash: hash, Size: ref.size, Mode: meta.GetMode(), ModTime: meta.GetModTime()})
+}
+
+// linkLocked 让name指向e并保存索引, 被覆盖的内容失去最后一个引用时被删除, 调用方需持有s.mu.
+func (s *dedupStorage) linkLocked(ctx context.Context, name string, e dedupEntry) error {
+	if e.Mode = uint32(os.FileMode(e.Mode).Perm()); e.Mode == 0 {
+		e.Mode = 0644
+	}
+	old, replaced := s.entries[name]
+	s.entries[name] = e
+	if err := s.saveLocked(); err != nil {
+		if replaced {
+			s.entries[name] = old
+		} else {
+			delete(s.entries, name)
+		}
+		s.releaseLocked(ctx, e.Hash)
+		return err
+	}
+	s.contents[e.Hash].refs++
+	if replaced {
+		s.contents[old.Hash].refs--
+		s.releaseLocked(ctx, old.Hash)
+	}
+	return nil
+}
+
+// releaseLocked 删除不再被引用也没有被钉住的内容, 调用方需持有s.mu.
+func (s *dedupStorage) releaseLocked(ctx context.Context, hash string) {
+	if ref, ok := s.contents[hash]; !ok || ref.refs > 0 || ref.pins > 0 {
+		return
+	}
+	delete(s.contents, hash)
+	// a blob left behind is only wasted space, it is overwritten when the content is uploaded again
+	s.backend.Delete(ctx, blobName(hash)) // nolint
+}
+
+func (s *dedupStorage) Open(ctx context.Context, name string) (io.ReadCloser, *api.FileMeta, error) {
+	meta, err := s.Stat(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.mu.Lock()
+	hash := s.entries[name].Hash
+	s.mu.Unlock()
+
+	rc, _, err := s.backend.Open(ctx, blobName(hash))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// overwritten or deleted since Stat
+			return nil, nil, notExist("open", name)
+		}
+		return nil, nil, err
+	}
+	return rc, meta, nil
+}
+
+func (s *dedupStorage) Stat(ctx context.Context, name string) (*api.FileMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, notExist("stat", name)
+	}
+	return e.meta(name), nil
+}
+
+func (s *dedupStorage) List(ctx context.Context, prefix string) ([]*api.FileMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var files []*api.FileMeta
+	for name, e := range s.entries {
+		if strings.HasPrefix(name, prefix) && !reservedName(path.Base(name)) {
+			files = append(files, e.meta(name))
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+func (s *dedupStorage) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return notExist("delete", name)
+	}
+	delete(s.entries, name)
+	if err := s.saveLocked(); err != nil {
+		s.entries[name] = e
+		return err
+	}
+	s.contents[e.Hash].refs--
+	s.releaseLocked(ctx, e.Hash)
+	return nil
+}
+
+// saveLocked 原子地写入索引, 调用方需持有s.mu.
+func (s *dedupStorage) saveLocked() error {
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal dedup index")
+	}
+	fd, err := createTempFile(s.dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to save dedup index")
+	}
+	if _, err = fd.Write(data); err != nil {
+		abortTempFile(fd)
+		return errors.Wrap(err, "failed to save dedup index")
+	}
+	if err = commitTempFile(fd, filepath.Join(s.dir, dedupIndexName)); err != nil {
+		os.Remove(fd.Name()) // nolint
+		return errors.Wrap(err, "failed to save dedup index")
+	}
+	return nil
+}
+
+func (e dedupEntry) meta(name string) *api.FileMeta {
+	return &api.FileMeta{
+		Name:        name,
+		Size:        e.Size,
+		Mode:        e.Mode,
+		ModTime:     e.ModTime,
+		ContentType: common.ContentType(path.Base(name)),
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDedupStorage(t *testing.T) {
+	s, err := newDedupStorage(t.TempDir(), newMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+}
+
+func TestDedupStorageRefCounting(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryStorage()
+	dir := t.TempDir()
+	s, err := newDedupStorage(dir, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(name, content string) error {
+		w, err := s.Create(ctx, name)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write([]byte(content)); err != nil {
+			return err
+		}
+		return w.Commit(ctx, &api.FileMeta{Mode: 0600})
+	}
+
+	tests := []struct {
+		name string
+		op   func() error
+		// ok 期望操作成功
+		ok bool
+		// files 操作后每个文件名的内容
+		files map[string]string
+		// blobs 操作后存储后端中每份内容是否存在
+		blobs map[string]bool
+	}{
+		{"first upload", func() error { return put("a", "x") }, true,
+			map[string]string{"a": "x"}, map[string]bool{"x": true}},
+		{"same content under another name", func() error { return put("b", "x") }, true,
+			map[string]string{"a": "x", "b": "x"}, map[string]bool{"x": true}},
+		{"overwrite one reference", func() error { return put("a", "y") }, true,
+			map[string]string{"a": "y", "b": "x"}, map[string]bool{"x": true, "y": true}},
+		{"delete the last reference", func() error { return s.Delete(ctx, "b") }, true,
+			map[string]string{"a": "y"}, map[string]bool{"x": false, "y": true}},
+		{"link to stored content", func() error { return s.link(ctx, "c", contentHash("y"), &api.FileMeta{}) }, true,
+			map[string]string{"a": "y", "c": "y"}, map[string]bool{"y": true}},
+		{"link to deleted content", func() error { return s.link(ctx, "d", contentHash("x"), &api.FileMeta{}) }, false,
+			map[string]string{"a": "y", "c": "y"}, map[string]bool{"x": false, "y": true}},
+		{"overwrite with the same content", func() error { return put("c", "y") }, true,
+			map[string]string{"a": "y", "c": "y"}, map[string]bool{"y": true}},
+		{"delete one of two references", func() error { return s.Delete(ctx, "a") }, true,
+			map[string]string{"c": "y"}, map[string]bool{"y": true}},
+		{"delete a missing file", func() error { return s.Delete(ctx, "a") }, false,
+			map[string]string{"c": "y"}, map[string]bool{"y": true}},
+		{"overwrite the last reference", func() error { return put("c", "z") }, true,
+			map[string]string{"c": "z"}, map[string]bool{"y": false, "z": true}},
+		{"aborted upload", func() error {
+			w, err := s.Create(ctx, "e")
+			if err != nil {
+				return err
+			}
+			w.Write([]byte("w")) // nolint
+			return w.Abort()
+		}, true, map[string]string{"c": "z"}, map[string]bool{"w": false, "z": true}},
+	}
+	for _, tt := range tests {
+		if err := tt.op(); (err == nil) != tt.ok {
+			t.Fatalf("%s: got %v, want ok %v", tt.name, err, tt.ok)
+		}
+		files, err := s.List(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != len(tt.files) {
+			t.Errorf("%s: %d files, want %v", tt.name, len(files), tt.files)
+		}
+		for name, content := range tt.files {
+			rc, _, err := s.Open(ctx, name)
+			if err != nil {
+				t.Errorf("%s: open '%s': %v", tt.name, name, err)
+				continue
+			}
+			data, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			if string(data) != content {
+				t.Errorf("%s: '%s' holds %q, want %q", tt.name, name, data, content)
+			}
+		}
+		for content, want := range tt.blobs {
+			_, err := backend.Stat(ctx, blobName(contentHash(content)))
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			if got := err == nil; got != want {
+				t.Errorf("%s: blob of %q stored %v, want %v", tt.name, content, got, want)
+			}
+		}
+	}
+
+	// reference counts survive a restart
+	if err = put("f", "z"); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = newDedupStorage(dir, backend); err != nil {
+		t.Fatal(err)
+	}
+	if ref := s.contents[contentHash("z")]; ref == nil || ref.refs != 2 || !ref.stored {
+		t.Fatalf("reloaded content ref %+v, want 2 references", ref)
+	}
+	if err = s.Delete(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = backend.Stat(ctx, blobName(contentHash("z"))); err != nil {
+		t.Errorf("blob deleted while still referenced: %v", err)
+	}
+	if err = s.Delete(ctx, "f"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = backend.Stat(ctx, blobName(contentHash("z"))); !os.IsNotExist(err) {
+		t.Errorf("blob without references was kept: %v", err)
+	}
+}
+
+func TestDedupStorageLostBlobs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := newDedupStorage(dir, newMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := s.Create(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("x")) // nolint
+	if err = w.Commit(ctx, &api.FileMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the memory backend loses every blob on restart, so do the files pointing to them
+	if s, err = newDedupStorage(dir, newMemoryStorage()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Stat(ctx, "a"); !os.IsNotExist(err) {
+		t.Errorf("stat of a file whose blob is gone: %v", err)
+	}
+	if _, ok := s.contentSize(contentHash("x")); ok {
+		t.Error("lost content is still known")
+	}
+}
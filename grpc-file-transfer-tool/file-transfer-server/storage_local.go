@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// localStorage 把文件保存在本地目录下, 写入时先写临时文件, 提交时原子地重命名.
+type localStorage struct {
+	dir string
+}
+
+func newLocalStorage(dir string) *localStorage {
+	return &localStorage{dir: dir}
+}
+
+func (s *localStorage) path(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(name))
+}
+
+func (s *localStorage) Create(ctx context.Context, name string) (Writer, error) {
+	fd, err := createTempFile(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	return newStagedWriter(s, fd, name), nil
+}
+
+func (s *localStorage) importFile(ctx context.Context, fd *os.File, name string, meta *api.FileMeta) error {
+	if err := common.ApplyFileMeta(fd, meta); err != nil {
+		fd.Close() // nolint
+		return err
+	}
+	return commitTempFile(fd, s.path(name))
+}
+
+func (s *localStorage) Open(ctx context.Context, name string) (io.ReadCloser, *api.FileMeta, error) {
+	fd, err := os.Open(s.path(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close() // nolint
+		return nil, nil, errors.Wrapf(err, "failed to stat file '%s'", name)
+	}
+	if !fi.Mode().IsRegular() {
+		fd.Close() // nolint
+		return nil, nil, notExist("open", name)
+	}
+	return fd, localFileMeta(name, fi), nil
+}
+
+func (s *localStorage) Stat(ctx context.Context, name string) (*api.FileMeta, error) {
+	fi, err := os.Stat(s.path(name))
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, notExist("stat", name)
+	}
+	return localFileMeta(name, fi), nil
+}
+
+// List 列出存储目录下名字以prefix开头的文件, 不包括上传过程中的临时文件.
+func (s *localStorage) List(ctx context.Context, prefix string) ([]*api.FileMeta, error) {
+	var files []*api.FileMeta
+	err := filepath.Walk(s.dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || reservedName(fi.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		files = append(files, localFileMeta(name, fi))
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list storage directory '%s'", s.dir)
+	}
+	return files, nil
+}
+
+func (s *localStorage) Delete(ctx context.Context, name string) error {
+	if _, err := s.Stat(ctx, name); err != nil {
+		return err
+	}
+	return os.Remove(s.path(name))
+}
+
+func localFileMeta(name string, fi os.FileInfo) *api.FileMeta {
+	return &api.FileMeta{
+		Name:        name,
+		Size:        fi.Size(),
+		Mode:        uint32(fi.Mode().Perm()),
+		ModTime:     fi.ModTime().UnixNano(),
+		ContentType: common.ContentType(fi.Name()),
+	}
+}
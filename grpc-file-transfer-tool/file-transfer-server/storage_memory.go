@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// memoryFile 内存中的一个文件
+type memoryFile struct {
+	data    []byte
+	mode    uint32
+	modTime int64
+}
+
+// memoryStorage 把文件保存在内存中, 重启后丢失, 用于测试和演示.
+type memoryStorage struct {
+	mu    sync.RWMutex
+	files map[string]*memoryFile
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{files: make(map[string]*memoryFile)}
+}
+
+func (s *memoryStorage) Create(ctx context.Context, name string) (Writer, error) {
+	return &memoryWriter{storage: s, name: name}, nil
+}
+
+func (s *memoryStorage) Open(ctx context.Context, name string) (io.ReadCloser, *api.FileMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.files[name]
+	if !ok {
+		return nil, nil, notExist("open", name)
+	}
+	// committed data is never modified in place, so readers can share it
+	return memoryReader{bytes.NewReader(f.data)}, f.meta(name), nil
+}
+
+func (s *memoryStorage) Stat(ctx context.Context, name string) (*api.FileMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.files[name]
+	if !ok {
+		return nil, notExist("stat", name)
+	}
+	return f.meta(name), nil
+}
+
+func (s *memoryStorage) List(ctx context.Context, prefix string) ([]*api.FileMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var files []*api.FileMeta
+	for name, f := range s.files {
+		// e.g. blobs of the dedup storage
+		if strings.HasPrefix(name, prefix) && !reservedName(path.Base(name)) {
+			files = append(files, f.meta(name))
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+func (s *memoryStorage) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.files[name]; !ok {
+		return notExist("delete", name)
+	}
+	delete(s.files, name)
+	return nil
+}
+
+func (f *memoryFile) meta(name string) *api.FileMeta {
+	return &api.FileMeta{
+		Name:        name,
+		Size:        int64(len(f.data)),
+		Mode:        f.mode,
+		ModTime:     f.modTime,
+		ContentType: common.ContentType(path.Base(name)),
+	}
+}
+
+// memoryReader 支持随机读取的只读文件
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error {
+	return nil
+}
+
+// memoryWriter 在内存中缓冲写入的内容, 提交时整体替换文件.
+type memoryWriter struct {
+	storage *memoryStorage
+	name    string
+	buf     bytes.Buffer
+	done    bool
+}
+
+func (w *memoryWriter) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, errors.Errorf("write to a finished file '%s'", w.name)
+	}
+	return w.buf.Write(p)
+}
+
+func (w *memoryWriter) Commit(ctx context.Context, meta *api.FileMeta) error {
+	if w.done {
+		return errors.Errorf("commit a finished file '%s'", w.name)
+	}
+	w.done = true
+
+	f := &memoryFile{data: w.buf.Bytes(), mode: uint32(os.FileMode(meta.GetMode()).Perm()), modTime: meta.GetModTime()}
+	if f.mode == 0 {
+		f.mode = 0644
+	}
+	if f.modTime == 0 {
+		f.modTime = time.Now().UnixNano()
+	}
+	w.storage.mu.Lock()
+	w.storage.files[w.name] = f
+	w.storage.mu.Unlock()
+	return nil
+}
+
+func (w *memoryWriter) Abort() error {
+	if !w.done {
+		w.done = true
+		w.buf.Reset()
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// 保存在对象用户元信息中的文件权限位和修改时间
+const (
+	s3MetaMode    = "Mode"
+	s3MetaModTime = "Mtime"
+)
+
+// s3Storage 把文件保存在S3兼容的对象存储(例如MinIO)中, 对象名为prefix加上文件名.
+// 上传的数据先写入存储目录下的临时文件, 提交时再整体上传, 因此读者不会看到写了一半的对象.
+type s3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+	dir    string
+}
+
+func newS3Storage(cfg *GrpcStreamServerCfg) (*s3Storage, error) {
+	client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure: !cfg.S3Insecure,
+		Region: cfg.S3Region,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create s3 client for '%s'", cfg.S3Endpoint)
+	}
+	return &s3Storage{client: client, bucket: cfg.S3Bucket, prefix: cfg.S3Prefix, dir: cfg.StorageDir}, nil
+}
+
+func (s *s3Storage) Create(ctx context.Context, name string) (Writer, error) {
+	fd, err := createTempFile(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	return newStagedWriter(s, fd, name), nil
+}
+
+func (s *s3Storage) importFile(ctx context.Context, fd *os.File, name string, meta *api.FileMeta) error {
+	defer abortTempFile(fd)
+
+	fi, err := fd.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "failed to stat temp file '%s'", fd.Name())
+	}
+	if _, err = fd.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "failed to seek temp file '%s'", fd.Name())
+	}
+	mode := os.FileMode(meta.GetMode()).Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+	opts := minio.PutObjectOptions{
+		ContentType: common.ContentType(path.Base(name)),
+		UserMetadata: map[string]string{
+			s3MetaMode:    strconv.FormatUint(uint64(mode), 8),
+			s3MetaModTime: strconv.FormatInt(meta.GetModTime(), 10),
+		},
+	}
+	if _, err = s.client.PutObject(ctx, s.bucket, s.prefix+name, fd, fi.Size(), opts); err != nil {
+		return errors.Wrapf(err, "failed to put object '%s' into bucket '%s'", s.prefix+name, s.bucket)
+	}
+	return nil
+}
+
+func (s *s3Storage) Open(ctx context.Context, name string) (io.ReadCloser, *api.FileMeta, error) {
+	meta, err := s.Stat(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, s.prefix+name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s.wrapError(err, "open", name)
+	}
+	return obj, meta, nil
+}
+
+func (s *s3Storage) Stat(ctx context.Context, name string) (*api.FileMeta, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, s.prefix+name, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s.wrapError(err, "stat", name)
+	}
+	return s3FileMeta(name, info), nil
+}
+
+func (s *s3Storage) List(ctx context.Context, prefix string) ([]*api.FileMeta, error) {
+	var files []*api.FileMeta
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:       s.prefix + prefix,
+		Recursive:    true,
+		WithMetadata: true,
+	}) {
+		if info.Err != nil {
+			return nil, errors.Wrapf(info.Err, "failed to list bucket '%s'", s.bucket)
+		}
+		name := strings.TrimPrefix(info.Key, s.prefix)
+		if name == "" || strings.HasSuffix(name, "/") || reservedName(path.Base(name)) {
+			continue
+		}
+		files = append(files, s3FileMeta(name, info))
+	}
+	return files, nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, name string) error {
+	// RemoveObject succeeds on missing objects, stat first to report them
+	if _, err := s.Stat(ctx, name); err != nil {
+		return err
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, s.prefix+name, minio.RemoveObjectOptions{}); err != nil {
+		return s.wrapError(err, "delete", name)
+	}
+	return nil
+}
+
+// wrapError 把对象不存在的错误转换为满足os.IsNotExist的错误.
+func (s *s3Storage) wrapError(err error, op, name string) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return notExist(op, name)
+	}
+	return errors.Wrapf(err, "failed to %s object '%s' in bucket '%s'", op, s.prefix+name, s.bucket)
+}
+
+func s3FileMeta(name string, info minio.ObjectInfo) *api.FileMeta {
+	meta := &api.FileMeta{
+		Name:        name,
+		Size:        info.Size,
+		Mode:        0644,
+		ModTime:     info.LastModified.UnixNano(),
+		ContentType: common.ContentType(path.Base(name)),
+	}
+	// stat strips the x-amz-meta- prefix but listings keep it, and servers disagree on the case
+	for key, value := range info.UserMetadata {
+		key = strings.TrimPrefix(strings.ToLower(key), "x-amz-meta-")
+		switch {
+		case strings.EqualFold(key, s3MetaMode):
+			if mode, err := strconv.ParseUint(value, 8, 32); err == nil {
+				meta.Mode = uint32(mode)
+			}
+		case strings.EqualFold(key, s3MetaModTime):
+			if mtime, err := strconv.ParseInt(value, 10, 64); err == nil && mtime != 0 {
+				meta.ModTime = mtime
+			}
+		}
+	}
+	return meta
+}
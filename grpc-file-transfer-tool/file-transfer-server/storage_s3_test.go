@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeS3 是只支持s3Storage所用接口的进程内S3服务: 不校验签名, 所有bucket都存在.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]*fakeS3Object // bucket/key
+}
+
+type fakeS3Object struct {
+	data        []byte
+	contentType string
+	etag        string
+	modTime     time.Time
+	meta        http.Header // x-amz-meta-*
+}
+
+type fakeS3Error struct {
+	XMLName    xml.Name `xml:"Error"`
+	Code       string
+	Message    string
+	BucketName string
+	Key        string
+}
+
+type fakeS3Metadata map[string]string
+
+func (m fakeS3Metadata) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := e.EncodeElement(m[key], xml.StartElement{Name: xml.Name{Local: key}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+type fakeS3Contents struct {
+	Key          string
+	LastModified time.Time
+	ETag         string
+	Size         int64
+	StorageClass string
+	UserMetadata fakeS3Metadata `xml:",omitempty"`
+}
+
+type fakeS3ListResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	MaxKeys     int
+	IsTruncated bool
+	Contents    []fakeS3Contents
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string]*fakeS3Object)}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// path-style requests: /bucket/key
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := parts[0]
+	if len(parts) == 1 || parts[1] == "" {
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			s.list(w, r, bucket)
+			return
+		}
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+		return
+	}
+	key := parts[1]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("Content-Encoding") == "aws-chunked" {
+			http.Error(w, "streaming signatures are not supported", http.StatusNotImplemented)
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sum := md5.Sum(data)
+		obj := &fakeS3Object{
+			data:        data,
+			contentType: r.Header.Get("Content-Type"),
+			etag:        `"` + hex.EncodeToString(sum[:]) + `"`,
+			modTime:     time.Now().UTC().Truncate(time.Second),
+			meta:        make(http.Header),
+		}
+		for name, values := range r.Header {
+			if strings.HasPrefix(name, "X-Amz-Meta-") {
+				obj.meta[name] = values
+			}
+		}
+		s.objects[bucket+"/"+key] = obj
+		w.Header().Set("ETag", obj.etag)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := s.objects[bucket+"/"+key]
+		if !ok {
+			writeFakeS3Error(w, r, http.StatusNotFound, fakeS3Error{Code: "NoSuchKey", Message: "The specified key does not exist.", BucketName: bucket, Key: key})
+			return
+		}
+		for name, values := range obj.meta {
+			w.Header()[name] = values
+		}
+		w.Header().Set("ETag", obj.etag)
+		w.Header().Set("Content-Type", obj.contentType)
+		http.ServeContent(w, r, "", obj.modTime, bytes.NewReader(obj.data))
+	case http.MethodDelete:
+		delete(s.objects, bucket+"/"+key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+func (s *fakeS3) list(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	result := fakeS3ListResult{Name: bucket, Prefix: query.Get("prefix"), MaxKeys: 1000}
+
+	s.mu.Lock()
+	for name, obj := range s.objects {
+		key := strings.TrimPrefix(name, bucket+"/")
+		if key == name || !strings.HasPrefix(key, result.Prefix) {
+			continue
+		}
+		contents := fakeS3Contents{
+			Key:          key,
+			LastModified: obj.modTime,
+			ETag:         obj.etag,
+			Size:         int64(len(obj.data)),
+			StorageClass: "STANDARD",
+		}
+		// the MinIO extension behind ListObjectsOptions.WithMetadata
+		if query.Get("metadata") == "true" {
+			contents.UserMetadata = make(fakeS3Metadata)
+			for name := range obj.meta {
+				contents.UserMetadata[name] = obj.meta.Get(name)
+			}
+		}
+		result.Contents = append(result.Contents, contents)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result) // nolint
+}
+
+func writeFakeS3Error(w http.ResponseWriter, r *http.Request, code int, body fakeS3Error) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(code)
+	xml.NewEncoder(w).Encode(body) // nolint
+}
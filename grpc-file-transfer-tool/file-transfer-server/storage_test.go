@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+// 让S3存储后端测试使用真实服务的环境变量, 例如指向本地的MinIO, 没有设置endpoint时使用进程内的fakeS3
+const (
+	testS3EndpointEnv  = "FILE_TRANSFER_TEST_S3_ENDPOINT"
+	testS3BucketEnv    = "FILE_TRANSFER_TEST_S3_BUCKET"
+	testS3AccessKeyEnv = "FILE_TRANSFER_TEST_S3_ACCESS_KEY"
+	testS3SecretKeyEnv = "FILE_TRANSFER_TEST_S3_SECRET_KEY"
+)
+
+func TestLocalStorage(t *testing.T) {
+	testStorage(t, newLocalStorage(t.TempDir()))
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, newMemoryStorage())
+}
+
+func TestS3Storage(t *testing.T) {
+	cfg := &GrpcStreamServerCfg{
+		StorageDir:  t.TempDir(),
+		S3Endpoint:  os.Getenv(testS3EndpointEnv),
+		S3Bucket:    os.Getenv(testS3BucketEnv),
+		S3AccessKey: os.Getenv(testS3AccessKeyEnv),
+		S3SecretKey: os.Getenv(testS3SecretKeyEnv),
+		S3Prefix:    fmt.Sprintf("storage-test-%d/", time.Now().UnixNano()),
+		S3Insecure:  true,
+	}
+	if cfg.S3Endpoint == "" {
+		srv := httptest.NewServer(newFakeS3())
+		defer srv.Close()
+		// anonymous requests, so that uploads are not sent with streaming signatures
+		cfg.S3Endpoint = strings.TrimPrefix(srv.URL, "http://")
+		cfg.S3AccessKey, cfg.S3SecretKey = "", ""
+		cfg.S3Region = "us-east-1"
+	}
+	if cfg.S3Bucket == "" {
+		cfg.S3Bucket = "files"
+	}
+	s, err := newS3Storage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+}
+
+// testStorage 检查存储后端是否满足Storage接口的约定, 结束时删除写入的所有文件.
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	modTime := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC).UnixNano()
+
+	put := func(name, content string, mode uint32) {
+		t.Helper()
+		w, err := s.Create(ctx, name)
+		if err != nil {
+			t.Fatalf("create '%s': %v", name, err)
+		}
+		if _, err = w.Write([]byte(content)); err != nil {
+			t.Fatalf("write '%s': %v", name, err)
+		}
+		if err = w.Commit(ctx, &api.FileMeta{Mode: mode, ModTime: modTime}); err != nil {
+			t.Fatalf("commit '%s': %v", name, err)
+		}
+	}
+	read := func(name string) string {
+		t.Helper()
+		rc, meta, err := s.Open(ctx, name)
+		if err != nil {
+			t.Fatalf("open '%s': %v", name, err)
+		}
+		defer rc.Close()
+		data, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("read '%s': %v", name, err)
+		}
+		if meta.GetName() != name || meta.GetSize() != int64(len(data)) {
+			t.Errorf("open '%s' returned meta %v for %d bytes", name, meta, len(data))
+		}
+		return string(data)
+	}
+	list := func(prefix string) string {
+		t.Helper()
+		files, err := s.List(ctx, prefix)
+		if err != nil {
+			t.Fatalf("list '%s': %v", prefix, err)
+		}
+		var names []string
+		for _, f := range files {
+			names = append(names, f.GetName())
+		}
+		sort.Strings(names)
+		return fmt.Sprint(names)
+	}
+	missing := func(name string) {
+		t.Helper()
+		if _, err := s.Stat(ctx, name); !os.IsNotExist(err) {
+			t.Errorf("stat '%s': got %v, want a not exist error", name, err)
+		}
+		if rc, _, err := s.Open(ctx, name); !os.IsNotExist(err) {
+			if err == nil {
+				rc.Close()
+			}
+			t.Errorf("open '%s': got %v, want a not exist error", name, err)
+		}
+		if err := s.Delete(ctx, name); !os.IsNotExist(err) {
+			t.Errorf("delete '%s': got %v, want a not exist error", name, err)
+		}
+	}
+
+	missing("a.txt")
+	if got := list(""); got != "[]" {
+		t.Fatalf("list of empty storage: %s", got)
+	}
+
+	// nothing is visible before commit
+	w, err := s.Create(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	missing("a.txt")
+	if got := list(""); got != "[]" {
+		t.Errorf("list while writing: %s", got)
+	}
+	if err = w.Commit(ctx, &api.FileMeta{Mode: 0600, ModTime: modTime}); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("a.txt"); got != "hello" {
+		t.Errorf("read 'a.txt': %q", got)
+	}
+	meta, err := s.Stat(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.GetSize() != 5 || os.FileMode(meta.GetMode()).Perm() != 0600 || meta.GetModTime() != modTime {
+		t.Errorf("stat 'a.txt': size %d, mode %o, mod time %d", meta.GetSize(), meta.GetMode(), meta.GetModTime())
+	}
+
+	// aborted writes leave nothing behind, and do not touch the committed file
+	w, err = s.Create(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("discarded")) // nolint
+	if err = w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("a.txt"); got != "hello" {
+		t.Errorf("read 'a.txt' after abort: %q", got)
+	}
+	w, err = s.Create(ctx, "b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Abort() // nolint
+	missing("b.txt")
+
+	// commit overwrites
+	put("a.txt", "hello again", 0644)
+	if got := read("a.txt"); got != "hello again" {
+		t.Errorf("read 'a.txt' after overwrite: %q", got)
+	}
+
+	put("dir/b.txt", "b", 0644)
+	put("dir/sub/c.txt", "", 0644)
+	put("dirt.txt", "d", 0644)
+	if got := read("dir/sub/c.txt"); got != "" {
+		t.Errorf("read empty file: %q", got)
+	}
+	if got := list(""); got != "[a.txt dir/b.txt dir/sub/c.txt dirt.txt]" {
+		t.Errorf("list '': %s", got)
+	}
+	if got := list("dir/"); got != "[dir/b.txt dir/sub/c.txt]" {
+		t.Errorf("list 'dir/': %s", got)
+	}
+	if got := list("nothing/"); got != "[]" {
+		t.Errorf("list 'nothing/': %s", got)
+	}
+
+	// files with reserved names, e.g. dedup blobs, can be read but are never listed
+	put(".upload-blob-0123", "blob", 0444)
+	put("dir/.upload-index.json", "{}", 0644)
+	if got := read(".upload-blob-0123"); got != "blob" {
+		t.Errorf("read reserved file: %q", got)
+	}
+	if got := list(""); got != "[a.txt dir/b.txt dir/sub/c.txt dirt.txt]" {
+		t.Errorf("list with reserved files: %s", got)
+	}
+
+	for _, name := range []string{"a.txt", "dir/b.txt", "dir/sub/c.txt", "dirt.txt", ".upload-blob-0123", "dir/.upload-index.json"} {
+		if err = s.Delete(ctx, name); err != nil {
+			t.Errorf("delete '%s': %v", name, err)
+		}
+		missing(name)
+	}
+	if got := list(""); got != "[]" {
+		t.Errorf("list after delete: %s", got)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// permission 令牌可以被授予的权限
+type permission string
+
+const (
+	permissionUpload   permission = "upload"
+	permissionDownload permission = "download"
+)
+
+const (
+	// serviceName 文件传输服务的全名, 也用于健康检查
+	serviceName         = "amazingchow.photon_dance_grpc_examples.grpc_file_transfer_tool.GrpcStreamService"
+	serviceMethodPrefix = "/" + serviceName + "/"
+)
+
+// methodPermissions 调用每个接口需要的权限, 不在其中的接口不校验令牌.
+var methodPermissions = map[string]permission{
+	serviceMethodPrefix + "Upload":            permissionUpload,
+	serviceMethodPrefix + "QueryUploadOffset": permissionUpload,
+	serviceMethodPrefix + "Download":          permissionDownload,
+	serviceMethodPrefix + "HasContent":        permissionUpload,
+	serviceMethodPrefix + "GetSignature":      permissionUpload,
+}
+
+// parsePermissions 解析逗号分隔的权限列表, 例如"upload,download".
+func parsePermissions(s string) (map[permission]bool, error) {
+	perms := make(map[permission]bool)
+	for _, p := range strings.Split(s, ",") {
+		switch perm := permission(strings.TrimSpace(p)); perm {
+		case permissionUpload, permissionDownload:
+			perms[perm] = true
+		default:
+			return nil, errors.Errorf("unknown permission '%s', must be one of upload, download", p)
+		}
+	}
+	return perms, nil
+}
+
+// tokenIdentity 令牌对应的调用方
+type tokenIdentity struct {
+	Name        string
+	Permissions map[permission]bool
+}
+
+type staticToken struct {
+	token    []byte
+	identity *tokenIdentity
+}
+
+// tokenClaims JWT令牌携带的声明, sub作为调用方名字, exp必须设置.
+type tokenClaims struct {
+	Permissions []string `json:"permissions"`
+	jwt.RegisteredClaims
+}
+
+// tokenAuthenticator 校验请求metadata中的bearer令牌, 支持静态令牌文件和HMAC签名的JWT.
+type tokenAuthenticator struct {
+	tokens    []staticToken
+	jwtSecret []byte
+}
+
+// newTokenAuthenticator 返回tokenAuthenticator实例, tokenFile和jwtSecretFile至少需要配置一个.
+func newTokenAuthenticator(tokenFile, jwtSecretFile string) (*tokenAuthenticator, error) {
+	a := &tokenAuthenticator{}
+	if tokenFile != "" {
+		tokens, err := loadTokenFile(tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		a.tokens = tokens
+	}
+	if jwtSecretFile != "" {
+		secret, err := loadJWTSecret(jwtSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		a.jwtSecret = secret
+	}
+	return a, nil
+}
+
+// loadTokenFile 加载静态令牌文件, 每行格式为"<name> <token> <permissions>", 以#开头的行为注释.
+func loadTokenFile(path string) ([]staticToken, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open token file '%s'", path)
+	}
+	defer fd.Close()
+
+	var tokens []staticToken
+	scanner := bufio.NewScanner(fd)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, errors.Errorf("invalid token file '%s' at line %d, want '<name> <token> <permissions>'", path, line)
+		}
+		perms, err := parsePermissions(fields[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid token file '%s' at line %d", path, line)
+		}
+		tokens = append(tokens, staticToken{
+			token:    []byte(fields[1]),
+			identity: &tokenIdentity{Name: fields[0], Permissions: perms},
+		})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read token file '%s'", path)
+	}
+	return tokens, nil
+}
+
+// loadJWTSecret 加载用于签名和校验JWT的HMAC密钥.
+func loadJWTSecret(path string) ([]byte, error) {
+	secret, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read jwt secret file '%s'", path)
+	}
+	secret = []byte(strings.TrimSpace(string(secret)))
+	if len(secret) < 32 {
+		return nil, errors.Errorf("jwt secret in '%s' must be at least 32 bytes", path)
+	}
+	return secret, nil
+}
+
+// issueJWT 使用HMAC密钥签发一个JWT令牌.
+func issueJWT(secret []byte, name string, perms map[permission]bool, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		return "", errors.Errorf("jwt ttl must be positive")
+	}
+	claims := tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   name,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	}
+	for perm := range perms {
+		claims.Permissions = append(claims.Permissions, string(perm))
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// authenticate 从metadata中取出bearer令牌并返回对应的调用方.
+func (a *tokenAuthenticator) authenticate(ctx context.Context) (*tokenIdentity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	token := strings.TrimSpace(values[0])
+	if len(token) < 7 || !strings.EqualFold(token[:7], "bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+	token = strings.TrimSpace(token[7:])
+
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(t.token, []byte(token)) == 1 {
+			return t.identity, nil
+		}
+	}
+	if a.jwtSecret != nil && strings.Count(token, ".") == 2 {
+		return a.verifyJWT(token)
+	}
+	return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+}
+
+// verifyJWT 校验JWT的签名和有效期, 没有设置过期时间的令牌一律拒绝.
+func (a *tokenAuthenticator) verifyJWT(token string) (*tokenIdentity, error) {
+	claims := &tokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return a.jwtSecret, nil
+	}, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid bearer token: %v", err)
+	}
+	if claims.ExpiresAt == nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token: missing expiry")
+	}
+	if claims.Subject == "" {
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token: missing subject")
+	}
+	perms, err := parsePermissions(strings.Join(claims.Permissions, ","))
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid bearer token: %v", err)
+	}
+	return &tokenIdentity{Name: claims.Subject, Permissions: perms}, nil
+}
+
+// authorize 校验调用方是否有调用method的权限, 通过后把调用方放入context.
+func (a *tokenAuthenticator) authorize(ctx context.Context, method string) (context.Context, error) {
+	required, ok := methodPermissions[method]
+	if !ok {
+		return ctx, nil
+	}
+	identity, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !identity.Permissions[required] {
+		return nil, status.Errorf(codes.PermissionDenied, "token '%s' has no %s permission", identity.Name, required)
+	}
+	return context.WithValue(ctx, tokenIdentityKey{}, identity), nil
+}
+
+// UnaryServerInterceptor 返回校验令牌的一元拦截器.
+func (a *tokenAuthenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor 返回校验令牌的流拦截器.
+func (a *tokenAuthenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type tokenIdentityKey struct{}
+
+// identityFromContext 返回通过令牌校验的调用方.
+func identityFromContext(ctx context.Context) (*tokenIdentity, bool) {
+	identity, ok := ctx.Value(tokenIdentityKey{}).(*tokenIdentity)
+	return identity, ok
+}
+
+// authorizedStream 替换流的context, 使接口实现能够拿到调用方.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/api"
+)
+
+const testJWTSecret = "0123456789abcdef0123456789abcdef"
+
+// newTestTokenAuthenticator 返回从临时文件加载了tokens和testJWTSecret的tokenAuthenticator.
+func newTestTokenAuthenticator(t *testing.T, tokens string) *tokenAuthenticator {
+	t.Helper()
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "tokens")
+	secretFile := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(tokenFile, []byte(tokens), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(secretFile, []byte(testJWTSecret+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := newTokenAuthenticator(tokenFile, secretFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// signTestJWT 用secret签发携带claims的JWT.
+func signTestJWT(t *testing.T, method jwt.SigningMethod, secret interface{}, claims tokenClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestParsePermissions(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[permission]bool
+		ok   bool
+	}{
+		{"upload", map[permission]bool{permissionUpload: true}, true},
+		{"upload, download", map[permission]bool{permissionUpload: true, permissionDownload: true}, true},
+		{"download,download", map[permission]bool{permissionDownload: true}, true},
+		{"list", nil, false},
+		{"upload,admin", nil, false},
+		{"Upload", nil, false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parsePermissions(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("parsePermissions(%q) returned error %v, want ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parsePermissions(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for perm := range tt.want {
+			if !got[perm] {
+				t.Errorf("parsePermissions(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestLoadTokenFile(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          int
+		// err 期望的错误中包含的内容, 为空时期望成功
+		err string
+	}{
+		{name: "tokens", content: "# <name> <token> <permissions>\nci s3cr3t upload\n\nbackup  r3ad  download,upload\n", want: 2},
+		{name: "empty", content: "", want: 0},
+		{name: "missing permissions", content: "ci s3cr3t\n", err: "line 1"},
+		{name: "unknown permission", content: "# comment\nci s3cr3t list\n", err: "line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens")
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			tokens, err := loadTokenFile(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one mentioning %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tokens) != tt.want {
+				t.Errorf("loaded %d tokens, want %d", len(tokens), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadJWTSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(path, []byte(" short \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadJWTSecret(path); err == nil {
+		t.Error("loaded a jwt secret shorter than 32 bytes")
+	}
+}
+
+func TestTokenAuthenticatorAuthorize(t *testing.T) {
+	a := newTestTokenAuthenticator(t, "ci s3cr3t upload\nbackup r3ad download\n")
+	upload := map[permission]bool{permissionUpload: true}
+	valid, err := issueJWT([]byte(testJWTSecret), "ci-jwt", upload, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongSignature, err := issueJWT([]byte("fedcba9876543210fedcba9876543210"), "ci-jwt", upload, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := func(subject string, expiresAt time.Time, perms ...string) tokenClaims {
+		c := tokenClaims{Permissions: perms, RegisteredClaims: jwt.RegisteredClaims{Subject: subject}}
+		if !expiresAt.IsZero() {
+			c.ExpiresAt = jwt.NewNumericDate(expiresAt)
+		}
+		return c
+	}
+	expired := signTestJWT(t, jwt.SigningMethodHS256, []byte(testJWTSecret), claims("ci-jwt", time.Now().Add(-time.Minute), "upload"))
+	noExpiry := signTestJWT(t, jwt.SigningMethodHS256, []byte(testJWTSecret), claims("ci-jwt", time.Time{}, "upload"))
+	noSubject := signTestJWT(t, jwt.SigningMethodHS256, []byte(testJWTSecret), claims("", time.Now().Add(time.Hour), "upload"))
+	unknownPermission := signTestJWT(t, jwt.SigningMethodHS256, []byte(testJWTSecret), claims("ci-jwt", time.Now().Add(time.Hour), "admin"))
+	unsigned := signTestJWT(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims("ci-jwt", time.Now().Add(time.Hour), "upload"))
+
+	tests := []struct {
+		name string
+		// authorization 请求metadata中的authorization, 为空时不设置
+		authorization string
+		method        string
+		code          codes.Code
+		// client 校验通过后context中的调用方
+		client string
+	}{
+		{"static token", "Bearer s3cr3t", "Upload", codes.OK, "ci"},
+		{"lower case scheme", "bearer s3cr3t", "QueryUploadOffset", codes.OK, "ci"},
+		{"static token without permission", "Bearer s3cr3t", "Download", codes.PermissionDenied, ""},
+		{"unknown token", "Bearer guess", "Upload", codes.Unauthenticated, ""},
+		{"missing token", "", "Upload", codes.Unauthenticated, ""},
+		{"not a bearer token", "Basic s3cr3t", "Upload", codes.Unauthenticated, ""},
+		{"jwt", "Bearer " + valid, "Upload", codes.OK, "ci-jwt"},
+		{"jwt without permission", "Bearer " + valid, "Download", codes.PermissionDenied, ""},
+		{"expired jwt", "Bearer " + expired, "Upload", codes.Unauthenticated, ""},
+		{"jwt with a wrong signature", "Bearer " + wrongSignature, "Upload", codes.Unauthenticated, ""},
+		{"jwt without expiry", "Bearer " + noExpiry, "Upload", codes.Unauthenticated, ""},
+		{"jwt without subject", "Bearer " + noSubject, "Upload", codes.Unauthenticated, ""},
+		{"jwt with an unknown permission", "Bearer " + unknownPermission, "Upload", codes.Unauthenticated, ""},
+		{"unsigned jwt", "Bearer " + unsigned, "Upload", codes.Unauthenticated, ""},
+		{"health check needs no token", "", "/grpc.health.v1.Health/Check", codes.OK, ""},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.authorization != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.authorization))
+		}
+		method := tt.method
+		if !strings.HasPrefix(method, "/") {
+			method = serviceMethodPrefix + method
+		}
+		ctx, err := a.authorize(ctx, method)
+		if status.Code(err) != tt.code {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		identity, ok := identityFromContext(ctx)
+		if tt.client == "" {
+			if ok {
+				t.Errorf("%s: context carries caller '%s', want none", tt.name, identity.Name)
+			}
+		} else if !ok || identity.Name != tt.client {
+			t.Errorf("%s: context carries caller %v, want '%s'", tt.name, identity, tt.client)
+		}
+	}
+}
+
+func TestTokenAuthenticatorPermissionPerRPC(t *testing.T) {
+	a := newTestTokenAuthenticator(t, "ci s3cr3t upload\nbackup r3ad download\n")
+	tokens := map[permission]string{permissionUpload: "s3cr3t", permissionDownload: "r3ad"}
+
+	methods := api.File_github_com_amazingchow_photon_dance_grpc_examples_grpc_file_transfer_tool_pb_messages_proto.
+		Services().ByName("GrpcStreamService").Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := serviceMethodPrefix + string(methods.Get(i).Name())
+		// every rpc of the service must ask for a token
+		required, ok := methodPermissions[method]
+		if !ok {
+			t.Errorf("%s does not require a permission", method)
+			continue
+		}
+		for perm, token := range tokens {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+			want := codes.PermissionDenied
+			if perm == required {
+				want = codes.OK
+			}
+			if _, err := a.authorize(ctx, method); status.Code(err) != want {
+				t.Errorf("%s with a %s token: got %v, want %v", method, perm, err, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/amazingchow/grpc-playground/grpc-file-transfer-tool/common"
+)
+
+// tracingInterceptor 为每个请求创建服务端span, 父span来自客户端在metadata中带来的trace context.
+type tracingInterceptor struct {
+	tracer trace.Tracer
+}
+
+func (t *tracingInterceptor) start(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	return t.tracer.Start(common.ExtractTraceContext(ctx), fullMethod[strings.LastIndex(fullMethod, "/")+1:],
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.method", fullMethod),
+			attribute.String("transfer_id", transferIDFromContext(ctx)),
+			attribute.String("peer", peerAddress(ctx)),
+		))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.String("rpc.grpc.status_code", status.Code(err).String()))
+	span.End()
+}
+
+// UnaryServerInterceptor 返回创建服务端span的一元拦截器.
+func (t *tracingInterceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := t.start(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		endSpan(span, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor 返回创建服务端span的流拦截器.
+func (t *tracingInterceptor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := t.start(ss.Context(), info.FullMethod)
+		err := handler(srv, &tracedStream{ServerStream: ss, ctx: ctx})
+		endSpan(span, err)
+		return err
+	}
+}
+
+// tracedStream 替换流的context, 使接口实现能够在服务端span下创建子span.
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedStream) Context() context.Context {
+	return s.ctx
+}
+
+// fsync 把临时文件落盘, 单独记录一个span以便和提交区分开.
+func (gsrv *GrpcStreamServer) fsync(ctx context.Context, fd syncer) error {
+	_, span := gsrv.tracer.Start(ctx, "fsync")
+	defer span.End()
+	if err := fd.Sync(); err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	return nil
+}